@@ -9,6 +9,7 @@ import (
 	"github.com/douglasdgoulart/video-editor-api/pkg/api"
 	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
 	"github.com/douglasdgoulart/video-editor-api/pkg/job"
+	"github.com/douglasdgoulart/video-editor-api/pkg/upload"
 )
 
 func main() {
@@ -24,6 +25,14 @@ func main() {
 		api.NewServer(cfg).Run(ctx)
 	}()
 
+	if cfg.Api.Enabled && cfg.Api.UploadExpiry > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			upload.NewStore(cfg.InputPath).Sweep(ctx, cfg.Api.UploadExpiry, cfg.Logger.WithGroup("upload_sweeper"))
+		}()
+	}
+
 	if cfg.Job.Enabled {
 		for jobId := range cfg.Job.Workers {
 			wg.Add(1)
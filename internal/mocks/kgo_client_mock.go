@@ -23,17 +23,63 @@ func (_m *KgoClientMock) EXPECT() *KgoClientMock_Expecter {
 	return &KgoClientMock_Expecter{mock: &_m.Mock}
 }
 
-// PollFetches provides a mock function with given fields: ctx
-func (_m *KgoClientMock) PollFetches(ctx context.Context) kgo.Fetches {
-	ret := _m.Called(ctx)
+// MarkCommitRecords provides a mock function with given fields: rs
+func (_m *KgoClientMock) MarkCommitRecords(rs ...*kgo.Record) {
+	_va := make([]interface{}, len(rs))
+	for _i := range rs {
+		_va[_i] = rs[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, _va...)
+	_m.Called(_ca...)
+}
+
+// KgoClientMock_MarkCommitRecords_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'MarkCommitRecords'
+type KgoClientMock_MarkCommitRecords_Call struct {
+	*mock.Call
+}
+
+// MarkCommitRecords is a helper method to define mock.On call
+//   - rs ...*kgo.Record
+func (_e *KgoClientMock_Expecter) MarkCommitRecords(rs ...interface{}) *KgoClientMock_MarkCommitRecords_Call {
+	return &KgoClientMock_MarkCommitRecords_Call{Call: _e.mock.On("MarkCommitRecords",
+		append([]interface{}{}, rs...)...)}
+}
+
+func (_c *KgoClientMock_MarkCommitRecords_Call) Run(run func(rs ...*kgo.Record)) *KgoClientMock_MarkCommitRecords_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]*kgo.Record, len(args)-0)
+		for i, a := range args[0:] {
+			if a != nil {
+				variadicArgs[i] = a.(*kgo.Record)
+			}
+		}
+		run(variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *KgoClientMock_MarkCommitRecords_Call) Return() *KgoClientMock_MarkCommitRecords_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *KgoClientMock_MarkCommitRecords_Call) RunAndReturn(run func(...*kgo.Record)) *KgoClientMock_MarkCommitRecords_Call {
+	_c.Run(run)
+	return _c
+}
+
+// PollRecords provides a mock function with given fields: ctx, maxPollRecords
+func (_m *KgoClientMock) PollRecords(ctx context.Context, maxPollRecords int) kgo.Fetches {
+	ret := _m.Called(ctx, maxPollRecords)
 
 	if len(ret) == 0 {
-		panic("no return value specified for PollFetches")
+		panic("no return value specified for PollRecords")
 	}
 
 	var r0 kgo.Fetches
-	if rf, ok := ret.Get(0).(func(context.Context) kgo.Fetches); ok {
-		r0 = rf(ctx)
+	if rf, ok := ret.Get(0).(func(context.Context, int) kgo.Fetches); ok {
+		r0 = rf(ctx, maxPollRecords)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(kgo.Fetches)
@@ -43,30 +89,31 @@ func (_m *KgoClientMock) PollFetches(ctx context.Context) kgo.Fetches {
 	return r0
 }
 
-// KgoClientMock_PollFetches_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PollFetches'
-type KgoClientMock_PollFetches_Call struct {
+// KgoClientMock_PollRecords_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PollRecords'
+type KgoClientMock_PollRecords_Call struct {
 	*mock.Call
 }
 
-// PollFetches is a helper method to define mock.On call
+// PollRecords is a helper method to define mock.On call
 //   - ctx context.Context
-func (_e *KgoClientMock_Expecter) PollFetches(ctx interface{}) *KgoClientMock_PollFetches_Call {
-	return &KgoClientMock_PollFetches_Call{Call: _e.mock.On("PollFetches", ctx)}
+//   - maxPollRecords int
+func (_e *KgoClientMock_Expecter) PollRecords(ctx interface{}, maxPollRecords interface{}) *KgoClientMock_PollRecords_Call {
+	return &KgoClientMock_PollRecords_Call{Call: _e.mock.On("PollRecords", ctx, maxPollRecords)}
 }
 
-func (_c *KgoClientMock_PollFetches_Call) Run(run func(ctx context.Context)) *KgoClientMock_PollFetches_Call {
+func (_c *KgoClientMock_PollRecords_Call) Run(run func(ctx context.Context, maxPollRecords int)) *KgoClientMock_PollRecords_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context))
+		run(args[0].(context.Context), args[1].(int))
 	})
 	return _c
 }
 
-func (_c *KgoClientMock_PollFetches_Call) Return(_a0 kgo.Fetches) *KgoClientMock_PollFetches_Call {
+func (_c *KgoClientMock_PollRecords_Call) Return(_a0 kgo.Fetches) *KgoClientMock_PollRecords_Call {
 	_c.Call.Return(_a0)
 	return _c
 }
 
-func (_c *KgoClientMock_PollFetches_Call) RunAndReturn(run func(context.Context) kgo.Fetches) *KgoClientMock_PollFetches_Call {
+func (_c *KgoClientMock_PollRecords_Call) RunAndReturn(run func(context.Context, int) kgo.Fetches) *KgoClientMock_PollRecords_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -5,7 +5,11 @@ import (
 	"net/http"
 
 	"github.com/douglasdgoulart/video-editor-api/pkg/api/internal/handler"
+	"github.com/douglasdgoulart/video-editor-api/pkg/api/internal/middleware"
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
 	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/ratelimit"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
 	"github.com/labstack/echo/v4"
 	slogecho "github.com/samber/slog-echo"
 )
@@ -22,6 +26,7 @@ type Api struct {
 
 func NewApi(cfg *configuration.Configuration) ApiInterface {
 	e := echo.New()
+	e.Pre(middleware.ResponseController)
 	e.Use(slogecho.NewWithFilters(cfg.Logger, func(ctx echo.Context) bool {
 		if ctx.Request().URL.Path == "/health" || ctx.Request().URL.Path == "/ready" {
 			return false
@@ -36,14 +41,85 @@ func NewApi(cfg *configuration.Configuration) ApiInterface {
 		outputPath: cfg.OutputPath,
 	}
 
+	var authenticator, streamAuthenticator auth.Authenticator
+	var streamTokens *auth.StreamTokenAuthenticator
+	if cfg.Auth.Enabled {
+		var err error
+		authenticator, err = auth.NewAuthenticator(cfg.Auth)
+		if err != nil {
+			logger.Error("error creating authenticator", "error", err)
+			panic(err)
+		}
+		streamTokens, err = auth.NewStreamTokenAuthenticator(cfg.Auth.StreamTokens)
+		if err != nil {
+			logger.Error("error creating stream token authenticator", "error", err)
+			panic(err)
+		}
+		streamAuthenticator = auth.Chain{authenticator, streamTokens}
+	}
+	authenticate := middleware.Authenticate(authenticator, logger)
+	// Streams also accept stream tokens, as browsers cannot send headers
+	// with EventSource and WebSocket requests.
+	authenticateStream := middleware.Authenticate(streamAuthenticator, logger)
+
+	var limiter ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		var err error
+		limiter, err = ratelimit.NewLimiter(cfg.RateLimit)
+		if err != nil {
+			logger.Error("error creating rate limiter", "error", err)
+			panic(err)
+		}
+	}
+	rateLimit := func(route string) echo.MiddlewareFunc {
+		return middleware.RateLimit(limiter, route, cfg.RateLimit, logger)
+	}
+
 	processHandler := handler.NewProcessHandler(cfg)
 	healthHandler := handler.NewHealthHandler(cfg)
+	uploadHandler := handler.NewUploadHandler(cfg)
+	jobsHandler := handler.NewJobsHandler(cfg)
+	usageHandler := handler.NewUsageHandler(cfg)
+	batchHandler := handler.NewBatchHandler(cfg, processHandler)
+	presetsHandler := handler.NewPresetsHandler(cfg)
 
 	api.e.GET("/health", healthHandler.HealthHandler)
 	api.e.GET("/ready", healthHandler.ReadyHandler)
 	if cfg.Api.Enabled {
-		api.e.POST("/process", processHandler.Handler)
-		api.e.Static("/files", api.outputPath)
+		api.e.POST("/process", processHandler.Handler, authenticate, rateLimit("process"), middleware.RequireScope(auth.ScopeSubmit))
+		api.e.POST("/batches", batchHandler.Create, authenticate, rateLimit("batches"), middleware.RequireScope(auth.ScopeSubmit))
+		api.e.GET("/batches/:id", batchHandler.Get, authenticate, middleware.RequireScope(auth.ScopeRead))
+		api.e.GET("/files*", echo.StaticDirectoryHandler(echo.MustSubFS(api.e.Filesystem, api.outputPath), false),
+			authenticate, rateLimit("files"), middleware.RequireScope(auth.ScopeDownload), middleware.RequireJobPath(state.NewFileStore(cfg.StatePath)))
+		api.e.GET("/usage", usageHandler.Get, authenticate, middleware.RequireScope(auth.ScopeRead))
+
+		if streamTokens != nil {
+			streamTokenHandler := handler.NewStreamTokenHandler(cfg, streamTokens)
+			api.e.POST("/auth/stream-token", streamTokenHandler.Create, authenticate, middleware.RequireScope(auth.ScopeRead))
+		}
+
+		jobs := api.e.Group("/jobs")
+		jobs.GET("", jobsHandler.List, authenticate, middleware.RequireScope(auth.ScopeRead))
+		jobs.GET("/events", jobsHandler.Events, authenticateStream, middleware.RequireScope(auth.ScopeRead), middleware.KeepOpen)
+		jobs.GET("/:id", jobsHandler.Get, authenticate, middleware.RequireScope(auth.ScopeRead))
+		jobs.GET("/:id/logs", jobsHandler.Logs, authenticateStream, middleware.RequireScope(auth.ScopeRead), middleware.KeepOpen)
+		jobs.GET("/:id/events", jobsHandler.Events, authenticateStream, middleware.RequireScope(auth.ScopeRead), middleware.KeepOpen)
+		jobs.POST("/:id/cancel", jobsHandler.Cancel, authenticate, middleware.RequireScope(auth.ScopeCancel))
+
+		presets := api.e.Group("/presets", authenticate)
+		presets.GET("", presetsHandler.List, middleware.RequireScope(auth.ScopeRead))
+		presets.POST("", presetsHandler.Create, middleware.RequireScope(auth.ScopeSubmit))
+		presets.GET("/:name", presetsHandler.Get, middleware.RequireScope(auth.ScopeRead))
+		presets.GET("/:name/versions", presetsHandler.Versions, middleware.RequireScope(auth.ScopeRead))
+		presets.PUT("/:name", presetsHandler.Update, middleware.RequireScope(auth.ScopeSubmit))
+		presets.DELETE("/:name", presetsHandler.Delete, middleware.RequireScope(auth.ScopeSubmit))
+
+		uploads := api.e.Group("/uploads", handler.TusHeaders)
+		uploads.OPTIONS("", uploadHandler.Options)
+		uploads.POST("", uploadHandler.Create, authenticate, rateLimit("uploads"), middleware.RequireScope(auth.ScopeSubmit))
+		uploads.HEAD("/:id", uploadHandler.Head, authenticate, middleware.RequireScope(auth.ScopeSubmit))
+		uploads.PATCH("/:id", uploadHandler.Patch, authenticate, middleware.RequireScope(auth.ScopeSubmit), middleware.KeepOpen)
+		uploads.DELETE("/:id", uploadHandler.Delete, authenticate, middleware.RequireScope(auth.ScopeSubmit))
 	}
 
 	return api
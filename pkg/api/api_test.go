@@ -1,14 +1,33 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
 	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event/queue"
+	"github.com/douglasdgoulart/video-editor-api/pkg/joblog"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
 )
 
 func TestApi_Run(t *testing.T) {
@@ -42,3 +61,1270 @@ func TestApi_Run(t *testing.T) {
 	})
 
 }
+
+func TestApi_Uploads(t *testing.T) {
+	t.Run("Given a tus upload sent in two chunks, it should report the offset and finish with an upload id", func(t *testing.T) {
+		cfg := &configuration.Configuration{
+			Logger:    slog.Default(),
+			InputPath: t.TempDir(),
+			Api: configuration.ApiConfig{
+				Enabled:      true,
+				UploadExpiry: time.Hour,
+			},
+		}
+		api := NewApi(cfg)
+
+		server := httptest.NewServer(api.GetHandler())
+		defer server.Close()
+
+		video, err := os.ReadFile("../../internal/testdata/testsrc.mp4")
+		if err != nil {
+			t.Fatalf("Failed to read test video: %v", err)
+		}
+		half := len(video) / 2
+
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/uploads", server.URL), nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Length", strconv.Itoa(len(video)))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to create upload: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status Created; got %v", resp.Status)
+		}
+		location := server.URL + resp.Header.Get("Location")
+
+		patch := func(offset int, body []byte) *http.Response {
+			req, _ := http.NewRequest(http.MethodPatch, location, bytes.NewReader(body))
+			req.Header.Set("Tus-Resumable", "1.0.0")
+			req.Header.Set("Content-Type", "application/offset+octet-stream")
+			req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to patch upload: %v", err)
+			}
+			resp.Body.Close()
+			return resp
+		}
+
+		resp = patch(0, video[:half])
+		if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Upload-Offset") != strconv.Itoa(half) {
+			t.Fatalf("Expected offset %d; got %v %v", half, resp.Status, resp.Header.Get("Upload-Offset"))
+		}
+		if _, err := http.ParseTime(resp.Header.Get("Upload-Expires")); err != nil {
+			t.Errorf("Expected the expiry of the unfinished upload; got %v", resp.Header.Get("Upload-Expires"))
+		}
+
+		resp = patch(0, video[:half])
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("Expected status Conflict for a stale offset; got %v", resp.Status)
+		}
+
+		req, _ = http.NewRequest(http.MethodHead, location, nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to head upload: %v", err)
+		}
+		if resp.Header.Get("Upload-Offset") != strconv.Itoa(half) {
+			t.Errorf("Expected offset %d; got %v", half, resp.Header.Get("Upload-Offset"))
+		}
+
+		resp = patch(half, video[half:])
+		if resp.Header.Get("Upload-Id") == "" {
+			t.Errorf("Expected an upload id once the upload is finished")
+		}
+		if resp.Header.Get("Upload-Expires") != "" {
+			t.Errorf("Expected no expiry once the upload is finished; got %v", resp.Header.Get("Upload-Expires"))
+		}
+	})
+}
+
+func TestApi_Process(t *testing.T) {
+	newServer := func(t *testing.T) (*httptest.Server, *queue.Queue[event.Event]) {
+		queue := event.NewQueue(nil)
+		cfg := &configuration.Configuration{
+			Logger:        slog.Default(),
+			InputPath:     t.TempDir(),
+			StatePath:     t.TempDir(),
+			InternalQueue: queue,
+			Api: configuration.ApiConfig{
+				Enabled: true,
+			},
+		}
+		return httptest.NewServer(NewApi(cfg).GetHandler()), queue
+	}
+
+	t.Run("Given a JSON request with a file url, it should emit an event without a multipart upload", func(t *testing.T) {
+		server, queue := newServer(t)
+		defer server.Close()
+
+		body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"thumbnail.jpg"}}`
+		resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", resp.Status)
+		}
+
+		e, ok := queue.TryPop()
+		if !ok {
+			t.Fatal("Expected an event to be emitted")
+		}
+		if e.EditorRequest.Input.FileURL != "https://example.com/video.mp4" {
+			t.Errorf("Expected file url to be forwarded; got %v", e.EditorRequest.Input.FileURL)
+		}
+	})
+
+	t.Run("Given a JSON request without any input, it should return bad request", func(t *testing.T) {
+		server, _ := newServer(t)
+		defer server.Close()
+
+		body := `{"input":{"uploaded_file_path":"/etc/passwd"},"output":{"file_pattern":"thumbnail.jpg"}}`
+		resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status Bad Request; got %v", resp.Status)
+		}
+	})
+
+	t.Run("Given a pipeline request, it should only require the outputs of its steps", func(t *testing.T) {
+		server, queue := newServer(t)
+		defer server.Close()
+
+		body := `{"input":{"file_url":"https://example.com/video.mp4"},"steps":[
+			{"id":"trim","output":{"file_pattern":"trim.mp4"},"extra_options":"-t 10"},
+			{"id":"thumbnail","input":{"step":"trim"},"output":{"file_pattern":"thumbnail.jpg"},"frames":"1"}
+		]}`
+		resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", resp.Status)
+		}
+
+		e, ok := queue.TryPop()
+		if !ok || len(e.EditorRequest.Steps) != 2 || e.EditorRequest.Steps[1].Input.Step != "trim" {
+			t.Errorf("Expected the steps to be emitted; got %+v", e.EditorRequest.Steps)
+		}
+	})
+
+	t.Run("Given pipeline steps forming a cycle or referencing unknown steps, it should return bad request", func(t *testing.T) {
+		server, _ := newServer(t)
+		defer server.Close()
+
+		for _, body := range []string{
+			`{"input":{"file_url":"https://example.com/video.mp4"},"steps":[{"id":"a","input":{"step":"b"},"output":{"file_pattern":"a.mp4"}},{"id":"b","input":{"step":"a"},"output":{"file_pattern":"b.mp4"}}]}`,
+			`{"input":{"file_url":"https://example.com/video.mp4"},"steps":[{"id":"a","input":{"step":"missing"},"output":{"file_pattern":"a.mp4"}}]}`,
+			`{"steps":[{"id":"a","output":{"file_pattern":"a.mp4"}}]}`,
+		} {
+			resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to make POST request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status Bad Request for %s; got %v", body, resp.Status)
+			}
+		}
+	})
+
+	t.Run("Given a concat request, it should emit an event with every input", func(t *testing.T) {
+		server, queue := newServer(t)
+		defer server.Close()
+
+		body := `{"inputs":[{"file_url":"https://example.com/a.mp4"},{"file_url":"https://example.com/b.mp4"}],"concat":{"method":"filter"},"output":{"file_pattern":"joined.mp4"}}`
+		resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", resp.Status)
+		}
+
+		e, ok := queue.TryPop()
+		if !ok || len(e.EditorRequest.Inputs) != 2 || e.EditorRequest.Inputs[1].FileURL != "https://example.com/b.mp4" {
+			t.Errorf("Expected the inputs to be emitted; got %+v", e.EditorRequest.Inputs)
+		}
+	})
+
+	t.Run("Given invalid concat requests, it should return bad request", func(t *testing.T) {
+		server, _ := newServer(t)
+		defer server.Close()
+
+		for _, body := range []string{
+			`{"inputs":[{"file_url":"https://example.com/a.mp4"},{"file_url":"https://example.com/b.mp4"}],"output":{"file_pattern":"joined.mp4"}}`,
+			`{"inputs":[{"file_url":"https://example.com/a.mp4"}],"concat":{},"output":{"file_pattern":"joined.mp4"}}`,
+			`{"inputs":[{"file_url":"https://example.com/a.mp4"},{"file_url":"file:///etc/passwd"}],"concat":{},"output":{"file_pattern":"joined.mp4"}}`,
+			`{"inputs":[{"file_url":"https://example.com/a.mp4"},{"file_url":"https://example.com/b.mp4"}],"concat":{"method":"merge"},"output":{"file_pattern":"joined.mp4"}}`,
+		} {
+			resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to make POST request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status Bad Request for %s; got %v", body, resp.Status)
+			}
+		}
+	})
+
+	t.Run("Given an overlay, it should validate its input and options", func(t *testing.T) {
+		server, queue := newServer(t)
+		defer server.Close()
+
+		body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"video.mp4"},"overlay":{"input":{"file_url":"https://example.com/logo.png"},"position":"top-left","margin":16,"opacity":0.8,"scale":0.1}}`
+		resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", resp.Status)
+		}
+		if e, ok := queue.TryPop(); !ok || e.EditorRequest.Overlay == nil || e.EditorRequest.Overlay.Input.FileURL != "https://example.com/logo.png" {
+			t.Errorf("Expected the overlay to be emitted; got %+v", e.EditorRequest.Overlay)
+		}
+
+		for _, overlay := range []string{
+			`{"input":{}}`,
+			`{"input":{"file_url":"file:///etc/passwd"}}`,
+			`{"input":{"file_url":"https://example.com/logo.png"},"position":"middle"}`,
+			`{"input":{"file_url":"https://example.com/logo.png"},"x":10}`,
+			`{"input":{"file_url":"https://example.com/logo.png"},"opacity":1.5}`,
+			`{"input":{"file_url":"https://example.com/logo.png"},"start":10,"end":5}`,
+		} {
+			body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"video.mp4"},"overlay":` + overlay + `}`
+			resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to make POST request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status Bad Request for %s; got %v", overlay, resp.Status)
+			}
+		}
+	})
+
+	t.Run("Given texts and subtitles, it should validate them", func(t *testing.T) {
+		server, queue := newServer(t)
+		defer server.Close()
+
+		body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"video.mp4"},` +
+			`"texts":[{"text":"It's 100%: done","font":"Roboto-Bold.ttf","color":"white@0.8","box":true,"position":"top-left","margin":24,"end":5}],` +
+			`"subtitles":{"input":{"file_url":"https://example.com/captions.srt"},"style":"FontSize=24"}}`
+		resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", resp.Status)
+		}
+		if e, ok := queue.TryPop(); !ok || len(e.EditorRequest.Texts) != 1 || e.EditorRequest.Subtitles == nil {
+			t.Errorf("Expected the texts and subtitles to be emitted; got %+v", e.EditorRequest)
+		}
+
+		for _, captions := range []string{
+			`"texts":[{"text":""}]`,
+			`"texts":[{"text":"a","font":"../../etc/passwd"}]`,
+			`"texts":[{"text":"a","color":"red; rm"}]`,
+			`"texts":[{"text":"a","position":"custom","x":-1}]`,
+			`"subtitles":{"input":{}}`,
+		} {
+			body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"video.mp4"},` + captions + `}`
+			resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to make POST request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status Bad Request for %s; got %v", captions, resp.Status)
+			}
+		}
+	})
+
+	t.Run("Given an audio operation, it should validate its mode and input", func(t *testing.T) {
+		server, queue := newServer(t)
+		defer server.Close()
+
+		body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"video.mp4"},` +
+			`"audio":{"mode":"mix","input":{"file_url":"https://example.com/music.mp3"},"gain":-12,"ducking":true,"loop":true}}`
+		resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", resp.Status)
+		}
+		if e, ok := queue.TryPop(); !ok || e.EditorRequest.Audio == nil || e.EditorRequest.Audio.Input.FileURL != "https://example.com/music.mp3" {
+			t.Errorf("Expected the audio operation to be emitted; got %+v", e.EditorRequest.Audio)
+		}
+
+		for _, operation := range []string{
+			`"output":{"file_pattern":"audio.mp4"},"audio":{"mode":"extract"}`,
+			`"output":{"file_pattern":"audio.mp3"},"audio":{"mode":"extract","input":{"file_url":"https://example.com/music.mp3"}}`,
+			`"output":{"file_pattern":"audio.mp3"},"audio":{"mode":"extract"},"texts":[{"text":"a"}]`,
+			`"output":{"file_pattern":"video.mp4"},"audio":{"mode":"replace"}`,
+			`"output":{"file_pattern":"video.mp4"},"audio":{"mode":"replace","input":{"file_url":"https://example.com/music.mp3"},"ducking":true}`,
+			`"output":{"file_pattern":"video.mp4"},"audio":{"mode":"mix","input":{"file_url":"https://example.com/music.mp3"},"gain":40}`,
+			`"output":{"file_pattern":"video.mp4"},"audio":{"mode":"mute"}`,
+		} {
+			body := `{"input":{"file_url":"https://example.com/video.mp4"},` + operation + `}`
+			resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to make POST request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status Bad Request for %s; got %v", operation, resp.Status)
+			}
+		}
+	})
+
+	t.Run("Given loudness targets, it should validate their ranges", func(t *testing.T) {
+		server, queue := newServer(t)
+		defer server.Close()
+
+		body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"video.mp4"},"loudness":{"integrated":-16,"true_peak":-1.5,"range":11}}`
+		resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", resp.Status)
+		}
+		if e, ok := queue.TryPop(); !ok || e.EditorRequest.Loudness == nil || e.EditorRequest.Loudness.Integrated != -16 {
+			t.Errorf("Expected the loudness targets to be emitted; got %+v", e.EditorRequest.Loudness)
+		}
+
+		for _, loudness := range []string{
+			`"output":{"file_pattern":"video.mp4"},"loudness":{"integrated":-80}`,
+			`"output":{"file_pattern":"video.mp4"},"loudness":{"true_peak":1}`,
+			`"output":{"file_pattern":"video.mp4"},"loudness":{"range":60}`,
+			`"output":{"file_pattern":"video.m3u8","mode":"hls","ladder":[{"name":"720p","height":720,"video_bitrate":"3M"}]},"loudness":{}`,
+		} {
+			body := `{"input":{"file_url":"https://example.com/video.mp4"},` + loudness + `}`
+			resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to make POST request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status Bad Request for %s; got %v", loudness, resp.Status)
+			}
+		}
+	})
+
+	t.Run("Given a rate control, it should validate it against the codec", func(t *testing.T) {
+		server, queue := newServer(t)
+		defer server.Close()
+
+		body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"video.mp4"},"rate_control":{"mode":"crf","crf":23,"max_rate":"3M","buf_size":"6M"}}`
+		resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", resp.Status)
+		}
+		if e, ok := queue.TryPop(); !ok || e.EditorRequest.RateControl == nil || e.EditorRequest.RateControl.CRF != 23 {
+			t.Errorf("Expected the rate control to be emitted; got %+v", e.EditorRequest.RateControl)
+		}
+
+		for _, rateControl := range []string{
+			`"rate_control":{"mode":"vbr"}`,
+			`"rate_control":{"mode":"crf","crf":60}`,
+			`"codec":"libvpx-vp9","rate_control":{"mode":"crf","crf":70}`,
+			`"codec":"mpeg4","rate_control":{"mode":"crf","crf":20}`,
+			`"rate_control":{"mode":"crf","crf":20,"max_rate":"3M"}`,
+			`"rate_control":{"mode":"two_pass"}`,
+			`"rate_control":{"mode":"two_pass","bitrate":"fast"}`,
+			`"codec":"libx265","rate_control":{"mode":"two_pass","bitrate":"2M"}`,
+		} {
+			body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"video.mp4"},` + rateControl + `}`
+			resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to make POST request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status Bad Request for %s; got %v", rateControl, resp.Status)
+			}
+		}
+	})
+
+	t.Run("Given a trim, it should validate its times and mode", func(t *testing.T) {
+		server, queue := newServer(t)
+		defer server.Close()
+
+		body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"video.mp4"},"start_time":"00:00:05.5","end_time":"300f","trim_mode":"smart"}`
+		resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", resp.Status)
+		}
+		if e, ok := queue.TryPop(); !ok || e.EditorRequest.EndTime != "300f" || e.EditorRequest.TrimMode != "smart" {
+			t.Errorf("Expected the trim to be emitted; got %+v", e.EditorRequest)
+		}
+
+		for _, trim := range []string{
+			`"start_time":"soon"`,
+			`"start_time":"00:75:00"`,
+			`"end_time":"10","duration":"5"`,
+			`"duration":"0"`,
+			`"start_time":"10","end_time":"5"`,
+			`"start_time":"10","trim_mode":"exact"`,
+			`"trim_mode":"fast"`,
+			`"start_time":"10","trim_mode":"fast","filters":{"scale":"640:-2"}`,
+		} {
+			body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"video.mp4"},` + trim + `}`
+			resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to make POST request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status Bad Request for %s; got %v", trim, resp.Status)
+			}
+		}
+	})
+
+	t.Run("Given a scenes or split output, it should validate its options", func(t *testing.T) {
+		server, queue := newServer(t)
+		defer server.Close()
+
+		for _, output := range []string{
+			`{"file_pattern":"scenes.json","mode":"scenes","scenes":{"threshold":0.4,"thumbnails":true,"width":480}}`,
+			`{"file_pattern":"clip_%03d.mp4","mode":"split","split":{"times":[4.2,9]}}`,
+		} {
+			body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":` + output + `}`
+			resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to make POST request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status OK for %s; got %v", output, resp.Status)
+			}
+			if _, ok := queue.TryPop(); !ok {
+				t.Errorf("Expected an event to be emitted for %s", output)
+			}
+		}
+
+		for _, output := range []string{
+			`{"file_pattern":"scenes.mp4","mode":"scenes"}`,
+			`{"file_pattern":"scenes.json","mode":"scenes","scenes":{"threshold":1.5}}`,
+			`{"file_pattern":"scenes.json","mode":"scenes","scenes":{"width":480}}`,
+			`{"file_pattern":"scenes.json","scenes":{}}`,
+			`{"file_pattern":"clip.mp4","mode":"split","split":{"times":[4.2]}}`,
+			`{"file_pattern":"clip_%03d.mp4","mode":"split"}`,
+			`{"file_pattern":"clip_%03d.mp4","mode":"split","split":{"times":[9,4.2]}}`,
+		} {
+			body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":` + output + `}`
+			resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to make POST request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status Bad Request for %s; got %v", output, resp.Status)
+			}
+		}
+	})
+
+	t.Run("Given a JSON request with an unknown priority, it should return bad request", func(t *testing.T) {
+		server, _ := newServer(t)
+		defer server.Close()
+
+		body := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"thumbnail.jpg"},"priority":"urgent"}`
+		resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status Bad Request; got %v", resp.Status)
+		}
+	})
+
+	t.Run("Given a multipart upload that is not media, it should return unsupported media type", func(t *testing.T) {
+		server, _ := newServer(t)
+		defer server.Close()
+
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		_ = writer.WriteField("event", `{"output":{"file_pattern":"thumbnail.jpg"}}`)
+		part, _ := writer.CreateFormFile("file", "video")
+		_, _ = part.Write([]byte("definitely not a video"))
+		writer.Close()
+
+		resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), writer.FormDataContentType(), body)
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("Expected status Unsupported Media Type; got %v", resp.Status)
+		}
+	})
+
+	t.Run("Given a multipart upload of a video, it should store it with its container and checksum", func(t *testing.T) {
+		server, queue := newServer(t)
+		defer server.Close()
+
+		video, err := os.ReadFile("../../internal/testdata/testsrc.mp4")
+		if err != nil {
+			t.Fatalf("Failed to read test video: %v", err)
+		}
+
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", "video")
+		_, _ = part.Write(video)
+		_ = writer.WriteField("event", `{"output":{"file_pattern":"thumbnail.jpg"}}`)
+		writer.Close()
+
+		resp, err := http.Post(fmt.Sprintf("%s/process", server.URL), writer.FormDataContentType(), body)
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", resp.Status)
+		}
+
+		e, ok := queue.TryPop()
+		if !ok {
+			t.Fatal("Expected an event to be emitted")
+		}
+		input := e.EditorRequest.Input
+		if !strings.HasSuffix(input.UploadedFilePath, ".mp4") || input.Container != "mp4" {
+			t.Errorf("Expected an mp4 input; got %v %v", input.UploadedFilePath, input.Container)
+		}
+		if input.SHA256 != fmt.Sprintf("%x", sha256.Sum256(video)) {
+			t.Errorf("Expected the checksum of the video; got %v", input.SHA256)
+		}
+	})
+}
+
+func TestApi_Auth(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Logger:        slog.Default(),
+		InputPath:     t.TempDir(),
+		StatePath:     t.TempDir(),
+		InternalQueue: event.NewQueue(nil),
+		Api: configuration.ApiConfig{
+			Enabled: true,
+		},
+		Auth: configuration.AuthConfig{
+			Enabled: true,
+			Keys: []configuration.ApiKeyConfig{
+				{Id: "team-a", Hash: auth.HashKey("key-a"), Scopes: []string{auth.ScopeSubmit, auth.ScopeRead}},
+				{Id: "team-b", Hash: auth.HashKey("key-b"), Scopes: []string{auth.ScopeRead}},
+			},
+		},
+	}
+	server := httptest.NewServer(NewApi(cfg).GetHandler())
+	defer server.Close()
+
+	do := func(method string, path string, key string, body string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make %s request: %v", method, err)
+		}
+		return resp
+	}
+	submit := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"thumbnail.jpg"}}`
+
+	t.Run("Given no api key, it should return unauthorized", func(t *testing.T) {
+		resp := do(http.MethodPost, "/process", "", submit)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status Unauthorized; got %v", resp.Status)
+		}
+	})
+
+	t.Run("Given a key without the submit scope, it should return forbidden", func(t *testing.T) {
+		resp := do(http.MethodPost, "/process", "key-b", submit)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected status Forbidden; got %v", resp.Status)
+		}
+	})
+
+	t.Run("Given a submitted job, only the key that submitted it should read it", func(t *testing.T) {
+		resp := do(http.MethodPost, "/process", "key-a", submit)
+		var submitted map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&submitted)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", resp.Status)
+		}
+
+		resp = do(http.MethodGet, "/jobs/"+submitted["id"], "key-a", "")
+		var job map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&job)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || job["owner"] != "key:team-a" || job["status"] != "queued" {
+			t.Errorf("Expected a queued job owned by team-a; got %v %v", resp.Status, job)
+		}
+
+		resp = do(http.MethodGet, "/jobs/"+submitted["id"], "key-b", "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status Not Found for another key; got %v", resp.Status)
+		}
+
+		resp = do(http.MethodGet, "/jobs", "key-b", "")
+		var jobs []map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&jobs)
+		resp.Body.Close()
+		if len(jobs) != 0 {
+			t.Errorf("Expected no jobs listed for another key; got %v", len(jobs))
+		}
+	})
+
+	t.Run("Given a stream token, it should only authenticate the streams of its key", func(t *testing.T) {
+		resp := do(http.MethodPost, "/process", "key-a", submit)
+		var submitted map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&submitted)
+		resp.Body.Close()
+
+		issue := func(key string) string {
+			resp := do(http.MethodPost, "/auth/stream-token", key, "")
+			var issued map[string]string
+			_ = json.NewDecoder(resp.Body).Decode(&issued)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || issued["token"] == "" {
+				t.Fatalf("Expected a stream token; got %v %v", resp.Status, issued)
+			}
+			return issued["token"]
+		}
+		tokenA, tokenB := issue("key-a"), issue("key-b")
+
+		// Browsers send no headers on streams, the job stays queued so only
+		// the response headers are awaited.
+		stream := func(path string) *http.Response {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to make GET request: %v", err)
+			}
+			resp.Body.Close()
+			return resp
+		}
+
+		eventsPath := "/jobs/" + submitted["id"] + "/events"
+		if resp := stream(eventsPath); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status Unauthorized without a token; got %v", resp.Status)
+		}
+		if resp := stream(eventsPath + "?access_token=" + tokenA); resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Errorf("Expected the events of the job; got %v", resp.Status)
+		}
+		if resp := stream(eventsPath + "?access_token=" + tokenB); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status Not Found for the token of another key; got %v", resp.Status)
+		}
+		if resp := stream("/jobs/" + submitted["id"] + "?access_token=" + tokenA); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status Unauthorized outside of streams; got %v", resp.Status)
+		}
+	})
+}
+
+func TestApi_Tenants(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Logger:        slog.Default(),
+		InputPath:     t.TempDir(),
+		OutputPath:    t.TempDir(),
+		StatePath:     t.TempDir(),
+		InternalQueue: event.NewQueue(nil),
+		Api: configuration.ApiConfig{
+			Enabled: true,
+		},
+		Auth: configuration.AuthConfig{
+			Enabled: true,
+			Keys: []configuration.ApiKeyConfig{
+				{Id: "a", Hash: auth.HashKey("key-a"), Tenant: "team-a", Scopes: []string{auth.ScopeSubmit, auth.ScopeRead, auth.ScopeDownload}},
+				{Id: "b", Hash: auth.HashKey("key-b"), Tenant: "team-b", Scopes: []string{auth.ScopeRead, auth.ScopeDownload}},
+				{Id: "c", Hash: auth.HashKey("key-c"), Tenant: "team-a", Scopes: []string{auth.ScopeRead, auth.ScopeDownload}},
+			},
+		},
+		Tenants: configuration.TenantsConfig{
+			Limits: map[string]configuration.TenantLimits{"team-a": {MaxActiveJobs: 1}},
+		},
+	}
+	server := httptest.NewServer(NewApi(cfg).GetHandler())
+	defer server.Close()
+
+	do := func(method string, path string, key string, body string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make %s request: %v", method, err)
+		}
+		return resp
+	}
+	submit := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"thumbnail.jpg"}}`
+
+	t.Run("Given a tenant at its active jobs limit, it should return too many requests", func(t *testing.T) {
+		resp := do(http.MethodPost, "/process", "key-a", submit)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", resp.Status)
+		}
+
+		resp = do(http.MethodPost, "/process", "key-a", submit)
+		var body map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests || body["reason"] != "active_jobs" {
+			t.Errorf("Expected status Too Many Requests for active jobs; got %v %v", resp.Status, body)
+		}
+
+		resp = do(http.MethodGet, "/usage", "key-a", "")
+		var usage map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&usage)
+		resp.Body.Close()
+		if usage["tenant"] != "team-a" || usage["active_jobs"] != float64(1) {
+			t.Errorf("Expected one active job for team-a; got %v", usage)
+		}
+
+		resp = do(http.MethodGet, "/usage?tenant=team-a", "key-b", "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected status Forbidden for the usage of another tenant; got %v", resp.Status)
+		}
+	})
+
+	t.Run("Given outputs of a job, only the owner of the job should download them", func(t *testing.T) {
+		id := uuid.New().String()
+		job := &state.JobState{Id: id, Owner: auth.APIKeyPrefix + "a", Tenant: "team-a", Status: state.StatusSuccess}
+		if err := state.NewFileStore(cfg.StatePath).Save(context.Background(), job); err != nil {
+			t.Fatal(err)
+		}
+		dir := filepath.Join(cfg.OutputPath, "team-a", id)
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "thumbnail.jpg"), []byte("jpg"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		path := strings.TrimPrefix(dir, cfg.OutputPath) + "/thumbnail.jpg"
+
+		resp := do(http.MethodGet, "/files"+path, "key-a", "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status OK; got %v", resp.Status)
+		}
+
+		for _, p := range []string{path, "/team-b/.." + path} {
+			resp = do(http.MethodGet, "/files"+p, "key-b", "")
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNotFound {
+				t.Errorf("Expected status Not Found for another tenant; got %v", resp.Status)
+			}
+		}
+
+		resp = do(http.MethodGet, "/files"+path, "key-c", "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status Not Found for another key of the tenant; got %v", resp.Status)
+		}
+	})
+}
+
+func TestApi_RateLimit(t *testing.T) {
+	t.Run("Given a client over the process rate limit, it should return too many requests", func(t *testing.T) {
+		cfg := &configuration.Configuration{
+			Logger:        slog.Default(),
+			InputPath:     t.TempDir(),
+			StatePath:     t.TempDir(),
+			InternalQueue: event.NewQueue(nil),
+			Api: configuration.ApiConfig{
+				Enabled: true,
+			},
+			RateLimit: configuration.RateLimitConfig{
+				Enabled: true,
+				Routes: map[string]configuration.RateLimitRoute{
+					"process": {Requests: 1, Period: time.Minute, Key: "ip"},
+				},
+			},
+		}
+		server := httptest.NewServer(NewApi(cfg).GetHandler())
+		defer server.Close()
+
+		submit := `{"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"thumbnail.jpg"}}`
+		resp, err := http.Post(server.URL+"/process", "application/json", strings.NewReader(submit))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("RateLimit-Remaining") != "0" {
+			t.Fatalf("Expected status OK with no remaining requests; got %v %v", resp.Status, resp.Header)
+		}
+
+		resp, err = http.Post(server.URL+"/process", "application/json", strings.NewReader(submit))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("Expected status Too Many Requests; got %v", resp.Status)
+		}
+		if resp.Header.Get("Retry-After") != "60" || resp.Header.Get("RateLimit-Limit") != "1" {
+			t.Errorf("Expected rate limit headers; got %v", resp.Header)
+		}
+	})
+}
+
+// newTimedServer serves handler from an http.Server whose read and write
+// timeouts elapse well before the streams of the tests end.
+func newTimedServer(handler http.Handler) *httptest.Server {
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ReadTimeout = 200 * time.Millisecond
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	return server
+}
+
+func TestApi_JobLogs(t *testing.T) {
+	t.Run("Given a running job, it should stream its log until it finishes", func(t *testing.T) {
+		cfg := &configuration.Configuration{
+			Logger:    slog.Default(),
+			StatePath: t.TempDir(),
+			Api: configuration.ApiConfig{
+				Enabled: true,
+			},
+		}
+		// The job outlives the timeouts of the server.
+		server := newTimedServer(NewApi(cfg).GetHandler())
+		defer server.Close()
+
+		ctx := context.Background()
+		store := state.NewFileStore(cfg.StatePath)
+		id := uuid.New().String()
+		if err := store.Save(ctx, &state.JobState{Id: id, Status: state.StatusRunning}); err != nil {
+			t.Fatal(err)
+		}
+		log, err := joblog.Create(joblog.Dir(cfg.StatePath), id, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = log.Write([]byte("Input #0, mov,mp4\n"))
+
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			_, _ = log.Write([]byte("Conversion failed!\n"))
+			log.Close()
+			_, _ = store.Update(ctx, id, func(job *state.JobState) error {
+				job.Status = state.StatusError
+				return nil
+			})
+		}()
+
+		resp, err := http.Get(fmt.Sprintf("%s/jobs/%s/logs", server.URL, id))
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "Input #0, mov,mp4\nConversion failed!\n" {
+			t.Errorf("Expected the whole log; got %q", body)
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/jobs/%s/logs", server.URL, id))
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		body, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.HasSuffix(string(body), "Conversion failed!\n") {
+			t.Errorf("Expected the log of the finished job; got %v %q", resp.Status, body)
+		}
+	})
+	t.Run("Given a pipeline job without a step, it should ask for one", func(t *testing.T) {
+		cfg := &configuration.Configuration{
+			Logger:    slog.Default(),
+			StatePath: t.TempDir(),
+			Api: configuration.ApiConfig{
+				Enabled: true,
+			},
+		}
+		server := httptest.NewServer(NewApi(cfg).GetHandler())
+		defer server.Close()
+
+		id := uuid.New().String()
+		err := state.NewFileStore(cfg.StatePath).Save(context.Background(), &state.JobState{
+			Id:     id,
+			Status: state.StatusRunning,
+			Request: request.EditorRequest{Steps: []request.Step{
+				{Id: "trim"},
+				{Id: "scale"},
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Get(fmt.Sprintf("%s/jobs/%s/logs", server.URL, id))
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "trim, scale") {
+			t.Errorf("Expected a bad request listing the steps; got %v %q", resp.Status, body)
+		}
+	})
+}
+
+func TestApi_JobEvents(t *testing.T) {
+	cfg := &configuration.Configuration{
+		Logger:    slog.Default(),
+		StatePath: t.TempDir(),
+		Api: configuration.ApiConfig{
+			Enabled: true,
+		},
+	}
+	// Jobs outlive the timeouts of the server.
+	server := newTimedServer(NewApi(cfg).GetHandler())
+	defer server.Close()
+
+	ctx := context.Background()
+	store := state.NewFileStore(cfg.StatePath)
+
+	runJob := func(t *testing.T) string {
+		id := uuid.New().String()
+		if err := store.Save(ctx, &state.JobState{Id: id, Status: state.StatusRunning}); err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			_, _ = store.Update(ctx, id, func(job *state.JobState) error {
+				job.Progress = 50
+				return nil
+			})
+			time.Sleep(600 * time.Millisecond)
+			_, _ = store.Update(ctx, id, func(job *state.JobState) error {
+				job.Status = state.StatusSuccess
+				job.Progress = 100
+				return nil
+			})
+		}()
+		return id
+	}
+
+	t.Run("Given a running job, it should stream its events until it finishes", func(t *testing.T) {
+		id := runJob(t)
+
+		resp, err := http.Get(fmt.Sprintf("%s/jobs/%s/events", server.URL, id))
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Errorf("Expected an event stream; got %v", resp.Header.Get("Content-Type"))
+		}
+		var kinds []string
+		for _, line := range strings.Split(string(body), "\n") {
+			if kind, ok := strings.CutPrefix(line, "event: "); ok {
+				kinds = append(kinds, kind)
+			}
+		}
+		if strings.Join(kinds, ",") != "state,progress,state,end" {
+			t.Errorf("Expected state, progress, state and end events; got %q", body)
+		}
+		if !strings.Contains(string(body), `"status":"success","progress":100`) {
+			t.Errorf("Expected the final state of the job; got %q", body)
+		}
+	})
+
+	t.Run("Given unknown or too many jobs, it should not stream them", func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/jobs/events?ids=%s", server.URL, uuid.New().String()))
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status code %d; got %d", http.StatusNotFound, resp.StatusCode)
+		}
+
+		resp, err = http.Get(server.URL + "/jobs/events?ids=" + strings.Repeat("a,", 101))
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status code %d; got %d", http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+
+	t.Run("Given a WebSocket, it should send the events of every job as messages", func(t *testing.T) {
+		first, second := runJob(t), runJob(t)
+
+		url := fmt.Sprintf("ws%s/jobs/events?ids=%s,%s", strings.TrimPrefix(server.URL, "http"), first, second)
+		ws, err := websocket.Dial(url, "", server.URL)
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		defer ws.Close()
+
+		done := map[string]bool{}
+		for {
+			var message struct {
+				Type string          `json:"type"`
+				Job  *state.JobState `json:"job"`
+			}
+			if err := websocket.JSON.Receive(ws, &message); err != nil {
+				t.Fatalf("Failed to receive: %v", err)
+			}
+			if message.Type == "end" {
+				break
+			}
+			if message.Job.Status == state.StatusSuccess {
+				done[message.Job.Id] = true
+			}
+		}
+		if !done[first] || !done[second] {
+			t.Errorf("Expected both jobs to be done; got %v", done)
+		}
+	})
+}
+
+func TestApi_Batches(t *testing.T) {
+	queue := event.NewQueue(nil)
+	cfg := &configuration.Configuration{
+		Logger:        slog.Default(),
+		InputPath:     t.TempDir(),
+		StatePath:     t.TempDir(),
+		InternalQueue: queue,
+		Api: configuration.ApiConfig{
+			Enabled:      true,
+			MaxBatchSize: 3,
+		},
+	}
+	server := httptest.NewServer(NewApi(cfg).GetHandler())
+	defer server.Close()
+
+	t.Run("Given a batch sharing an input, it should create a job per request and report their aggregate status", func(t *testing.T) {
+		body := `{"input":{"file_url":"https://example.com/video.mp4"},"webhook_url":"https://example.com/hook","requests":[
+			{"output":{"file_pattern":"first.jpg"},"start_time":"00:00:01"},
+			{"output":{"file_pattern":"second.jpg"},"start_time":"00:00:02"},
+			{"input":{"file_url":"https://example.com/other.mp4"},"output":{"file_pattern":"other.jpg"}}
+		]}`
+		resp, err := http.Post(server.URL+"/batches", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to make POST request: %v", err)
+		}
+		var created struct {
+			Id     string   `json:"id"`
+			JobIds []string `json:"job_ids"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&created)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || len(created.JobIds) != 3 {
+			t.Fatalf("Expected a batch of 3 jobs; got %v %+v", resp.Status, created)
+		}
+
+		inputs := map[string]string{}
+		for range created.JobIds {
+			e, ok := queue.TryPop()
+			if !ok {
+				t.Fatal("Expected an event per request")
+			}
+			if e.BatchId != created.Id {
+				t.Errorf("Expected event of batch %s; got %q", created.Id, e.BatchId)
+			}
+			inputs[e.EditorRequest.Output.FilePattern] = e.EditorRequest.Input.FileURL
+		}
+		if inputs["second.jpg"] != "https://example.com/video.mp4" || inputs["other.jpg"] != "https://example.com/other.mp4" {
+			t.Errorf("Expected requests without input to use the batch input; got %v", inputs)
+		}
+
+		store := state.NewFileStore(cfg.StatePath)
+		_, _ = store.Update(context.Background(), created.JobIds[0], func(job *state.JobState) error {
+			job.Status = state.StatusSuccess
+			job.Progress = 100
+			return nil
+		})
+
+		resp, err = http.Get(server.URL + "/batches/" + created.Id)
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		var summary struct {
+			Status   state.Status         `json:"status"`
+			Progress float64              `json:"progress"`
+			Counts   map[state.Status]int `json:"counts"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&summary)
+		resp.Body.Close()
+		if summary.Status != state.StatusRunning || math.Abs(summary.Progress-100.0/3) > 0.01 || summary.Counts[state.StatusQueued] != 2 {
+			t.Errorf("Expected a running batch a third done; got %+v", summary)
+		}
+	})
+
+	t.Run("Given an invalid or oversized batch, it should return bad request", func(t *testing.T) {
+		for _, body := range []string{
+			`{"requests":[]}`,
+			`{"requests":[{"output":{"file_pattern":"a.jpg"}}]}`,
+			`{"input":{"file_url":"https://example.com/video.mp4"},"requests":[{"output":{"file_pattern":"a.jpg"},"priority":"urgent"}]}`,
+			`{"input":{"file_url":"https://example.com/video.mp4"},"requests":[{"output":{"file_pattern":"a.jpg"}},{"output":{"file_pattern":"b.jpg"}},{"output":{"file_pattern":"c.jpg"}},{"output":{"file_pattern":"d.jpg"}}]}`,
+		} {
+			resp, err := http.Post(server.URL+"/batches", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to make POST request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status Bad Request for %s; got %v", body, resp.Status)
+			}
+		}
+		if queue.Len() != 0 {
+			t.Errorf("Expected no job to be queued; got %d", queue.Len())
+		}
+	})
+
+	t.Run("Given an unknown batch, it should return not found", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/batches/" + uuid.New().String())
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status Not Found; got %v", resp.Status)
+		}
+	})
+}
+
+func TestApi_Presets(t *testing.T) {
+	queue := event.NewQueue(nil)
+	cfg := &configuration.Configuration{
+		Logger:        slog.Default(),
+		InputPath:     t.TempDir(),
+		StatePath:     t.TempDir(),
+		InternalQueue: queue,
+		Api: configuration.ApiConfig{
+			Enabled: true,
+		},
+	}
+	server := httptest.NewServer(NewApi(cfg).GetHandler())
+	defer server.Close()
+
+	do := func(t *testing.T, method string, path string, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make %s request: %v", method, err)
+		}
+		return resp
+	}
+
+	t.Run("Given versioned presets, it should resolve them when jobs are submitted", func(t *testing.T) {
+		resp := do(t, http.MethodPost, "/presets", `{"name":"web-720p","params":{"height":"720"},"request":{"codec":"libx264","filters":{"scale":"-2:{{height}}"}}}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status Created; got %v", resp.Status)
+		}
+		resp = do(t, http.MethodPost, "/presets", `{"name":"web-720p","request":{}}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("Expected status Conflict; got %v", resp.Status)
+		}
+
+		resp = do(t, http.MethodPut, "/presets/web-720p", `{"params":{"height":"720"},"request":{"codec":"libx265","filters":{"scale":"-2:{{height}}"}}}`)
+		var updated struct {
+			Version int `json:"version"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&updated)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated || updated.Version != 2 {
+			t.Fatalf("Expected a second version; got %v %+v", resp.Status, updated)
+		}
+
+		resp = do(t, http.MethodPost, "/process", `{"preset":"web-720p@v1","preset_params":{"height":"480"},"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"video.mp4"}}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK; got %v", resp.Status)
+		}
+		e, ok := queue.TryPop()
+		if !ok {
+			t.Fatal("Expected an event to be emitted")
+		}
+		if e.EditorRequest.Preset != "web-720p@v1" || e.EditorRequest.Codec != "libx264" || e.EditorRequest.Filters["scale"] != "-2:480" {
+			t.Errorf("Expected the first version of the preset to be applied; got %+v", e.EditorRequest)
+		}
+
+		resp = do(t, http.MethodGet, "/presets/web-720p", "")
+		var latest struct {
+			Version int `json:"version"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&latest)
+		resp.Body.Close()
+		if latest.Version != 2 {
+			t.Errorf("Expected the latest version; got %d", latest.Version)
+		}
+	})
+
+	t.Run("Given an unknown preset or param, it should reject the job", func(t *testing.T) {
+		for _, body := range []string{
+			`{"preset":"unknown","input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"video.mp4"}}`,
+			`{"preset":"web-720p","preset_params":{"width":"1"},"input":{"file_url":"https://example.com/video.mp4"},"output":{"file_pattern":"video.mp4"}}`,
+		} {
+			resp := do(t, http.MethodPost, "/process", body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status Bad Request for %s; got %v", body, resp.Status)
+			}
+		}
+	})
+
+	t.Run("Given a deleted preset, it should not be found anymore", func(t *testing.T) {
+		resp := do(t, http.MethodDelete, "/presets/web-720p", "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("Expected status No Content; got %v", resp.Status)
+		}
+		resp = do(t, http.MethodGet, "/presets/web-720p@v1", "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status Not Found; got %v", resp.Status)
+		}
+	})
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
+	"github.com/douglasdgoulart/video-editor-api/pkg/batch"
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/douglasdgoulart/video-editor-api/pkg/tenant"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const defaultMaxBatchSize = 100
+
+type BatchHandler struct {
+	logger       *slog.Logger
+	process      *ProcessHandler
+	store        state.Store
+	batches      *batch.Store
+	maxBatchSize int
+}
+
+// NewBatchHandler shares the emitter, stores and quotas of the process
+// handler, batches being submitted the same way as single jobs.
+func NewBatchHandler(cfg *configuration.Configuration, process *ProcessHandler) *BatchHandler {
+	maxBatchSize := cfg.Api.MaxBatchSize
+	if maxBatchSize <= 0 {
+		maxBatchSize = defaultMaxBatchSize
+	}
+
+	return &BatchHandler{
+		logger:       cfg.Logger.WithGroup("batch_handler"),
+		process:      process,
+		store:        process.store,
+		batches:      batch.NewStore(cfg.StatePath),
+		maxBatchSize: maxBatchSize,
+	}
+}
+
+// Create submits every request of a batch as a child job. The batch is read
+// like a single request, the batch being the "batch" field of multipart
+// bodies, and its input is used by the requests that have none.
+func (bh *BatchHandler) Create(c echo.Context) error {
+	ph := bh.process
+	tenantName, err := tenant.FromPrincipal(auth.FromContext(c.Request().Context()))
+	if err != nil {
+		return ph.respondWithError(c, http.StatusForbidden, "invalid tenant", err)
+	}
+
+	var batchRequest request.BatchRequest
+	file, err := ph.readBody(c, "batch", &batchRequest)
+	if err != nil {
+		return ph.respondWithInputError(c, err)
+	}
+
+	requests, err := bh.resolveRequests(c, tenantName, &batchRequest, file)
+	if err != nil {
+		file.remove()
+		return ph.respondWithInputError(c, err)
+	}
+
+	// Checked once the size of the batch is known, unlike single requests.
+	err = ph.quotas.CheckBatchSubmission(c.Request().Context(), tenantName, len(requests))
+	if err != nil {
+		file.remove()
+		return ph.respondWithQuotaError(c, err)
+	}
+
+	b, err := bh.submit(c, tenantName, batchRequest.WebhookURL, requests)
+	if err != nil {
+		return ph.respondWithError(c, http.StatusInternalServerError, "internal server error", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"message": "processing batch", "id": b.Id, "job_ids": b.JobIds})
+}
+
+// resolveRequests resolves the presets of the requests of the batch,
+// validates them and fills their inputs.
+func (bh *BatchHandler) resolveRequests(c echo.Context, tenantName string, batchRequest *request.BatchRequest, file *storedFile) ([]request.EditorRequest, error) {
+	if len(batchRequest.Requests) == 0 || len(batchRequest.Requests) > bh.maxBatchSize {
+		return nil, fmt.Errorf("%w: a batch holds between 1 and %d requests", errInvalidRequest, bh.maxBatchSize)
+	}
+
+	shared := request.EditorRequest{Input: batchRequest.Input}
+	shared.Input.UploadedFilePath = ""
+	shared.Input.SHA256 = ""
+	shared.Input.Container = ""
+	hasShared := file != nil || shared.Input.UploadId != "" || shared.Input.FileURL != ""
+	if hasShared {
+		if err := bh.process.resolveInput(c, &shared.Input, file); err != nil {
+			return nil, err
+		}
+	}
+
+	requests := make([]request.EditorRequest, len(batchRequest.Requests))
+	for i, r := range batchRequest.Requests {
+		err := bh.process.resolvePresets(tenantName, &r)
+		if err == nil {
+			err = validateRequest(&r)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: requests[%d]: %w", errInvalidRequest, i, err)
+		}
+
+		if hasShared && r.Input.UploadId == "" && r.Input.FileURL == "" && len(r.Inputs) == 0 {
+			r.Input = shared.Input
+			err = bh.process.resolveOperationInputs(c, &r)
+			if err == nil {
+				_, err = bh.process.resolveStepInputs(c, &r)
+			}
+		} else {
+			err = bh.process.resolveInputs(c, &r, nil)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("requests[%d]: %w", i, err)
+		}
+		requests[i] = r
+	}
+
+	return requests, nil
+}
+
+// submit saves the jobs and the batch before queueing any job, so workers
+// finishing the first jobs always find the whole batch. Jobs saved before
+// the batch could not be are failed, and the batch is completed here when
+// jobs could not be queued, as no worker may ever finish one of its jobs.
+func (bh *BatchHandler) submit(c echo.Context, tenantName string, webhookURL string, requests []request.EditorRequest) (*batch.Batch, error) {
+	ctx := c.Request().Context()
+	b := &batch.Batch{
+		Id:         uuid.New().String(),
+		Owner:      auth.FromContext(ctx).Owner(),
+		Tenant:     tenantName,
+		WebhookURL: webhookURL,
+	}
+
+	events := make([]event.Event, len(requests))
+	for i, r := range requests {
+		events[i] = newEvent(c, tenantName, r)
+		events[i].BatchId = b.Id
+		if err := bh.process.saveJob(ctx, events[i]); err != nil {
+			bh.failJobs(ctx, b.JobIds)
+			return nil, err
+		}
+		b.JobIds = append(b.JobIds, events[i].Id)
+	}
+
+	if err := bh.batches.Save(b); err != nil {
+		bh.logger.Error("Failed to save batch", "error", err)
+		bh.failJobs(ctx, b.JobIds)
+		return nil, err
+	}
+
+	// Jobs that can not be queued are failed, which the batch reports.
+	queueFailed := false
+	for _, e := range events {
+		if err := bh.process.queueJob(ctx, e); err != nil {
+			queueFailed = true
+		}
+	}
+	if queueFailed {
+		summary, err := bh.batches.Complete(context.WithoutCancel(ctx), bh.store, b.Id)
+		if err != nil {
+			bh.logger.Error("Failed to complete batch", "error", err, "batch_id", b.Id)
+		} else if summary != nil {
+			bh.logger.Info("batch done", "batch_id", b.Id, "status", summary.Status)
+		}
+	}
+
+	return b, nil
+}
+
+// failJobs fails the jobs ids of a batch that could not be submitted.
+func (bh *BatchHandler) failJobs(ctx context.Context, ids []string) {
+	for _, id := range ids {
+		_, err := bh.store.Update(context.WithoutCancel(ctx), id, func(job *state.JobState) error {
+			job.Status = state.StatusError
+			job.ErrorMsg = "failed to submit batch"
+			return nil
+		})
+		if err != nil {
+			bh.logger.Error("Failed to fail job of batch", "error", err, "job_id", id)
+		}
+	}
+}
+
+// Get returns the aggregate status and progress of a batch, along with the
+// state of each of its jobs.
+func (bh *BatchHandler) Get(c echo.Context) error {
+	b, err := bh.batches.Get(c.Param("id"))
+	if err == nil && !auth.FromContext(c.Request().Context()).CanAccess(b.Owner) {
+		err = batch.ErrNotFound
+	}
+	if errors.Is(err, batch.ErrNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "batch not found"})
+	}
+	if err != nil {
+		return bh.process.respondWithError(c, http.StatusInternalServerError, "internal server error", err)
+	}
+
+	summary, err := batch.Summarize(c.Request().Context(), bh.store, b)
+	if err != nil {
+		return bh.process.respondWithError(c, http.StatusInternalServerError, "internal server error", err)
+	}
+
+	return c.JSON(http.StatusOK, summary)
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/batch"
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingEmitter struct{}
+
+func (failingEmitter) Send(ctx context.Context, e event.Event) error {
+	return errors.New("broker unavailable")
+}
+
+// saveLimitStore fails the saves of jobs once saves of them succeeded.
+type saveLimitStore struct {
+	state.Store
+	saves int
+}
+
+func (s *saveLimitStore) Save(ctx context.Context, job *state.JobState) error {
+	if s.saves == 0 {
+		return errors.New("disk full")
+	}
+	s.saves--
+	return s.Store.Save(ctx, job)
+}
+
+func TestBatchHandler_submit(t *testing.T) {
+	requests := []request.EditorRequest{
+		{Input: request.Input{FileURL: "https://example.com/first.mp4"}},
+		{Input: request.Input{FileURL: "https://example.com/second.mp4"}},
+	}
+
+	newBatchHandler := func(t *testing.T) (*BatchHandler, echo.Context) {
+		cfg := &configuration.Configuration{
+			Logger:        slog.Default(),
+			StatePath:     t.TempDir(),
+			InternalQueue: event.NewQueue(nil),
+		}
+		bh := NewBatchHandler(cfg, NewProcessHandler(cfg))
+		req := httptest.NewRequest(http.MethodPost, "/batches", nil)
+		return bh, echo.New().NewContext(req, httptest.NewRecorder())
+	}
+
+	t.Run("Given jobs that can not be queued, it should complete the batch", func(t *testing.T) {
+		summaries := make(chan batch.Summary, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var summary batch.Summary
+			_ = json.NewDecoder(r.Body).Decode(&summary)
+			summaries <- summary
+		}))
+		defer server.Close()
+
+		bh, c := newBatchHandler(t)
+		bh.process.emitter = failingEmitter{}
+
+		b, err := bh.submit(c, "default", server.URL, requests)
+		assert.NoError(t, err)
+
+		select {
+		case summary := <-summaries:
+			assert.Equal(t, b.Id, summary.Id)
+			assert.Equal(t, state.StatusError, summary.Status)
+		default:
+			t.Error("Expected the webhook of the batch to be called")
+		}
+	})
+
+	t.Run("Given a job that can not be saved, it should fail the jobs saved before it", func(t *testing.T) {
+		bh, c := newBatchHandler(t)
+		store := &saveLimitStore{Store: bh.store, saves: 1}
+		bh.process.store = store
+
+		_, err := bh.submit(c, "default", "", requests)
+		assert.Error(t, err)
+
+		jobs, err := bh.store.List(context.Background(), state.Filter{})
+		assert.NoError(t, err)
+		if assert.Len(t, jobs, 1) {
+			assert.Equal(t, state.StatusError, jobs[0].Status)
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	eventPollInterval = 500 * time.Millisecond
+	eventKeepAlive    = 15 * time.Second
+	maxWatchedJobs    = 100
+)
+
+const (
+	jobEventState    = "state"
+	jobEventProgress = "progress"
+	jobEventEnd      = "end"
+)
+
+var errInvalidJobIds = errors.New("invalid job ids")
+
+// JobEvent is sent to clients watching jobs when their status or progress
+// changes.
+type JobEvent struct {
+	Id            string               `json:"id"`
+	Status        state.Status         `json:"status"`
+	Progress      float64              `json:"progress"`
+	FileLocations []string             `json:"file_locations,omitempty"`
+	Loudness      *media.LoudnessStats `json:"loudness,omitempty"`
+	Scenes        []media.Scene        `json:"scenes,omitempty"`
+	ErrorCode     string               `json:"error_code,omitempty"`
+	ErrorMsg      string               `json:"error_msg,omitempty"`
+	Steps         []state.StepState    `json:"steps,omitempty"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+}
+
+type webSocketMessage struct {
+	Type string    `json:"type"`
+	Job  *JobEvent `json:"job,omitempty"`
+}
+
+func newJobEvent(job *state.JobState) JobEvent {
+	return JobEvent{
+		Id:            job.Id,
+		Status:        job.Status,
+		Progress:      job.Progress,
+		FileLocations: job.FileLocations,
+		Loudness:      job.Loudness,
+		Scenes:        job.Scenes,
+		ErrorCode:     job.ErrorCode,
+		ErrorMsg:      job.ErrorMsg,
+		Steps:         job.Steps,
+		UpdatedAt:     job.UpdatedAt,
+	}
+}
+
+// Events streams the state transitions and progress of the job in the path,
+// or of the comma separated jobs of the "ids" query parameter, until they
+// are all done. Events are sent as server-sent events, or as JSON messages
+// when the request asks for a WebSocket. They are read from the job state
+// store, so they can be streamed by any replica of the api.
+func (jh *JobsHandler) Events(c echo.Context) error {
+	ids, err := jh.watchedJobIds(c)
+	if errors.Is(err, errInvalidJobIds) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return jh.respondWithStoreError(c, err)
+	}
+
+	if c.IsWebSocket() {
+		websocket.Server{Handler: func(ws *websocket.Conn) {
+			jh.streamWebSocket(c.Request().Context(), ws, ids)
+		}}.ServeHTTP(c.Response(), c.Request())
+		return nil
+	}
+	return jh.streamServerSentEvents(c, ids)
+}
+
+func (jh *JobsHandler) watchedJobIds(c echo.Context) ([]string, error) {
+	ids := []string{c.Param("id")}
+	if ids[0] == "" {
+		ids = ids[:0]
+		for _, id := range strings.Split(c.QueryParam("ids"), ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 || len(ids) > maxWatchedJobs {
+			return nil, fmt.Errorf("%w: between 1 and %d jobs can be watched", errInvalidJobIds, maxWatchedJobs)
+		}
+	}
+
+	principal := auth.FromContext(c.Request().Context())
+	for _, id := range ids {
+		job, err := jh.store.Get(c.Request().Context(), id)
+		if err != nil {
+			return nil, err
+		}
+		if !principal.CanAccess(job.Owner) {
+			return nil, state.ErrNotFound
+		}
+	}
+
+	return ids, nil
+}
+
+func (jh *JobsHandler) streamServerSentEvents(c echo.Context, ids []string) error {
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "text/event-stream")
+	header.Set(echo.HeaderCacheControl, "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	c.Response().WriteHeader(http.StatusOK)
+	c.Response().Flush()
+
+	sequence := 0
+	send := func(kind string, event *JobEvent) error {
+		data := []byte("{}")
+		if event != nil {
+			var err error
+			if data, err = json.Marshal(event); err != nil {
+				return err
+			}
+		}
+		sequence++
+		_, err := fmt.Fprintf(c.Response(), "id: %d\nevent: %s\ndata: %s\n\n", sequence, kind, data)
+		c.Response().Flush()
+		return err
+	}
+	keepAlive := func() error {
+		_, err := fmt.Fprint(c.Response(), ": keep-alive\n\n")
+		c.Response().Flush()
+		return err
+	}
+
+	ctx := c.Request().Context()
+	err := jh.watchJobs(ctx, ids, send, keepAlive)
+	if err == nil {
+		// Tells clients not to reconnect, as EventSource does once a stream ends.
+		err = send(jobEventEnd, nil)
+	}
+	if err != nil && ctx.Err() == nil {
+		jh.logger.Error("Failed to stream job events", "error", err)
+	}
+	return nil
+}
+
+func (jh *JobsHandler) streamWebSocket(ctx context.Context, ws *websocket.Conn, ids []string) {
+	defer ws.Close()
+
+	// Clients are not expected to send anything, reading only tells when
+	// they go away.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+		cancel()
+	}()
+
+	send := func(kind string, event *JobEvent) error {
+		return websocket.JSON.Send(ws, webSocketMessage{Type: kind, Job: event})
+	}
+
+	err := jh.watchJobs(ctx, ids, send, nil)
+	if err == nil {
+		err = send(jobEventEnd, nil)
+	}
+	if err != nil && ctx.Err() == nil {
+		jh.logger.Error("Failed to stream job events", "error", err)
+	}
+}
+
+// watchJobs polls the states of the jobs ids and sends their changes, until
+// they are all done or ctx is done. keepAlive, when not nil, is called when
+// nothing was sent for a while.
+func (jh *JobsHandler) watchJobs(ctx context.Context, ids []string, send func(kind string, event *JobEvent) error, keepAlive func() error) error {
+	last := make(map[string]JobEvent, len(ids))
+	lastSent := time.Now()
+
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+	for {
+		done := true
+		for _, id := range ids {
+			job, err := jh.store.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			if !job.Done() {
+				done = false
+			}
+
+			event := newJobEvent(job)
+			previous, seen := last[id]
+			last[id] = event
+
+			kind := ""
+			switch {
+			case !seen || previous.Status != event.Status:
+				kind = jobEventState
+			case previous.Progress != event.Progress || !reflect.DeepEqual(previous.Steps, event.Steps):
+				kind = jobEventProgress
+			default:
+				continue
+			}
+			if err := send(kind, &event); err != nil {
+				return err
+			}
+			lastSent = time.Now()
+		}
+		if done {
+			return nil
+		}
+
+		if keepAlive != nil && time.Since(lastSent) >= eventKeepAlive {
+			if err := keepAlive(); err != nil {
+				return err
+			}
+			lastSent = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/google/uuid"
+)
+
+var errFileTooLarge = errors.New("file exceeds the maximum upload size")
+
+// storedFile is an input file written by the api to the input path.
+type storedFile struct {
+	Path      string
+	SHA256    string
+	Container string
+}
+
+func (f *storedFile) remove() {
+	if f != nil {
+		_ = os.Remove(f.Path)
+	}
+}
+
+// inputWriter streams uploaded files to the input path, enforcing the
+// maximum upload size and checking that the content is actually media.
+type inputWriter struct {
+	inputPath string
+	maxSize   int64
+	prober    *media.Prober
+}
+
+func (w *inputWriter) write(ctx context.Context, src io.Reader) (*storedFile, error) {
+	id := uuid.New().String()
+	dst, err := os.Create(filepath.Join(w.inputPath, fmt.Sprintf("%s.part", id)))
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	if w.maxSize > 0 {
+		src = io.LimitReader(src, w.maxSize+1)
+	}
+
+	analyzer := media.NewAnalyzer()
+	written, err := io.Copy(io.MultiWriter(dst, analyzer), src)
+	if err == nil && w.maxSize > 0 && written > w.maxSize {
+		err = errFileTooLarge
+	}
+	if err != nil {
+		_ = os.Remove(dst.Name())
+		return nil, err
+	}
+
+	container, err := media.Detect(ctx, w.prober, dst.Name(), analyzer.Container())
+	if err != nil {
+		_ = os.Remove(dst.Name())
+		return nil, err
+	}
+
+	path := filepath.Join(w.inputPath, fmt.Sprintf("%s.%s", id, container))
+	if err := os.Rename(dst.Name(), path); err != nil {
+		_ = os.Remove(dst.Name())
+		return nil, err
+	}
+
+	return &storedFile{
+		Path:      path,
+		SHA256:    analyzer.Checksum(),
+		Container: container,
+	}, nil
+}
+
+// inspect computes the checksum and container of a file that is already in
+// the input path, such as a finished resumable upload.
+func (w *inputWriter) inspect(ctx context.Context, path string) (*storedFile, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	analyzer := media.NewAnalyzer()
+	if _, err := io.Copy(analyzer, src); err != nil {
+		return nil, err
+	}
+
+	container, err := media.Detect(ctx, w.prober, path, analyzer.Container())
+	if err != nil {
+		return nil, err
+	}
+
+	return &storedFile{
+		Path:      path,
+		SHA256:    analyzer.Checksum(),
+		Container: container,
+	}, nil
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/joblog"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+	logPollInterval  = 500 * time.Millisecond
+)
+
+var errJobFinished = errors.New("job already finished")
+
+type JobsHandler struct {
+	logger *slog.Logger
+	store  state.Store
+	logDir string
+}
+
+func NewJobsHandler(cfg *configuration.Configuration) *JobsHandler {
+	return &JobsHandler{
+		logger: cfg.Logger.WithGroup("jobs_handler"),
+		store:  state.NewFileStore(cfg.StatePath),
+		logDir: joblog.Dir(cfg.StatePath),
+	}
+}
+
+func (jh *JobsHandler) List(c echo.Context) error {
+	limit := defaultListLimit
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+		}
+		limit = min(parsed, maxListLimit)
+	}
+
+	filter := state.Filter{
+		Status: state.Status(c.QueryParam("status")),
+		Limit:  limit,
+	}
+	if principal := auth.FromContext(c.Request().Context()); principal != nil && !principal.IsAdmin() {
+		filter.Owner = principal.Id
+	}
+
+	jobs, err := jh.store.List(c.Request().Context(), filter)
+	if err != nil {
+		jh.logger.Error("Failed to list jobs", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	if jobs == nil {
+		jobs = []*state.JobState{}
+	}
+
+	return c.JSON(http.StatusOK, jobs)
+}
+
+func (jh *JobsHandler) Get(c echo.Context) error {
+	job, err := jh.getOwnedJob(c)
+	if err != nil {
+		return jh.respondWithStoreError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, job)
+}
+
+// Cancel cancels a queued job right away. Running jobs are flagged and
+// stopped by the worker handling them.
+func (jh *JobsHandler) Cancel(c echo.Context) error {
+	if _, err := jh.getOwnedJob(c); err != nil {
+		return jh.respondWithStoreError(c, err)
+	}
+
+	job, err := jh.store.Update(c.Request().Context(), c.Param("id"), func(job *state.JobState) error {
+		switch {
+		case job.Done():
+			return errJobFinished
+		case job.Status == state.StatusQueued:
+			job.Status = state.StatusCancelled
+		default:
+			job.CancelRequested = true
+		}
+		return nil
+	})
+	if err != nil {
+		return jh.respondWithStoreError(c, err)
+	}
+
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// Logs returns the ffmpeg log of a job, or of the pipeline step of the "step"
+// query parameter, which pipeline jobs require. The log of a job that did not
+// finish yet is streamed as it is written.
+func (jh *JobsHandler) Logs(c echo.Context) error {
+	job, err := jh.getOwnedJob(c)
+	if err != nil {
+		return jh.respondWithStoreError(c, err)
+	}
+
+	step := c.QueryParam("step")
+	if step == "" && len(job.Request.Steps) > 0 {
+		// Pipelines only have a log per step.
+		steps := make([]string, len(job.Request.Steps))
+		for i, s := range job.Request.Steps {
+			steps[i] = s.Id
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("pipeline jobs have a log per step, pass one of %s as the step parameter", strings.Join(steps, ", ")),
+		})
+	}
+	if step != "" && !slices.ContainsFunc(job.Request.Steps, func(s request.Step) bool { return s.Id == step }) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "step not found"})
+	}
+
+	path := joblog.Path(jh.logDir, joblog.Name(job.Id, step))
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+	if job.Done() {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "log not found"})
+		}
+		return c.File(path)
+	}
+
+	ctx := c.Request().Context()
+	done := func() bool {
+		job, err := jh.store.Get(ctx, job.Id)
+		return err != nil || job.Done()
+	}
+
+	c.Response().WriteHeader(http.StatusOK)
+	err = joblog.Follow(ctx, path, c.Response(), c.Response().Flush, done, logPollInterval)
+	if err != nil && ctx.Err() == nil {
+		jh.logger.Error("Failed to stream job log", "error", err, "job_id", job.Id)
+	}
+	return nil
+}
+
+func (jh *JobsHandler) getOwnedJob(c echo.Context) (*state.JobState, error) {
+	job, err := jh.store.Get(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if !auth.FromContext(c.Request().Context()).CanAccess(job.Owner) {
+		return nil, state.ErrNotFound
+	}
+
+	return job, nil
+}
+
+func (jh *JobsHandler) respondWithStoreError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, state.ErrNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "job not found"})
+	case errors.Is(err, errJobFinished):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+
+	jh.logger.Error("Failed to handle job", "error", err)
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
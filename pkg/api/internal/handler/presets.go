@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/preset"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/tenant"
+	"github.com/labstack/echo/v4"
+)
+
+type PresetsHandler struct {
+	logger  *slog.Logger
+	presets *preset.Store
+}
+
+func NewPresetsHandler(cfg *configuration.Configuration) *PresetsHandler {
+	return &PresetsHandler{
+		logger:  cfg.Logger.WithGroup("presets_handler"),
+		presets: preset.NewStore(cfg.StatePath),
+	}
+}
+
+type presetRequest struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Params      map[string]string     `json:"params,omitempty"`
+	Request     request.EditorRequest `json:"request"`
+}
+
+// Create saves the first version of a new preset of the tenant of the caller.
+func (ph *PresetsHandler) Create(c echo.Context) error {
+	return ph.save(c, "", ph.presets.Create)
+}
+
+// Update saves a new version of the preset in the path, leaving the previous
+// versions as they were.
+func (ph *PresetsHandler) Update(c echo.Context) error {
+	return ph.save(c, c.Param("name"), ph.presets.Update)
+}
+
+func (ph *PresetsHandler) save(c echo.Context, name string, save func(tenant string, p *preset.Preset) error) error {
+	tenantName, err := tenant.FromPrincipal(auth.FromContext(c.Request().Context()))
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "invalid tenant"})
+	}
+
+	var body presetRequest
+	if err := json.NewDecoder(io.LimitReader(c.Request().Body, maxEventSize)).Decode(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if name == "" {
+		name = body.Name
+	}
+
+	p := &preset.Preset{
+		Name:        name,
+		Description: body.Description,
+		Params:      body.Params,
+		Request:     body.Request,
+		Owner:       auth.FromContext(c.Request().Context()).Owner(),
+	}
+	if err := p.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := save(tenantName, p); err != nil {
+		return ph.respondWithStoreError(c, err)
+	}
+	return c.JSON(http.StatusCreated, p)
+}
+
+// List returns the latest version of every preset of the tenant of the caller.
+func (ph *PresetsHandler) List(c echo.Context) error {
+	tenantName, err := tenant.FromPrincipal(auth.FromContext(c.Request().Context()))
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "invalid tenant"})
+	}
+
+	presets, err := ph.presets.List(tenantName)
+	if err != nil {
+		return ph.respondWithStoreError(c, err)
+	}
+	if presets == nil {
+		presets = []*preset.Preset{}
+	}
+	return c.JSON(http.StatusOK, presets)
+}
+
+// Get returns the preset version referenced in the path, such as
+// "web-720p@v3", or the latest version of a preset such as "web-720p".
+func (ph *PresetsHandler) Get(c echo.Context) error {
+	tenantName, err := tenant.FromPrincipal(auth.FromContext(c.Request().Context()))
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "invalid tenant"})
+	}
+
+	p, err := ph.presets.Resolve(tenantName, c.Param("name"))
+	if err != nil {
+		return ph.respondWithStoreError(c, err)
+	}
+	return c.JSON(http.StatusOK, p)
+}
+
+// Versions returns every version of the preset in the path, oldest first.
+func (ph *PresetsHandler) Versions(c echo.Context) error {
+	tenantName, err := tenant.FromPrincipal(auth.FromContext(c.Request().Context()))
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "invalid tenant"})
+	}
+
+	presets, err := ph.presets.Versions(tenantName, c.Param("name"))
+	if err != nil {
+		return ph.respondWithStoreError(c, err)
+	}
+	return c.JSON(http.StatusOK, presets)
+}
+
+// Delete removes every version of the preset in the path.
+func (ph *PresetsHandler) Delete(c echo.Context) error {
+	tenantName, err := tenant.FromPrincipal(auth.FromContext(c.Request().Context()))
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "invalid tenant"})
+	}
+
+	if err := ph.presets.Delete(tenantName, c.Param("name")); err != nil {
+		return ph.respondWithStoreError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ph *PresetsHandler) respondWithStoreError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, preset.ErrNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "preset not found"})
+	case errors.Is(err, preset.ErrExists):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, preset.ErrInvalidRef):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	ph.logger.Error("Failed to handle preset", "error", err)
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
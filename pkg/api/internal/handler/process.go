@@ -1,28 +1,45 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
-	"mime/multipart"
+	"math"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
 	"strings"
 
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
 	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
 	"github.com/douglasdgoulart/video-editor-api/pkg/event"
 	"github.com/douglasdgoulart/video-editor-api/pkg/event/emitter"
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/preset"
 	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/douglasdgoulart/video-editor-api/pkg/tenant"
+	"github.com/douglasdgoulart/video-editor-api/pkg/upload"
 	"github.com/douglasdgoulart/video-editor-api/pkg/validator"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
+const maxEventSize = 1 << 20
+
+var errInvalidRequest = errors.New("invalid request")
+
 type ProcessHandler struct {
-	logger    *slog.Logger
-	emitter   emitter.EventEmitter
-	inputPath string
+	logger  *slog.Logger
+	emitter emitter.EventEmitter
+	store   state.Store
+	uploads *upload.Store
+	presets *preset.Store
+	inputs  *inputWriter
+	quotas  *tenant.Quotas
 }
 
 func NewProcessHandler(cfg *configuration.Configuration) *ProcessHandler {
@@ -33,26 +50,48 @@ func NewProcessHandler(cfg *configuration.Configuration) *ProcessHandler {
 		eventEmitter = emitter.NewInternalQueueEmitter(cfg)
 	}
 
+	store := state.NewFileStore(cfg.StatePath)
 	return &ProcessHandler{
-		logger:    cfg.Logger.WithGroup("process_handler"),
-		emitter:   eventEmitter,
-		inputPath: cfg.InputPath,
+		logger:  cfg.Logger.WithGroup("process_handler"),
+		emitter: eventEmitter,
+		store:   store,
+		quotas:  tenant.NewQuotas(cfg, store),
+		uploads: upload.NewStore(cfg.InputPath),
+		presets: preset.NewStore(cfg.StatePath),
+		inputs: &inputWriter{
+			inputPath: cfg.InputPath,
+			maxSize:   cfg.Api.MaxUploadSize,
+			prober:    media.NewProber(cfg.Ffmpeg.ProbePath),
+		},
 	}
 }
 
+var errNoInput = errors.New("no input provided, expected a file, an upload id or a file url")
+
 func (ph *ProcessHandler) Handler(c echo.Context) error {
-	request, err := ph.parseRequest(c)
+	// Quotas are checked before reading the body, so a tenant over its limits
+	// does not get to store its input first.
+	tenantName, err := tenant.FromPrincipal(auth.FromContext(c.Request().Context()))
 	if err != nil {
-		return ph.respondWithError(c, http.StatusBadRequest, "invalid request", err)
+		return ph.respondWithError(c, http.StatusForbidden, "invalid tenant", err)
+	}
+	err = ph.quotas.CheckSubmission(c.Request().Context(), tenantName)
+	if err != nil {
+		return ph.respondWithQuotaError(c, err)
 	}
 
-	fileLocation, err := ph.handleFileUpload(c)
+	request, file, err := ph.readRequest(c, tenantName)
 	if err != nil {
-		return ph.respondWithError(c, http.StatusInternalServerError, "internal server error", err)
+		return ph.respondWithInputError(c, err)
 	}
-	request.Input.UploadedFilePath = fileLocation
 
-	eventId, err := ph.processEvent(c, request)
+	err = ph.resolveInputs(c, &request, file)
+	if err != nil {
+		file.remove()
+		return ph.respondWithInputError(c, err)
+	}
+
+	eventId, err := ph.processEvent(c, tenantName, request)
 	if err != nil {
 		return ph.respondWithError(c, http.StatusInternalServerError, "internal server error", err)
 	}
@@ -60,72 +99,412 @@ func (ph *ProcessHandler) Handler(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"message": "processing request", "id": eventId})
 }
 
-func (ph *ProcessHandler) parseRequest(c echo.Context) (request.EditorRequest, error) {
+// readRequest reads the EditorRequest either from an application/json body or
+// from a multipart body, where the request is the "event" field and the
+// optional input is the "file" field, streamed to the input path.
+func (ph *ProcessHandler) readRequest(c echo.Context, tenantName string) (request.EditorRequest, *storedFile, error) {
 	var request request.EditorRequest
-	eventJson := c.FormValue("event")
-	err := json.Unmarshal([]byte(eventJson), &request)
+	file, err := ph.readBody(c, "event", &request)
 	if err != nil {
-		ph.logger.Error("Failed to decode request", "error", err)
-		return request, err
+		return request, nil, err
 	}
 
-	err = validator.ValidateRequiredFields(request)
+	err = ph.resolvePresets(tenantName, &request)
+	if err == nil {
+		err = validateRequest(&request)
+	}
 	if err != nil {
-		ph.logger.Error("Failed to validate request", "error", err)
-		return request, err
+		file.remove()
+		return request, nil, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+
+	return request, file, nil
+}
+
+// readBody decodes an application/json body into v, or the field of a
+// multipart body along with its optional "file".
+func (ph *ProcessHandler) readBody(c echo.Context, field string, v any) (*storedFile, error) {
+	var file *storedFile
+	var err error
+	if isJSONRequest(c) {
+		err = json.NewDecoder(io.LimitReader(c.Request().Body, maxEventSize)).Decode(v)
+		if err != nil {
+			err = fmt.Errorf("%w: %w", errInvalidRequest, err)
+		}
+	} else {
+		var data []byte
+		data, file, err = ph.readMultipart(c, field)
+		if err == nil {
+			err = json.Unmarshal(data, v)
+			if err != nil {
+				err = fmt.Errorf("%w: %w", errInvalidRequest, err)
+			}
+		}
+	}
+	if err != nil {
+		file.remove()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// resolvePresets replaces the request, and each of its steps, referencing a
+// preset of tenantName by the template of the preset overridden by their own
+// fields, so that queued events do not depend on presets.
+func (ph *ProcessHandler) resolvePresets(tenantName string, req *request.EditorRequest) error {
+	resolve := func(req *request.EditorRequest) error {
+		if req.Preset == "" {
+			return nil
+		}
+		p, err := ph.presets.Resolve(tenantName, req.Preset)
+		if err != nil {
+			return err
+		}
+		*req, err = p.Apply(*req)
+		return err
+	}
+
+	if err := resolve(req); err != nil {
+		return err
+	}
+	for i := range req.Steps {
+		if err := resolve(&req.Steps[i].EditorRequest); err != nil {
+			return fmt.Errorf("steps[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateRequest(request *request.EditorRequest) error {
+	// The uploaded file path and its details are only ever set by the api itself.
+	clearResolvedInputs(request)
+	for i := range request.Steps {
+		clearResolvedInputs(&request.Steps[i].EditorRequest)
 	}
 
-	return request, nil
+	// The outputs of pipelines are those of their steps.
+	var err error
+	if len(request.Steps) > 0 {
+		err = validator.ValidateSteps(request.Steps)
+	} else {
+		err = validator.ValidateRequiredFields(*request)
+		if err == nil {
+			err = validator.ValidateOutput("output", request.Output)
+		}
+	}
+	if err == nil {
+		err = validator.ValidateInputs("", *request)
+	}
+	if err == nil {
+		err = validator.ValidateOverlay("", *request)
+	}
+	if err == nil {
+		err = validator.ValidateCaptions("", *request)
+	}
+	if err == nil {
+		err = validator.ValidateAudio("", *request)
+	}
+	if err == nil {
+		err = validator.ValidateLoudness("", *request)
+	}
+	if err == nil {
+		err = validator.ValidateRateControl("", *request)
+	}
+	if err == nil {
+		err = validator.ValidateTrim("", *request)
+	}
+	if err == nil {
+		err = event.ValidatePriority(request.Priority)
+	}
+	if err == nil {
+		err = validator.ValidateDuration("timeout", request.Timeout)
+	}
+	return err
 }
 
-func (ph *ProcessHandler) handleFileUpload(c echo.Context) (string, error) {
-	file, err := c.FormFile("file")
+func (ph *ProcessHandler) readMultipart(c echo.Context, field string) ([]byte, *storedFile, error) {
+	if ph.inputs.maxSize > 0 {
+		c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, ph.inputs.maxSize+maxEventSize)
+	}
+
+	reader, err := c.Request().MultipartReader()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+
+	var data []byte
+	var file *storedFile
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.remove()
+			return nil, nil, err
+		}
+
+		switch part.FormName() {
+		case field:
+			data, err = io.ReadAll(io.LimitReader(part, maxEventSize))
+		case "file":
+			if file != nil {
+				err = fmt.Errorf("%w: only one file is supported", errInvalidRequest)
+				break
+			}
+			file, err = ph.inputs.write(c.Request().Context(), part)
+		}
+		part.Close()
+		if err != nil {
+			file.remove()
+			return nil, nil, err
+		}
+	}
+
+	return data, file, nil
+}
+
+func clearResolvedInputs(request *request.EditorRequest) {
+	clearResolvedInput(&request.Input)
+	for i := range request.Inputs {
+		clearResolvedInput(&request.Inputs[i])
+	}
+	if request.Overlay != nil {
+		clearResolvedInput(&request.Overlay.Input)
+	}
+	if request.Subtitles != nil {
+		clearResolvedInput(&request.Subtitles.Input)
+	}
+	if request.Audio != nil {
+		clearResolvedInput(&request.Audio.Input)
+	}
+}
+
+func clearResolvedInput(input *request.Input) {
+	input.UploadedFilePath = ""
+	input.SHA256 = ""
+	input.Container = ""
+}
+
+// resolveInputs fills the inputs of the request and those of its pipeline
+// steps. Pipelines only need an input of their own when one of their steps
+// takes it.
+func (ph *ProcessHandler) resolveInputs(c echo.Context, request *request.EditorRequest, file *storedFile) error {
+	if err := ph.resolveOperationInputs(c, request); err != nil {
+		return err
+	}
+	if len(request.Inputs) > 0 {
+		if file != nil {
+			return fmt.Errorf("%w: a file can not be combined with inputs", errInvalidRequest)
+		}
+		return ph.resolveInputList(c, request.Inputs)
+	}
+
+	needsInput, err := ph.resolveStepInputs(c, request)
+	if err != nil {
+		return err
+	}
+	if !needsInput && file == nil && request.Input.UploadId == "" && request.Input.FileURL == "" {
+		return nil
+	}
+	return ph.resolveInput(c, &request.Input, file)
+}
+
+// resolveStepInputs fills the inputs of the steps that have their own, and
+// reports whether the request needs an input, which is the case of requests
+// that are not pipelines and of pipelines with steps without an input.
+func (ph *ProcessHandler) resolveStepInputs(c echo.Context, request *request.EditorRequest) (bool, error) {
+	needsInput := len(request.Steps) == 0
+	for i := range request.Steps {
+		step := &request.Steps[i]
+		err := ph.resolveOperationInputs(c, &step.EditorRequest)
+		switch {
+		case err != nil:
+		case len(step.Inputs) > 0:
+			err = ph.resolveInputList(c, step.Inputs)
+		case step.Input.Step != "":
+		case step.Input.UploadId != "" || step.Input.FileURL != "":
+			err = ph.resolveInput(c, &step.Input, nil)
+		default:
+			needsInput = true
+		}
+		if err != nil {
+			return false, fmt.Errorf("steps[%d]: %w", i, err)
+		}
+	}
+	return needsInput, nil
+}
+
+// resolveOperationInputs fills the inputs of the overlay, the subtitles and
+// the audio of the request, if any.
+func (ph *ProcessHandler) resolveOperationInputs(c echo.Context, request *request.EditorRequest) error {
+	if request.Overlay != nil {
+		if err := ph.resolveInput(c, &request.Overlay.Input, nil); err != nil {
+			return fmt.Errorf("overlay: %w", err)
+		}
+	}
+	if request.Subtitles != nil {
+		if err := ph.resolveInput(c, &request.Subtitles.Input, nil); err != nil {
+			return fmt.Errorf("subtitles: %w", err)
+		}
+	}
+	// Extracting audio takes no other input.
+	if request.Audio != nil && (request.Audio.Input.FileURL != "" || request.Audio.Input.UploadId != "") {
+		if err := ph.resolveInput(c, &request.Audio.Input, nil); err != nil {
+			return fmt.Errorf("audio: %w", err)
+		}
+	}
+	return nil
+}
+
+// resolveInputList fills every input of a list but those taken from a
+// pipeline step.
+func (ph *ProcessHandler) resolveInputList(c echo.Context, inputs []request.Input) error {
+	for i := range inputs {
+		if inputs[i].Step != "" {
+			continue
+		}
+		if err := ph.resolveInput(c, &inputs[i], nil); err != nil {
+			return fmt.Errorf("inputs[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// resolveInput fills the input from, in order, a pre-uploaded file, the
+// multipart file or the file url.
+func (ph *ProcessHandler) resolveInput(c echo.Context, input *request.Input, file *storedFile) error {
+	if input.UploadId != "" {
+		u, err := ph.uploads.Resolve(input.UploadId)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errInvalidRequest, err)
+		}
+		if !auth.FromContext(c.Request().Context()).CanAccess(u.Owner) {
+			return fmt.Errorf("%w: %w", errInvalidRequest, upload.ErrNotFound)
+		}
+		input.UploadedFilePath = ph.uploads.FilePath(u.Id)
+		input.SHA256 = u.SHA256
+		input.Container = u.Container
+		return nil
+	}
+
+	if file != nil {
+		input.UploadedFilePath = file.Path
+		input.SHA256 = file.SHA256
+		input.Container = file.Container
+		return nil
+	}
+
+	if input.FileURL == "" {
+		return fmt.Errorf("%w: %w", errInvalidRequest, errNoInput)
+	}
+	if err := validateFileURL(input.FileURL); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+
+	return nil
+}
+
+func (ph *ProcessHandler) processEvent(c echo.Context, tenantName string, request request.EditorRequest) (string, error) {
+	ctx := c.Request().Context()
+	e := newEvent(c, tenantName, request)
+
+	err := ph.saveJob(ctx, e)
 	if err != nil {
-		ph.logger.Error("Failed to get file from request", "error", err)
 		return "", err
 	}
-	fileLocation, err := ph.downloadFile(file)
+
+	err = ph.queueJob(ctx, e)
 	if err != nil {
-		ph.logger.Error("Failed to download file", "error", err)
 		return "", err
 	}
 
-	return fileLocation, nil
+	return e.Id, nil
 }
 
-func (ph *ProcessHandler) processEvent(c echo.Context, request request.EditorRequest) (string, error) {
-	eventId := uuid.New().String()
-	err := ph.emitter.Send(c.Request().Context(), event.Event{
-		Id:            eventId,
+func newEvent(c echo.Context, tenantName string, request request.EditorRequest) event.Event {
+	return event.Event{
+		Id:            uuid.New().String(),
+		Owner:         auth.FromContext(c.Request().Context()).Owner(),
+		Tenant:        tenantName,
 		EditorRequest: request,
+	}
+}
+
+func (ph *ProcessHandler) saveJob(ctx context.Context, e event.Event) error {
+	err := ph.store.Save(ctx, &state.JobState{
+		Id:      e.Id,
+		Owner:   e.Owner,
+		Tenant:  e.Tenant,
+		BatchId: e.BatchId,
+		Status:  state.StatusQueued,
+		Request: e.EditorRequest,
 	})
+	if err != nil {
+		ph.logger.Error("Failed to save job state", "error", err)
+	}
+	return err
+}
+
+// queueJob sends the event of a saved job, failing the job when it can not.
+func (ph *ProcessHandler) queueJob(ctx context.Context, e event.Event) error {
+	err := ph.emitter.Send(ctx, e)
 	if err != nil {
 		ph.logger.Error("Failed to send event", "error", err)
-		return "", err
+		_, _ = ph.store.Update(ctx, e.Id, func(job *state.JobState) error {
+			job.Status = state.StatusError
+			job.ErrorMsg = "failed to queue job"
+			return nil
+		})
 	}
+	return err
+}
 
-	return eventId, nil
+func isJSONRequest(c echo.Context) bool {
+	return strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON)
 }
 
-func (ph *ProcessHandler) downloadFile(f *multipart.FileHeader) (string, error) {
-	src, err := f.Open()
+// validateFileURL only lets remote inputs through, so a request can not make
+// ffmpeg read arbitrary files from the worker.
+func validateFileURL(fileURL string) error {
+	u, err := url.Parse(fileURL)
 	if err != nil {
-		return "", err
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported file url scheme %q", u.Scheme)
 	}
-	defer src.Close()
+	return nil
+}
 
-	fileExtention := f.Filename[strings.LastIndex(f.Filename, ".")+1:]
-	dst, err := os.Create(fmt.Sprintf("%s/%s.%s", ph.inputPath, uuid.New().String(), fileExtention))
-	if err != nil {
-		return "", err
+func (ph *ProcessHandler) respondWithInputError(c echo.Context, err error) error {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, errFileTooLarge), errors.As(err, &maxBytesErr):
+		return ph.respondWithError(c, http.StatusRequestEntityTooLarge, "file too large", err)
+	case errors.Is(err, media.ErrUnsupportedMedia):
+		return ph.respondWithError(c, http.StatusUnsupportedMediaType, "unsupported media type", err)
+	case errors.Is(err, errInvalidRequest):
+		return ph.respondWithError(c, http.StatusBadRequest, "invalid request", err)
 	}
-	defer dst.Close()
 
-	if _, err = io.Copy(dst, src); err != nil {
-		return "", err
+	return ph.respondWithError(c, http.StatusInternalServerError, "internal server error", err)
+}
+
+// respondWithQuotaError answers 429 with the exceeded limit, and when it is
+// known, how long to wait before the tenant may submit again.
+func (ph *ProcessHandler) respondWithQuotaError(c echo.Context, err error) error {
+	var quotaErr *tenant.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return ph.respondWithError(c, http.StatusInternalServerError, "internal server error", err)
 	}
 
-	return dst.Name(), nil
+	ph.logger.Info("tenant quota exceeded", "reason", quotaErr.Reason)
+	if quotaErr.RetryAfter > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(quotaErr.RetryAfter.Seconds()))))
+	}
+	return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "tenant quota exceeded", "reason": quotaErr.Reason})
 }
 
 func (ph *ProcessHandler) respondWithError(c echo.Context, statusCode int, message string, err error) error {
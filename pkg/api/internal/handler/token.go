@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/labstack/echo/v4"
+)
+
+type StreamTokenHandler struct {
+	logger *slog.Logger
+	tokens *auth.StreamTokenAuthenticator
+}
+
+func NewStreamTokenHandler(cfg *configuration.Configuration, tokens *auth.StreamTokenAuthenticator) *StreamTokenHandler {
+	return &StreamTokenHandler{
+		logger: cfg.Logger.WithGroup("stream_token_handler"),
+		tokens: tokens,
+	}
+}
+
+// Create issues a short-lived token for the caller to stream job events and
+// logs from a browser. The token is returned, to be sent in the access_token
+// query parameter, and set as a cookie scoped to /jobs.
+func (sh *StreamTokenHandler) Create(c echo.Context) error {
+	token, expiresAt, err := sh.tokens.Issue(auth.FromContext(c.Request().Context()))
+	if errors.Is(err, auth.ErrUnauthorized) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "forbidden"})
+	}
+	if err != nil {
+		sh.logger.Error("Failed to issue stream token", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     auth.StreamTokenCookie,
+		Value:    token,
+		Path:     "/jobs",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"token":      token,
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/upload"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+)
+
+// UploadHandler implements the core tus protocol (https://tus.io/protocols/resumable-upload)
+// with the creation, expiration and termination extensions.
+type UploadHandler struct {
+	logger *slog.Logger
+	store  *upload.Store
+	inputs *inputWriter
+	expiry time.Duration
+}
+
+func NewUploadHandler(cfg *configuration.Configuration) *UploadHandler {
+	return &UploadHandler{
+		logger: cfg.Logger.WithGroup("upload_handler"),
+		store:  upload.NewStore(cfg.InputPath),
+		expiry: cfg.Api.UploadExpiry,
+		inputs: &inputWriter{
+			inputPath: cfg.InputPath,
+			maxSize:   cfg.Api.MaxUploadSize,
+			prober:    media.NewProber(cfg.Ffmpeg.ProbePath),
+		},
+	}
+}
+
+func (uh *UploadHandler) Options(c echo.Context) error {
+	c.Response().Header().Set("Tus-Resumable", tusVersion)
+	c.Response().Header().Set("Tus-Version", tusVersion)
+	c.Response().Header().Set("Tus-Extension", tusExtensions)
+	if uh.inputs.maxSize > 0 {
+		c.Response().Header().Set("Tus-Max-Size", strconv.FormatInt(uh.inputs.maxSize, 10))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (uh *UploadHandler) Create(c echo.Context) error {
+	if err := uh.checkVersion(c); err != nil {
+		return err
+	}
+
+	length, err := strconv.ParseInt(c.Request().Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return c.String(http.StatusBadRequest, "invalid Upload-Length header")
+	}
+	if uh.inputs.maxSize > 0 && length > uh.inputs.maxSize {
+		return c.String(http.StatusRequestEntityTooLarge, "file too large")
+	}
+
+	metadata, err := parseMetadata(c.Request().Header.Get("Upload-Metadata"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "invalid Upload-Metadata header")
+	}
+
+	u, err := uh.store.Create(auth.FromContext(c.Request().Context()).Owner(), length, metadata)
+	if err != nil {
+		uh.logger.Error("Failed to create upload", "error", err)
+		return c.String(http.StatusInternalServerError, "internal server error")
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s/%s", c.Request().URL.Path, u.Id))
+	c.Response().Header().Set("Upload-Id", u.Id)
+	c.Response().Header().Set("Upload-Offset", "0")
+	uh.setExpires(c, u)
+	return c.NoContent(http.StatusCreated)
+}
+
+func (uh *UploadHandler) Head(c echo.Context) error {
+	if err := uh.checkVersion(c); err != nil {
+		return err
+	}
+
+	u, err := uh.getOwnedUpload(c)
+	if err != nil {
+		return uh.respondWithStoreError(c, err)
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	c.Response().Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	// Uploads whose inspection failed are finished again by an empty PATCH.
+	if u.Complete() && u.Inspected() {
+		c.Response().Header().Set("Upload-Id", u.Id)
+	}
+	uh.setExpires(c, u)
+	return c.NoContent(http.StatusOK)
+}
+
+func (uh *UploadHandler) Patch(c echo.Context) error {
+	if err := uh.checkVersion(c); err != nil {
+		return err
+	}
+
+	if c.Request().Header.Get("Content-Type") != "application/offset+octet-stream" {
+		return c.String(http.StatusUnsupportedMediaType, "invalid Content-Type header")
+	}
+
+	offset, err := strconv.ParseInt(c.Request().Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return c.String(http.StatusBadRequest, "invalid Upload-Offset header")
+	}
+
+	if _, err := uh.getOwnedUpload(c); err != nil {
+		return uh.respondWithStoreError(c, err)
+	}
+
+	u, err := uh.store.Append(c.Param("id"), offset, c.Request().Body)
+	if err != nil {
+		return uh.respondWithStoreError(c, err)
+	}
+
+	if u.Complete() {
+		if err := uh.finish(c, u); err != nil {
+			return uh.respondWithStoreError(c, err)
+		}
+		c.Response().Header().Set("Upload-Id", u.Id)
+	}
+	c.Response().Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	uh.setExpires(c, u)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// finish checks that a completed upload is a media file and records its
+// checksum and container. Uploads that are not media are discarded.
+func (uh *UploadHandler) finish(c echo.Context, u *upload.Upload) error {
+	file, err := uh.inputs.inspect(c.Request().Context(), uh.store.FilePath(u.Id))
+	if err != nil {
+		if errors.Is(err, media.ErrUnsupportedMedia) {
+			_ = uh.store.Delete(u.Id)
+		}
+		return err
+	}
+
+	u.SHA256 = file.SHA256
+	u.Container = file.Container
+	uh.logger.Info("Upload finished", "upload_id", u.Id, "length", u.Length, "container", u.Container)
+	return uh.store.Save(u)
+}
+
+func (uh *UploadHandler) Delete(c echo.Context) error {
+	if err := uh.checkVersion(c); err != nil {
+		return err
+	}
+
+	if _, err := uh.getOwnedUpload(c); err != nil {
+		return uh.respondWithStoreError(c, err)
+	}
+
+	if err := uh.store.Delete(c.Param("id")); err != nil {
+		return uh.respondWithStoreError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// TusHeaders sets the Tus-Resumable header on every response of the upload
+// routes, as the protocol requires.
+func TusHeaders(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set("Tus-Resumable", tusVersion)
+		return next(c)
+	}
+}
+
+// setExpires tells when an upload not finished yet is removed, which is
+// pushed back by every chunk it receives.
+func (uh *UploadHandler) setExpires(c echo.Context, u *upload.Upload) {
+	if uh.expiry > 0 && !u.Inspected() {
+		c.Response().Header().Set("Upload-Expires", u.ExpiresAt(uh.expiry).Format(http.TimeFormat))
+	}
+}
+
+func (uh *UploadHandler) getOwnedUpload(c echo.Context) (*upload.Upload, error) {
+	u, err := uh.store.Get(c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if !auth.FromContext(c.Request().Context()).CanAccess(u.Owner) {
+		return nil, upload.ErrNotFound
+	}
+
+	return u, nil
+}
+
+func (uh *UploadHandler) checkVersion(c echo.Context) error {
+	if c.Request().Header.Get("Tus-Resumable") != tusVersion {
+		c.Response().Header().Set("Tus-Version", tusVersion)
+		return c.NoContent(http.StatusPreconditionFailed)
+	}
+	return nil
+}
+
+func (uh *UploadHandler) respondWithStoreError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, upload.ErrNotFound):
+		return c.NoContent(http.StatusNotFound)
+	case errors.Is(err, upload.ErrOffsetMismatch):
+		return c.NoContent(http.StatusConflict)
+	case errors.Is(err, upload.ErrTooLarge):
+		return c.String(http.StatusRequestEntityTooLarge, "upload exceeds declared length")
+	case errors.Is(err, media.ErrUnsupportedMedia):
+		return c.String(http.StatusUnsupportedMediaType, "unsupported media type")
+	}
+
+	uh.logger.Error("Failed to handle upload", "error", err)
+	return c.String(http.StatusInternalServerError, "internal server error")
+}
+
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if header == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("empty metadata key")
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(decoded)
+	}
+
+	return metadata, nil
+}
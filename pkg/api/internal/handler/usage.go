@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/douglasdgoulart/video-editor-api/pkg/tenant"
+	"github.com/labstack/echo/v4"
+)
+
+type UsageHandler struct {
+	logger *slog.Logger
+	quotas *tenant.Quotas
+}
+
+func NewUsageHandler(cfg *configuration.Configuration) *UsageHandler {
+	return &UsageHandler{
+		logger: cfg.Logger.WithGroup("usage_handler"),
+		quotas: tenant.NewQuotas(cfg, state.NewFileStore(cfg.StatePath)),
+	}
+}
+
+// Get returns the usage of the tenant of the caller. Admins may ask for any
+// tenant with the "tenant" query parameter.
+func (uh *UsageHandler) Get(c echo.Context) error {
+	principal := auth.FromContext(c.Request().Context())
+	tenantName, err := tenant.FromPrincipal(principal)
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "invalid tenant"})
+	}
+
+	if requested := c.QueryParam("tenant"); requested != "" && requested != tenantName {
+		if principal != nil && !principal.IsAdmin() {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "forbidden"})
+		}
+		tenantName, err = tenant.FromPrincipal(&auth.Principal{Tenant: requested})
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid tenant"})
+		}
+	}
+
+	usage, err := uh.quotas.Usage(c.Request().Context(), tenantName)
+	if err != nil {
+		uh.logger.Error("Failed to compute tenant usage", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, usage)
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// Authenticate stores the principal of each request in its context. A nil
+// authenticator means authentication is disabled and every request passes.
+func Authenticate(authenticator auth.Authenticator, logger *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if authenticator == nil {
+			return next
+		}
+
+		return func(c echo.Context) error {
+			principal, err := authenticator.Authenticate(c.Request().Context(), c.Request())
+			if err != nil {
+				if errors.Is(err, auth.ErrUnauthorized) {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				}
+				logger.Error("Failed to authenticate request", "error", err)
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+			}
+
+			c.SetRequest(c.Request().WithContext(auth.WithPrincipal(c.Request().Context(), principal)))
+			return next(c)
+		}
+	}
+}
+
+// RequireScope rejects authenticated requests whose principal was not
+// granted scope.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := auth.FromContext(c.Request().Context())
+			if principal != nil && !principal.HasScope(scope) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "forbidden"})
+			}
+			return next(c)
+		}
+	}
+}
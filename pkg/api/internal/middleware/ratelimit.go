@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/ratelimit"
+	"github.com/douglasdgoulart/video-editor-api/pkg/tenant"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	RateLimitByAPIKey = "api_key"
+	RateLimitByTenant = "tenant"
+	RateLimitByIP     = "ip"
+)
+
+// RateLimit limits the requests to the route named name with the limiter,
+// answering 429 once the bucket of the caller is empty. Responses carry the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers. A nil
+// limiter or a route without a configured limit lets every request pass, and
+// so do limiter errors, as rejecting every request would be worse.
+func RateLimit(limiter ratelimit.Limiter, name string, cfg configuration.RateLimitConfig, logger *slog.Logger) echo.MiddlewareFunc {
+	route, ok := cfg.Routes[name]
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if limiter == nil || !ok || route.Requests <= 0 || route.Period <= 0 {
+			return next
+		}
+		limit := ratelimit.LimitFor(route)
+		policy := fmt.Sprintf("%d;w=%d", limit.Burst, int(math.Ceil(route.Period.Seconds())))
+
+		return func(c echo.Context) error {
+			key := fmt.Sprintf("%s:%s", name, rateLimitKey(c, route.Key))
+			result, err := limiter.Allow(c.Request().Context(), key, limit)
+			if err != nil {
+				logger.Error("Failed to check rate limit", "error", err, "route", name)
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set("RateLimit-Policy", policy)
+			header.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+			if !result.Allowed {
+				header.Set("Retry-After", ceilSeconds(result.RetryAfter))
+				return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "rate limit exceeded"})
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// rateLimitKey identifies the caller by its api key or tenant, falling back
+// to its ip for unauthenticated requests.
+func rateLimitKey(c echo.Context, by string) string {
+	principal := auth.FromContext(c.Request().Context())
+	switch {
+	case by == RateLimitByTenant && principal != nil:
+		if name, err := tenant.FromPrincipal(principal); err == nil {
+			return "tenant:" + name
+		}
+	case (by == RateLimitByAPIKey || by == "") && principal != nil:
+		// Ids are already prefixed by the kind of credentials.
+		return principal.Id
+	}
+	return "ip:" + c.RealIP()
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const responseControllerKey = "response_controller"
+
+// ResponseController keeps the controller of the connection of every request,
+// which the response writers wrapped by later middlewares hide.
+func ResponseController(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Set(responseControllerKey, http.NewResponseController(c.Response().Writer))
+		return next(c)
+	}
+}
+
+// KeepOpen lifts the read and write timeouts of the server for a route
+// streaming its request or its response, such as upload chunks, job events
+// or logs, which would otherwise cut the stream once they elapse. It requires
+// ResponseController.
+func KeepOpen(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if controller, ok := c.Get(responseControllerKey).(*http.ResponseController); ok {
+			_ = controller.SetReadDeadline(time.Time{})
+			_ = controller.SetWriteDeadline(time.Time{})
+		}
+		return next(c)
+	}
+}
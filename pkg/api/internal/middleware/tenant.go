@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/douglasdgoulart/video-editor-api/pkg/tenant"
+	"github.com/labstack/echo/v4"
+)
+
+// RequireJobPath restricts a wildcard route laid out as <tenant>/<job id>/...
+// to the jobs the principal may access, like the jobs routes: jobs of its
+// tenant it owns. Admins may access every job.
+func RequireJobPath(store state.Store) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := auth.FromContext(c.Request().Context())
+			if principal == nil || principal.IsAdmin() {
+				return next(c)
+			}
+
+			tenantName, err := tenant.FromPrincipal(principal)
+			if err != nil {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "invalid tenant"})
+			}
+
+			p, err := url.PathUnescape(c.Param("*"))
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid path"})
+			}
+			segments := strings.SplitN(strings.TrimPrefix(path.Clean("/"+p), "/"), "/", 3)
+			if len(segments) < 2 || segments[0] != tenantName {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "not found"})
+			}
+
+			job, err := store.Get(c.Request().Context(), segments[1])
+			if err != nil || !principal.CanAccess(job.Owner) {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "not found"})
+			}
+
+			return next(c)
+		}
+	}
+}
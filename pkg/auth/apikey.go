@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/spf13/viper"
+)
+
+// APIKeyAuthenticator accepts static API keys, sent either in the X-API-Key
+// header or as a bearer token. Only the SHA-256 hash of each key is stored.
+type APIKeyAuthenticator struct {
+	keys []configuration.ApiKeyConfig
+}
+
+func NewAPIKeyAuthenticator(cfg configuration.AuthConfig) (*APIKeyAuthenticator, error) {
+	keys := append([]configuration.ApiKeyConfig{}, cfg.Keys...)
+	if cfg.KeysFile != "" {
+		fileKeys, err := loadKeysFile(cfg.KeysFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fileKeys...)
+	}
+
+	for i, key := range keys {
+		if key.Id == "" || key.Hash == "" {
+			return nil, fmt.Errorf("api key %d must have an id and a hash", i)
+		}
+		keys[i].Hash = strings.ToLower(key.Hash)
+	}
+
+	return &APIKeyAuthenticator{keys: keys}, nil
+}
+
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = bearerToken(r)
+	}
+	if key == "" {
+		return nil, ErrUnauthorized
+	}
+
+	hash := []byte(HashKey(key))
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(hash, []byte(k.Hash)) == 1 {
+			return &Principal{
+				Id:     APIKeyPrefix + k.Id,
+				Tenant: k.Tenant,
+				Scopes: k.Scopes,
+			}, nil
+		}
+	}
+
+	return nil, ErrUnauthorized
+}
+
+// HashKey returns the hex encoded SHA-256 hash of key, as expected in the
+// hash field of the api key configuration.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func loadKeysFile(path string) ([]configuration.ApiKeyConfig, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var keys []configuration.ApiKeyConfig
+	if err := v.UnmarshalKey("keys", &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyAuthenticator_Authenticate(t *testing.T) {
+	keysFile := filepath.Join(t.TempDir(), "keys.yaml")
+	err := os.WriteFile(keysFile, []byte("keys:\n  - id: reader\n    hash: "+HashKey("reader-key")+"\n    scopes: [read]\n"), 0o600)
+	assert.NoError(t, err)
+
+	authenticator, err := NewAPIKeyAuthenticator(configuration.AuthConfig{
+		KeysFile: keysFile,
+		Keys: []configuration.ApiKeyConfig{
+			{Id: "ci", Hash: HashKey("ci-key"), Scopes: []string{ScopeSubmit, ScopeRead}},
+		},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		wantId  string
+		wantErr error
+	}{
+		{name: "api key header", header: "X-API-Key", value: "ci-key", wantId: "key:ci"},
+		{name: "bearer token", header: "Authorization", value: "Bearer ci-key", wantId: "key:ci"},
+		{name: "key from file", header: "X-API-Key", value: "reader-key", wantId: "key:reader"},
+		{name: "unknown key", header: "X-API-Key", value: "other-key", wantErr: ErrUnauthorized},
+		{name: "missing key", wantErr: ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "/jobs", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+
+			principal, err := authenticator.Authenticate(context.Background(), r)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantId, principal.Id)
+		})
+	}
+}
+
+func TestPrincipal_HasScope(t *testing.T) {
+	t.Run("Given an admin principal, it should have every scope", func(t *testing.T) {
+		p := &Principal{Id: "admin", Scopes: []string{ScopeAdmin}}
+		assert.True(t, p.HasScope(ScopeCancel))
+		assert.True(t, p.CanAccess("someone-else"))
+	})
+
+	t.Run("Given a principal without the scope, it should not have it", func(t *testing.T) {
+		p := &Principal{Id: "ci", Scopes: []string{ScopeSubmit}}
+		assert.False(t, p.HasScope(ScopeDownload))
+		assert.False(t, p.CanAccess("someone-else"))
+		assert.True(t, p.CanAccess("ci"))
+	})
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+)
+
+const (
+	ScopeSubmit   = "submit"
+	ScopeRead     = "read"
+	ScopeCancel   = "cancel"
+	ScopeDownload = "download"
+	ScopeAdmin    = "admin"
+)
+
+var ErrUnauthorized = errors.New("missing or invalid credentials")
+
+// Ids of principals are prefixed by the kind of their credentials, so an api
+// key and a token subject of the same name are different owners.
+const (
+	APIKeyPrefix = "key:"
+	JWTPrefix    = "jwt:"
+)
+
+// Principal is the identity behind an authenticated request.
+type Principal struct {
+	// Id is the id of the api key, or the subject of the token, prefixed
+	// by APIKeyPrefix or JWTPrefix.
+	Id     string
+	Tenant string
+	Scopes []string
+}
+
+// HasScope reports whether the principal was granted scope. The admin scope
+// grants every other scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || p.IsAdmin()
+}
+
+func (p *Principal) IsAdmin() bool {
+	return slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// CanAccess reports whether the principal may see a resource owned by owner.
+// Requests without a principal only happen when authentication is disabled.
+func (p *Principal) CanAccess(owner string) bool {
+	return p == nil || p.IsAdmin() || p.Id == owner
+}
+
+// Owner returns the id recorded as the owner of what p creates.
+func (p *Principal) Owner() string {
+	if p == nil {
+		return ""
+	}
+	return p.Id
+}
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, r *http.Request) (*Principal, error)
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of the request, or nil when
+// authentication is disabled.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// NewAuthenticator builds the authenticator for the configured credentials:
+// static API keys, and JWT bearer tokens when enabled.
+func NewAuthenticator(cfg configuration.AuthConfig) (Authenticator, error) {
+	apiKeyAuthenticator, err := NewAPIKeyAuthenticator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	chain := Chain{apiKeyAuthenticator}
+
+	if cfg.Jwt.Enabled {
+		jwtAuthenticator, err := NewJWTAuthenticator(cfg.Jwt)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, jwtAuthenticator)
+	}
+
+	return chain, nil
+}
+
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Chain tries each authenticator in order and returns the first principal
+// found.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	for _, authenticator := range c {
+		p, err := authenticator.Authenticate(ctx, r)
+		if err == nil {
+			return p, nil
+		}
+		if !errors.Is(err, ErrUnauthorized) {
+			return nil, err
+		}
+	}
+
+	return nil, ErrUnauthorized
+}
@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJwksCacheTTL   = time.Hour
+	minJwksRefreshBackoff = 10 * time.Second
+	jwksFetchTimeout      = 10 * time.Second
+	maxJwksSize           = 1 << 20
+)
+
+var errKeyNotFound = errors.New("signing key not found")
+
+// SigningKey is a public key of a JWKS and the algorithm it signs with: the
+// "alg" of the key, or the one of its curve for EC keys. RSA keys without
+// "alg" may sign with any of the RSA algorithms.
+type SigningKey struct {
+	Key crypto.PublicKey
+	Alg string
+}
+
+// Allows reports whether tokens signed with alg may be verified with the key.
+func (k SigningKey) Allows(alg string) bool {
+	if k.Alg != "" {
+		return alg == k.Alg
+	}
+	_, isRSA := k.Key.(*rsa.PublicKey)
+	return isRSA && isRSAAlgorithm(alg)
+}
+
+func isRSAAlgorithm(alg string) bool {
+	return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// KeySet caches the public keys of a JWKS document loaded from a file or an
+// URL. Keys are reloaded once the cache expires, or earlier when a token is
+// signed by an unknown key id, which is how signing key rotations show up.
+// A single reload runs at a time, outside of the lock of the cache, and at
+// most once per minJwksRefreshBackoff, so an unavailable source does not
+// hold every token behind it.
+type KeySet struct {
+	file   string
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]SigningKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	// refreshing is closed once the reload in flight, if any, is done, with
+	// its error in refreshErr.
+	refreshing chan struct{}
+	refreshErr error
+}
+
+func NewKeySet(file string, url string, ttl time.Duration) *KeySet {
+	if ttl <= 0 {
+		ttl = defaultJwksCacheTTL
+	}
+	return &KeySet{
+		file:   file,
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+	}
+}
+
+// Key returns the public key with the given id. An empty kid is only
+// accepted when the set holds a single key. Keys of an expired cache are
+// still returned while it is reloaded, and unknown keys wait for the reload.
+func (k *KeySet) Key(ctx context.Context, kid string) (SigningKey, error) {
+	k.mu.Lock()
+	key, found := k.lookup(kid)
+	expired := time.Since(k.fetchedAt) > k.ttl
+	if found && !expired {
+		k.mu.Unlock()
+		return key, nil
+	}
+
+	done := k.refreshing
+	if done == nil {
+		// Avoid hammering the JWKS source with tokens signed by unknown keys,
+		// or while it is unavailable.
+		if time.Since(k.lastAttempt) < minJwksRefreshBackoff {
+			k.mu.Unlock()
+			if found {
+				return key, nil
+			}
+			return SigningKey{}, errKeyNotFound
+		}
+		done = make(chan struct{})
+		k.refreshing = done
+		k.lastAttempt = time.Now()
+		go k.refresh(done)
+	}
+	k.mu.Unlock()
+
+	if found {
+		return key, nil
+	}
+	select {
+	case <-ctx.Done():
+		return SigningKey{}, ctx.Err()
+	case <-done:
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+	if k.refreshErr != nil {
+		return SigningKey{}, k.refreshErr
+	}
+	return SigningKey{}, errKeyNotFound
+}
+
+func (k *KeySet) lookup(kid string) (SigningKey, bool) {
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// refresh reloads the keys and closes done. Keys are kept when the source is
+// temporarily unavailable.
+func (k *KeySet) refresh(done chan struct{}) {
+	keys, err := k.fetch()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err == nil {
+		k.keys = keys
+		k.fetchedAt = time.Now()
+	}
+	k.refreshErr = err
+	k.refreshing = nil
+	close(done)
+}
+
+// fetch loads the keys of the JWKS, bounded by the timeout of the client
+// rather than the request of the token that triggered it.
+func (k *KeySet) fetch() (map[string]SigningKey, error) {
+	data, err := k.load(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("loading jwks: %w", err)
+	}
+
+	var set jwkSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("decoding jwks: %w", err)
+	}
+
+	keys := make(map[string]SigningKey, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types, or whose algorithm does not match their
+		// type, are skipped rather than failing the set.
+		signingKey, err := key.signingKey()
+		if err != nil {
+			continue
+		}
+		keys[key.Kid] = signingKey
+	}
+	return keys, nil
+}
+
+func (k *KeySet) load(ctx context.Context) ([]byte, error) {
+	if k.file != "" {
+		return os.ReadFile(k.file)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxJwksSize))
+}
+
+func (key jwk) signingKey() (SigningKey, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := decodeBigInt(key.N)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		e, err := decodeBigInt(key.E)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		if key.Alg != "" && !isRSAAlgorithm(key.Alg) {
+			return SigningKey{}, fmt.Errorf("algorithm %q of an RSA key", key.Alg)
+		}
+		return SigningKey{Key: &rsa.PublicKey{N: n, E: int(e.Int64())}, Alg: key.Alg}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var validator ecdh.Curve
+		var alg string
+		switch key.Crv {
+		case "P-256":
+			curve, validator, alg = elliptic.P256(), ecdh.P256(), "ES256"
+		case "P-384":
+			curve, validator, alg = elliptic.P384(), ecdh.P384(), "ES384"
+		case "P-521":
+			curve, validator, alg = elliptic.P521(), ecdh.P521(), "ES512"
+		default:
+			return SigningKey{}, fmt.Errorf("unsupported curve %q", key.Crv)
+		}
+		if key.Alg != "" && key.Alg != alg {
+			return SigningKey{}, fmt.Errorf("algorithm %q of a %s key", key.Alg, key.Crv)
+		}
+		x, err := decodeBigInt(key.X)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		y, err := decodeBigInt(key.Y)
+		if err != nil {
+			return SigningKey{}, err
+		}
+
+		// Parsing the uncompressed point rejects points that are not on the curve.
+		size := (curve.Params().BitSize + 7) / 8
+		if x.BitLen() > size*8 || y.BitLen() > size*8 {
+			return SigningKey{}, errors.New("invalid point coordinates")
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		x.FillBytes(point[1 : 1+size])
+		y.FillBytes(point[1+size:])
+		if _, err := validator.NewPublicKey(point); err != nil {
+			return SigningKey{}, err
+		}
+		return SigningKey{Key: &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, Alg: alg}, nil
+	}
+
+	return SigningKey{}, fmt.Errorf("unsupported key type %q", key.Kty)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
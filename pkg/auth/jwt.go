@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+)
+
+const (
+	defaultTenantClaim = "tenant"
+	defaultScopesClaim = "scope"
+)
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// JWTAuthenticator accepts bearer tokens signed by one of the keys of a JWKS,
+// as issued by an OIDC identity provider. The subject becomes the principal
+// id, and the configured claims its tenant and scopes.
+type JWTAuthenticator struct {
+	keys        *KeySet
+	issuer      string
+	audience    string
+	tenantClaim string
+	scopesClaim string
+	leeway      time.Duration
+	now         func() time.Time
+}
+
+func NewJWTAuthenticator(cfg configuration.JwtConfig) (*JWTAuthenticator, error) {
+	if cfg.JwksFile == "" && cfg.JwksURL == "" {
+		return nil, errors.New("jwt authentication requires a jwks file or url")
+	}
+
+	tenantClaim := cfg.TenantClaim
+	if tenantClaim == "" {
+		tenantClaim = defaultTenantClaim
+	}
+	scopesClaim := cfg.ScopesClaim
+	if scopesClaim == "" {
+		scopesClaim = defaultScopesClaim
+	}
+
+	return &JWTAuthenticator{
+		keys:        NewKeySet(cfg.JwksFile, cfg.JwksURL, cfg.CacheTTL),
+		issuer:      cfg.Issuer,
+		audience:    cfg.Audience,
+		tenantClaim: tenantClaim,
+		scopesClaim: scopesClaim,
+		leeway:      cfg.Leeway,
+		now:         time.Now,
+	}, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	token := bearerToken(r)
+	if strings.Count(token, ".") != 2 {
+		return nil, ErrUnauthorized
+	}
+
+	claims, err := a.verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrUnauthorized)
+	}
+	tenant, _ := claims[a.tenantClaim].(string)
+
+	return &Principal{
+		Id:     JWTPrefix + subject,
+		Tenant: tenant,
+		Scopes: claimStrings(claims[a.scopesClaim]),
+	}, nil
+}
+
+func (a *JWTAuthenticator) verify(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: invalid header", ErrUnauthorized)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature", ErrUnauthorized)
+	}
+
+	key, err := a.keys.Key(ctx, header.Kid)
+	if errors.Is(err, errKeyNotFound) {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The algorithm is the one of the key, the header only naming it, so a
+	// token cannot pick a weaker one.
+	if !key.Allows(header.Alg) {
+		return nil, fmt.Errorf("%w: algorithm %q not allowed for the key", ErrUnauthorized, header.Alg)
+	}
+	if err := verifySignature(header.Alg, key.Key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims", ErrUnauthorized)
+	}
+	if err := a.validateClaims(claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	return claims, nil
+}
+
+func (a *JWTAuthenticator) validateClaims(claims map[string]any) error {
+	now := a.now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("missing expiration")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(a.leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(a.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token not valid yet")
+	}
+	if a.issuer != "" && claims["iss"] != a.issuer {
+		return errors.New("invalid issuer")
+	}
+	if a.audience != "" && !slices.Contains(claimStrings(claims["aud"]), a.audience) {
+		return errors.New("invalid audience")
+	}
+
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	var hash crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("key does not match algorithm")
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature)
+	case strings.HasPrefix(alg, "PS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("key does not match algorithm")
+		}
+		return rsa.VerifyPSS(rsaKey, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case strings.HasPrefix(alg, "ES"):
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("key does not match algorithm")
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// claimStrings reads a claim that is either a space separated string, as the
+// OAuth "scope" claim, or a list of strings, as "scp" or "aud".
+func claimStrings(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		var values []string
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+type testKey struct {
+	kid string
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	// alg is published as the "alg" of the key when set.
+	alg string
+}
+
+func newRSATestKey(t *testing.T, kid string) testKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	return testKey{kid: kid, rsa: key}
+}
+
+func newECTestKey(t *testing.T, kid string) testKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	return testKey{kid: kid, ec: key}
+}
+
+func (k testKey) jwk() map[string]string {
+	encode := base64.RawURLEncoding.EncodeToString
+	var jwk map[string]string
+	if k.rsa != nil {
+		jwk = map[string]string{
+			"kty": "RSA",
+			"kid": k.kid,
+			"use": "sig",
+			"n":   encode(k.rsa.N.Bytes()),
+			"e":   encode([]byte{1, 0, 1}),
+		}
+	} else {
+		jwk = map[string]string{
+			"kty": "EC",
+			"kid": k.kid,
+			"crv": "P-256",
+			"x":   encode(k.ec.X.FillBytes(make([]byte, 32))),
+			"y":   encode(k.ec.Y.FillBytes(make([]byte, 32))),
+		}
+	}
+	if k.alg != "" {
+		jwk["alg"] = k.alg
+	}
+	return jwk
+}
+
+func (k testKey) sign(t *testing.T, claims map[string]any) string {
+	alg := "RS256"
+	if k.ec != nil {
+		alg = "ES256"
+	}
+	return k.signWith(t, alg, claims)
+}
+
+// signWith signs claims with alg, which is RS256, PS256 or ES256.
+func (k testKey) signWith(t *testing.T, alg string, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": k.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch {
+	case alg == "PS256":
+		signature, err = rsa.SignPSS(rand.Reader, k.rsa, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case k.rsa != nil:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+	default:
+		r, s, signErr := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		err = signErr
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	}
+	assert.NoError(t, err)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJWKS(t *testing.T, path string, keys ...testKey) {
+	var jwks []map[string]string
+	for _, key := range keys {
+		jwks = append(jwks, key.jwk())
+	}
+	data, _ := json.Marshal(map[string]any{"keys": jwks})
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func bearerRequest(token string) *http.Request {
+	r, _ := http.NewRequest(http.MethodGet, "/jobs", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"sub":    "user-1",
+		"iss":    "https://sso.internal",
+		"aud":    []string{"video-editor"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"tenant": "team-a",
+		"scope":  "submit read",
+	}
+}
+
+func TestJWTAuthenticator_Authenticate(t *testing.T) {
+	rsaKey := newRSATestKey(t, "rsa-1")
+	ecKey := newECTestKey(t, "ec-1")
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, rsaKey, ecKey)
+
+	authenticator, err := NewJWTAuthenticator(configuration.JwtConfig{
+		JwksFile: jwksFile,
+		Issuer:   "https://sso.internal",
+		Audience: "video-editor",
+	})
+	assert.NoError(t, err)
+
+	t.Run("Given tokens signed with RSA and EC keys, it should map claims to the principal", func(t *testing.T) {
+		for _, key := range []testKey{rsaKey, ecKey} {
+			principal, err := authenticator.Authenticate(context.Background(), bearerRequest(key.sign(t, validClaims())))
+			assert.NoError(t, err)
+			assert.Equal(t, "jwt:user-1", principal.Id)
+			assert.Equal(t, "team-a", principal.Tenant)
+			assert.Equal(t, []string{ScopeSubmit, ScopeRead}, principal.Scopes)
+		}
+	})
+
+	t.Run("Given invalid tokens, it should return unauthorized", func(t *testing.T) {
+		expired := validClaims()
+		expired["exp"] = time.Now().Add(-time.Hour).Unix()
+		otherAudience := validClaims()
+		otherAudience["aud"] = "another-service"
+
+		unsigned := rsaKey.sign(t, validClaims())
+		tampered := unsigned[:len(unsigned)-4] + "AAAA"
+		none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+			base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "."
+
+		for name, token := range map[string]string{
+			"expired":        rsaKey.sign(t, expired),
+			"other audience": rsaKey.sign(t, otherAudience),
+			"tampered":       tampered,
+			"alg none":       none,
+			"unknown key":    newRSATestKey(t, "rsa-unknown").sign(t, validClaims()),
+		} {
+			_, err := authenticator.Authenticate(context.Background(), bearerRequest(token))
+			assert.ErrorIs(t, err, ErrUnauthorized, name)
+		}
+	})
+}
+
+func TestJWTAuthenticator_Algorithms(t *testing.T) {
+	boundKey := newRSATestKey(t, "rsa-bound")
+	boundKey.alg = "RS256"
+	anyKey := newRSATestKey(t, "rsa-any")
+	mismatchedKey := newECTestKey(t, "ec-mismatched")
+	mismatchedKey.alg = "ES384"
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, boundKey, anyKey, mismatchedKey)
+
+	authenticator, err := NewJWTAuthenticator(configuration.JwtConfig{JwksFile: jwksFile})
+	assert.NoError(t, err)
+	authenticate := func(token string) error {
+		_, err := authenticator.Authenticate(context.Background(), bearerRequest(token))
+		return err
+	}
+
+	t.Run("Given a key with an algorithm, it should only accept tokens signed with it", func(t *testing.T) {
+		assert.NoError(t, authenticate(boundKey.signWith(t, "RS256", validClaims())))
+		assert.ErrorIs(t, authenticate(boundKey.signWith(t, "PS256", validClaims())), ErrUnauthorized)
+	})
+
+	t.Run("Given an RSA key without an algorithm, it should accept the RSA algorithms", func(t *testing.T) {
+		assert.NoError(t, authenticate(anyKey.signWith(t, "PS256", validClaims())))
+	})
+
+	t.Run("Given an EC key whose algorithm does not match its curve, it should ignore the key", func(t *testing.T) {
+		assert.ErrorIs(t, authenticate(mismatchedKey.sign(t, validClaims())), ErrUnauthorized)
+	})
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	t.Run("Given a token signed by a rotated in key, it should reload the jwks from the url", func(t *testing.T) {
+		oldKey := newRSATestKey(t, "old")
+		newKey := newRSATestKey(t, "new")
+		jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+		writeJWKS(t, jwksFile, oldKey)
+
+		fetches := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetches++
+			http.ServeFile(w, r, jwksFile)
+		}))
+		defer server.Close()
+
+		authenticator, err := NewJWTAuthenticator(configuration.JwtConfig{JwksURL: server.URL})
+		assert.NoError(t, err)
+
+		_, err = authenticator.Authenticate(context.Background(), bearerRequest(oldKey.sign(t, validClaims())))
+		assert.NoError(t, err)
+
+		writeJWKS(t, jwksFile, oldKey, newKey)
+		// Skip the refresh backoff instead of waiting for it.
+		authenticator.keys.lastAttempt = time.Time{}
+
+		_, err = authenticator.Authenticate(context.Background(), bearerRequest(newKey.sign(t, validClaims())))
+		assert.NoError(t, err)
+		_, err = authenticator.Authenticate(context.Background(), bearerRequest(oldKey.sign(t, validClaims())))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, fetches)
+	})
+}
+
+func TestKeySet_Outage(t *testing.T) {
+	t.Run("Given an expired cache and a stalled source, it should serve the cached keys while fetching once", func(t *testing.T) {
+		key := newRSATestKey(t, "key")
+		jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+		writeJWKS(t, jwksFile, key)
+
+		var fetches atomic.Int32
+		stalled := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if fetches.Add(1) > 1 {
+				<-stalled
+			}
+			http.ServeFile(w, r, jwksFile)
+		}))
+		defer server.Close()
+		defer close(stalled)
+
+		keys := NewKeySet("", server.URL, time.Minute)
+		ctx := context.Background()
+		_, err := keys.Key(ctx, "key")
+		assert.NoError(t, err)
+
+		keys.mu.Lock()
+		keys.fetchedAt = time.Now().Add(-time.Hour)
+		keys.lastAttempt = time.Time{}
+		keys.mu.Unlock()
+
+		var wg sync.WaitGroup
+		started := time.Now()
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := keys.Key(ctx, "key")
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+		assert.Less(t, time.Since(started), time.Second)
+
+		unknownCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err = keys.Key(unknownCtx, "unknown")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, int32(2), fetches.Load())
+	})
+}
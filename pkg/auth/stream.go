@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+)
+
+const (
+	// StreamTokenParam and StreamTokenCookie carry stream tokens, as browser
+	// EventSource and WebSocket clients cannot set request headers.
+	StreamTokenParam  = "access_token"
+	StreamTokenCookie = "stream_token"
+
+	defaultStreamTokenTTL = 5 * time.Minute
+)
+
+type streamClaims struct {
+	Subject   string   `json:"sub"`
+	Tenant    string   `json:"tenant,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// StreamTokenAuthenticator issues short-lived tokens to authenticated
+// principals and accepts them from the query or a cookie, on the routes
+// streaming job events and logs only. Tokens only grant the read scope.
+type StreamTokenAuthenticator struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewStreamTokenAuthenticator signs tokens with the configured secret. Without
+// one, a random secret is used, so tokens are only accepted by the replica
+// that issued them.
+func NewStreamTokenAuthenticator(cfg configuration.StreamTokenConfig) (*StreamTokenAuthenticator, error) {
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultStreamTokenTTL
+	}
+
+	return &StreamTokenAuthenticator{secret: secret, ttl: ttl, now: time.Now}, nil
+}
+
+// Issue returns a token standing for p, with the read scope only, and when
+// it expires.
+func (a *StreamTokenAuthenticator) Issue(p *Principal) (string, time.Time, error) {
+	if p == nil || !p.HasScope(ScopeRead) {
+		return "", time.Time{}, ErrUnauthorized
+	}
+
+	expiresAt := a.now().Add(a.ttl).Truncate(time.Second)
+	payload, err := json.Marshal(streamClaims{
+		Subject:   p.Id,
+		Tenant:    p.Tenant,
+		Scopes:    []string{ScopeRead},
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(a.sign(encoded)), expiresAt, nil
+}
+
+func (a *StreamTokenAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	token := r.URL.Query().Get(StreamTokenParam)
+	if token == "" {
+		if cookie, err := r.Cookie(StreamTokenCookie); err == nil {
+			token = cookie.Value
+		}
+	}
+
+	payload, signature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, ErrUnauthorized
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(decoded, a.sign(payload)) {
+		return nil, fmt.Errorf("%w: invalid signature", ErrUnauthorized)
+	}
+
+	var claims streamClaims
+	if err := decodeSegment(payload, &claims); err != nil || claims.Subject == "" {
+		return nil, fmt.Errorf("%w: invalid token", ErrUnauthorized)
+	}
+	if !a.now().Before(time.Unix(claims.ExpiresAt, 0)) {
+		return nil, fmt.Errorf("%w: token expired", ErrUnauthorized)
+	}
+
+	return &Principal{
+		Id:     claims.Subject,
+		Tenant: claims.Tenant,
+		Scopes: claims.Scopes,
+	}, nil
+}
+
+func (a *StreamTokenAuthenticator) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamTokenAuthenticator_Authenticate(t *testing.T) {
+	authenticator, err := NewStreamTokenAuthenticator(configuration.StreamTokenConfig{Secret: "secret", TTL: time.Minute})
+	assert.NoError(t, err)
+	now := time.Now()
+	authenticator.now = func() time.Time { return now }
+
+	token, expiresAt, err := authenticator.Issue(&Principal{Id: "ci", Tenant: "team-a", Scopes: []string{ScopeSubmit, ScopeRead}})
+	assert.NoError(t, err)
+	assert.WithinDuration(t, now.Add(time.Minute), expiresAt, time.Second)
+
+	authenticate := func(query string, cookie string) (*Principal, error) {
+		r, _ := http.NewRequest(http.MethodGet, "/jobs/events?"+query, nil)
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: StreamTokenCookie, Value: cookie})
+		}
+		return authenticator.Authenticate(context.Background(), r)
+	}
+
+	t.Run("Given a token in the query, it should only grant the read scope", func(t *testing.T) {
+		principal, err := authenticate(StreamTokenParam+"="+token, "")
+		assert.NoError(t, err)
+		assert.Equal(t, &Principal{Id: "ci", Tenant: "team-a", Scopes: []string{ScopeRead}}, principal)
+	})
+
+	t.Run("Given a token in the cookie, it should authenticate the request", func(t *testing.T) {
+		principal, err := authenticate("", token)
+		assert.NoError(t, err)
+		assert.Equal(t, "ci", principal.Id)
+	})
+
+	t.Run("Given a tampered, foreign or missing token, it should return unauthorized", func(t *testing.T) {
+		_, err := authenticate(StreamTokenParam+"=x"+token, "")
+		assert.ErrorIs(t, err, ErrUnauthorized)
+
+		other, err := NewStreamTokenAuthenticator(configuration.StreamTokenConfig{})
+		assert.NoError(t, err)
+		foreign, _, err := other.Issue(&Principal{Id: "ci", Scopes: []string{ScopeRead}})
+		assert.NoError(t, err)
+		_, err = authenticate(StreamTokenParam+"="+foreign, "")
+		assert.ErrorIs(t, err, ErrUnauthorized)
+
+		_, err = authenticate("", "")
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	})
+
+	t.Run("Given an expired token, it should return unauthorized", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		defer func() { now = now.Add(-2 * time.Minute) }()
+
+		_, err := authenticate(StreamTokenParam+"="+token, "")
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	})
+
+	t.Run("Given a principal without the read scope, it should not issue a token", func(t *testing.T) {
+		_, _, err := authenticator.Issue(&Principal{Id: "uploader", Scopes: []string{ScopeSubmit}})
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	})
+}
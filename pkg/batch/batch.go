@@ -0,0 +1,214 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/douglasdgoulart/video-editor-api/pkg/webhook"
+	"github.com/google/uuid"
+)
+
+var ErrNotFound = errors.New("batch not found")
+
+// StatusPartial is the status of a finished batch where only some of the
+// jobs succeeded.
+const StatusPartial state.Status = "partial"
+
+// Batch groups the jobs submitted together by a single request, and is
+// notified once all of them are done.
+type Batch struct {
+	Id         string    `json:"id"`
+	Owner      string    `json:"owner,omitempty"`
+	Tenant     string    `json:"tenant,omitempty"`
+	JobIds     []string  `json:"job_ids"`
+	WebhookURL string    `json:"webhook_url,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Summary is the aggregate state of the jobs of a batch.
+type Summary struct {
+	Id        string               `json:"id"`
+	Status    state.Status         `json:"status"`
+	Progress  float64              `json:"progress"`
+	Total     int                  `json:"total"`
+	Counts    map[state.Status]int `json:"counts"`
+	Jobs      []JobSummary         `json:"jobs"`
+	CreatedAt time.Time            `json:"created_at"`
+}
+
+type JobSummary struct {
+	Id            string       `json:"id"`
+	Status        state.Status `json:"status"`
+	Progress      float64      `json:"progress"`
+	FileLocations []string     `json:"file_location,omitempty"`
+	ErrorMsg      string       `json:"error_msg,omitempty"`
+	ErrorCode     string       `json:"error_code,omitempty"`
+}
+
+// Done reports whether every job of the batch is done.
+func (s *Summary) Done() bool {
+	switch s.Status {
+	case state.StatusQueued, state.StatusRunning:
+		return false
+	}
+	return true
+}
+
+// Summarize reads the states of the jobs of b. The batch is queued until one
+// of its jobs starts, and running until all of them are done. It then
+// succeeded if all of its jobs did, failed or was cancelled if none did, and
+// is partial otherwise.
+func Summarize(ctx context.Context, store state.Store, b *Batch) (*Summary, error) {
+	summary := &Summary{
+		Id:        b.Id,
+		Total:     len(b.JobIds),
+		Counts:    map[state.Status]int{},
+		Jobs:      make([]JobSummary, 0, len(b.JobIds)),
+		CreatedAt: b.CreatedAt,
+	}
+
+	for _, id := range b.JobIds {
+		job, err := store.Get(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", id, err)
+		}
+
+		summary.Counts[job.Status]++
+		summary.Progress += job.Progress
+		summary.Jobs = append(summary.Jobs, JobSummary{
+			Id:            job.Id,
+			Status:        job.Status,
+			Progress:      job.Progress,
+			FileLocations: job.FileLocations,
+			ErrorMsg:      job.ErrorMsg,
+			ErrorCode:     job.ErrorCode,
+		})
+	}
+	if summary.Total > 0 {
+		summary.Progress /= float64(summary.Total)
+	}
+
+	counts := summary.Counts
+	switch {
+	case counts[state.StatusQueued] == summary.Total:
+		summary.Status = state.StatusQueued
+	case counts[state.StatusQueued] > 0 || counts[state.StatusRunning] > 0:
+		summary.Status = state.StatusRunning
+	case counts[state.StatusSuccess] == summary.Total:
+		summary.Status = state.StatusSuccess
+	case counts[state.StatusSuccess] > 0:
+		summary.Status = StatusPartial
+	case counts[state.StatusCancelled] == summary.Total:
+		summary.Status = state.StatusCancelled
+	default:
+		summary.Status = state.StatusError
+	}
+
+	return summary, nil
+}
+
+// Store keeps one JSON document per batch next to the job states, so the api
+// and the workers share them the same way.
+type Store struct {
+	path string
+}
+
+func NewStore(statePath string) *Store {
+	return &Store{
+		path: filepath.Join(statePath, "batches"),
+	}
+}
+
+func (s *Store) Save(b *Batch) error {
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.path, os.ModePerm); err != nil {
+		return err
+	}
+
+	path := s.batchPath(b.Id)
+	tmp := fmt.Sprintf("%s.%s.tmp", path, uuid.New().String())
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (s *Store) Get(id string) (*Batch, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(s.batchPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var b Batch
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// MarkNotified records that the completion of the batch id was notified. It
+// returns false when it already was, so that only one of the workers
+// finishing the last jobs of a batch calls its webhook.
+func (s *Store) MarkNotified(id string) (bool, error) {
+	f, err := os.OpenFile(filepath.Join(s.path, fmt.Sprintf("%s.notified", id)), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, f.Close()
+}
+
+// Complete calls the webhook of the batch id once all of its jobs are done,
+// and returns the summary of the batch when it did. It is checked after the
+// final state of each job is saved, by the worker finishing it or the api
+// failing to queue it, so at least one of them sees the batch done, while
+// MarkNotified lets only the first one notify it.
+func (s *Store) Complete(ctx context.Context, jobs state.Store, id string) (*Summary, error) {
+	b, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := Summarize(ctx, jobs, b)
+	if err != nil || !summary.Done() {
+		return nil, err
+	}
+
+	notify, err := s.MarkNotified(id)
+	if err != nil || !notify {
+		return nil, err
+	}
+
+	if b.WebhookURL == "" {
+		return summary, nil
+	}
+	return summary, webhook.Post(b.WebhookURL, summary)
+}
+
+func (s *Store) batchPath(id string) string {
+	return filepath.Join(s.path, fmt.Sprintf("%s.json", id))
+}
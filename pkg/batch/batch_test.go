@@ -0,0 +1,108 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarize(t *testing.T) {
+	ctx := context.Background()
+
+	newBatch := func(t *testing.T, statuses ...state.Status) *Summary {
+		store := state.NewFileStore(t.TempDir())
+		b := &Batch{Id: uuid.New().String()}
+		for _, status := range statuses {
+			job := &state.JobState{Id: uuid.New().String(), Status: status}
+			assert.NoError(t, store.Save(ctx, job))
+			b.JobIds = append(b.JobIds, job.Id)
+		}
+
+		summary, err := Summarize(ctx, store, b)
+		assert.NoError(t, err)
+		return summary
+	}
+
+	t.Run("Given jobs left to process, it should not be done", func(t *testing.T) {
+		assert.Equal(t, state.StatusQueued, newBatch(t, state.StatusQueued, state.StatusQueued).Status)
+
+		summary := newBatch(t, state.StatusSuccess, state.StatusQueued)
+		assert.Equal(t, state.StatusRunning, summary.Status)
+		assert.False(t, summary.Done())
+		assert.Equal(t, 1, summary.Counts[state.StatusSuccess])
+	})
+
+	t.Run("Given finished jobs, it should tell whether all of them succeeded", func(t *testing.T) {
+		assert.Equal(t, state.StatusSuccess, newBatch(t, state.StatusSuccess, state.StatusSuccess).Status)
+		assert.Equal(t, StatusPartial, newBatch(t, state.StatusSuccess, state.StatusError).Status)
+		assert.Equal(t, state.StatusError, newBatch(t, state.StatusCancelled, state.StatusError).Status)
+		assert.Equal(t, state.StatusCancelled, newBatch(t, state.StatusCancelled).Status)
+		assert.True(t, newBatch(t, state.StatusError).Done())
+	})
+}
+
+func TestStore(t *testing.T) {
+	t.Run("Given a saved batch, it should be notified only once", func(t *testing.T) {
+		store := NewStore(t.TempDir())
+		b := &Batch{Id: uuid.New().String(), JobIds: []string{uuid.New().String()}}
+		assert.NoError(t, store.Save(b))
+
+		saved, err := store.Get(b.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, b.JobIds, saved.JobIds)
+
+		notify, err := store.MarkNotified(b.Id)
+		assert.NoError(t, err)
+		assert.True(t, notify)
+		notify, err = store.MarkNotified(b.Id)
+		assert.NoError(t, err)
+		assert.False(t, notify)
+
+		_, err = store.Get(uuid.New().String())
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestStore_Complete(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Given a batch whose jobs are all done, it should call its webhook once", func(t *testing.T) {
+		calls := make(chan Summary, 2)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var summary Summary
+			_ = json.NewDecoder(r.Body).Decode(&summary)
+			calls <- summary
+		}))
+		defer server.Close()
+
+		statePath := t.TempDir()
+		jobs := state.NewFileStore(statePath)
+		store := NewStore(statePath)
+		job := &state.JobState{Id: uuid.New().String(), Status: state.StatusQueued}
+		assert.NoError(t, jobs.Save(ctx, job))
+		b := &Batch{Id: uuid.New().String(), JobIds: []string{job.Id}, WebhookURL: server.URL}
+		assert.NoError(t, store.Save(b))
+
+		summary, err := store.Complete(ctx, jobs, b.Id)
+		assert.NoError(t, err)
+		assert.Nil(t, summary)
+
+		job.Status = state.StatusError
+		assert.NoError(t, jobs.Save(ctx, job))
+		summary, err = store.Complete(ctx, jobs, b.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, state.StatusError, summary.Status)
+		summary, err = store.Complete(ctx, jobs, b.Id)
+		assert.NoError(t, err)
+		assert.Nil(t, summary)
+
+		assert.Len(t, calls, 1)
+		assert.Equal(t, b.Id, (<-calls).Id)
+	})
+}
@@ -1,12 +1,15 @@
 package configuration
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event/queue"
 	"github.com/spf13/viper"
 )
 
@@ -15,26 +18,135 @@ type Configuration struct {
 	Logger        *slog.Logger
 	OutputPath    string `mapstructure:"output_path"`
 	InputPath     string `mapstructure:"input_path"`
-	InternalQueue chan event.Event
-	Api           ApiConfig    `mapstructure:"api"`
-	Kafka         KafkaConfig  `mapstructure:"kafka"`
-	Job           JobConfig    `mapstructure:"job"`
-	Ffmpeg        FfmpegConfig `mapstructure:"ffmpeg"`
+	StatePath     string `mapstructure:"state_path"`
+	InternalQueue *queue.Queue[event.Event]
+	Api           ApiConfig       `mapstructure:"api"`
+	Auth          AuthConfig      `mapstructure:"auth"`
+	Kafka         KafkaConfig     `mapstructure:"kafka"`
+	Job           JobConfig       `mapstructure:"job"`
+	Ffmpeg        FfmpegConfig    `mapstructure:"ffmpeg"`
+	Tenants       TenantsConfig   `mapstructure:"tenants"`
+	RateLimit     RateLimitConfig `mapstructure:"rate_limit"`
 }
 
 type ApiConfig struct {
-	Enabled bool   `mapstructure:"enabled"`
-	Host    string `mapstructure:"host"`
-	Port    string `mapstructure:"port"`
+	Enabled       bool          `mapstructure:"enabled"`
+	Host          string        `mapstructure:"host"`
+	Port          string        `mapstructure:"port"`
+	MaxUploadSize int64         `mapstructure:"max_upload_size"`
+	UploadExpiry  time.Duration `mapstructure:"upload_expiry"`
+	MaxBatchSize  int           `mapstructure:"max_batch_size"`
+}
+
+type AuthConfig struct {
+	Enabled  bool           `mapstructure:"enabled"`
+	KeysFile string         `mapstructure:"keys_file"`
+	Keys     []ApiKeyConfig `mapstructure:"keys"`
+	Jwt      JwtConfig      `mapstructure:"jwt"`
+	// StreamTokens are the short-lived tokens browsers authenticate job event
+	// and log streams with.
+	StreamTokens StreamTokenConfig `mapstructure:"stream_tokens"`
+}
+
+type ApiKeyConfig struct {
+	Id     string   `mapstructure:"id"`
+	Hash   string   `mapstructure:"hash"`
+	Tenant string   `mapstructure:"tenant"`
+	Scopes []string `mapstructure:"scopes"`
+}
+
+type JwtConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	JwksFile    string        `mapstructure:"jwks_file"`
+	JwksURL     string        `mapstructure:"jwks_url"`
+	CacheTTL    time.Duration `mapstructure:"cache_ttl"`
+	Issuer      string        `mapstructure:"issuer"`
+	Audience    string        `mapstructure:"audience"`
+	TenantClaim string        `mapstructure:"tenant_claim"`
+	ScopesClaim string        `mapstructure:"scopes_claim"`
+	Leeway      time.Duration `mapstructure:"leeway"`
+}
+
+// StreamTokenConfig sets the secret stream tokens are signed with, which
+// every replica of the api must share, and how long they are valid.
+type StreamTokenConfig struct {
+	Secret string        `mapstructure:"secret"`
+	TTL    time.Duration `mapstructure:"ttl"`
 }
 
 type JobConfig struct {
 	Enabled bool `mapstructure:"enabled"`
 	Workers int  `mapstructure:"workers"`
+	// PriorityWeights sets how often each priority is served relative to the
+	// others when events of several priorities are pending.
+	PriorityWeights map[string]int `mapstructure:"priority_weights"`
+	// MaxParallelSteps caps how many steps of a pipeline job run at once, each
+	// step being an ffmpeg process of its own. Zero means one.
+	MaxParallelSteps int `mapstructure:"max_parallel_steps"`
 }
 
 type FfmpegConfig struct {
-	Path string `mapstructure:"path"`
+	Path      string `mapstructure:"path"`
+	ProbePath string `mapstructure:"probe_path"`
+	// Timeout is the default wall clock limit of a job, which requests may
+	// override up to MaxTimeout. Zero means unlimited.
+	Timeout    time.Duration `mapstructure:"timeout"`
+	MaxTimeout time.Duration `mapstructure:"max_timeout"`
+	Threads    int           `mapstructure:"threads"`
+	Nice       int           `mapstructure:"nice"`
+	// MemoryLimit in bytes is enforced through a child of the cgroup v2
+	// CgroupPath when set, or the address space rlimit otherwise.
+	MemoryLimit int64  `mapstructure:"memory_limit"`
+	CgroupPath  string `mapstructure:"cgroup_path"`
+	// LogTailLines is the number of log lines sent with failure webhooks.
+	LogTailLines int   `mapstructure:"log_tail_lines"`
+	MaxLogSize   int64 `mapstructure:"max_log_size"`
+	// FontDir holds the fonts requests may draw texts with, and the fonts
+	// of burnt in subtitles.
+	FontDir string `mapstructure:"font_dir"`
+}
+
+type TenantsConfig struct {
+	Default TenantLimits            `mapstructure:"default"`
+	Limits  map[string]TenantLimits `mapstructure:"limits"`
+}
+
+// TenantLimits holds the quotas of a tenant, zero meaning unlimited.
+type TenantLimits struct {
+	MaxActiveJobs  int     `mapstructure:"max_active_jobs" json:"max_active_jobs"`
+	MaxRunningJobs int     `mapstructure:"max_running_jobs" json:"max_running_jobs"`
+	DailyMinutes   float64 `mapstructure:"daily_minutes" json:"daily_minutes"`
+	StorageBytes   int64   `mapstructure:"storage_bytes" json:"storage_bytes"`
+}
+
+// For returns the limits of tenant, falling back to the default limits.
+func (t TenantsConfig) For(tenant string) TenantLimits {
+	if limits, ok := t.Limits[tenant]; ok {
+		return limits
+	}
+	return t.Default
+}
+
+type RateLimitConfig struct {
+	Enabled bool                      `mapstructure:"enabled"`
+	Backend string                    `mapstructure:"backend"`
+	Redis   RedisConfig               `mapstructure:"redis"`
+	Routes  map[string]RateLimitRoute `mapstructure:"routes"`
+}
+
+type RedisConfig struct {
+	Address  string `mapstructure:"address"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+}
+
+// RateLimitRoute allows Requests per Period to a route, with bursts of up to
+// Burst requests, for each api key, tenant or ip depending on Key.
+type RateLimitRoute struct {
+	Requests int           `mapstructure:"requests"`
+	Period   time.Duration `mapstructure:"period"`
+	Burst    int           `mapstructure:"burst"`
+	Key      string        `mapstructure:"key"`
 }
 
 type KafkaConfig struct {
@@ -131,10 +243,33 @@ func NewConfiguration() *Configuration {
 		panic(err)
 	}
 
+	config.StatePath, err = filepath.Abs(config.StatePath)
+	if err != nil {
+		slog.Error("Error getting absolute state path", "error", err)
+		panic(err)
+	}
+	// The output path is served by the api, which must not serve job states.
+	if isWithin(config.StatePath, config.OutputPath) {
+		err = fmt.Errorf("state path %s is inside the output path %s", config.StatePath, config.OutputPath)
+		slog.Error("Invalid state path", "error", err)
+		panic(err)
+	}
+	err = os.MkdirAll(config.StatePath, os.ModePerm)
+	if err != nil {
+		slog.Error("Error creating state path", "error", err)
+		panic(err)
+	}
+
 	config.Logger = logger
-	config.InternalQueue = make(chan event.Event)
+	config.InternalQueue = event.NewQueue(config.Job.PriorityWeights)
 
 	slog.Debug("Configuration loaded", "config", config)
 
 	return &config
 }
+
+// isWithin reports whether path is dir or one of its descendants.
+func isWithin(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
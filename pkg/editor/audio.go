@@ -0,0 +1,123 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+)
+
+const (
+	// The background music is compressed by up to duckingRatio whenever the
+	// input audio goes over duckingThreshold, and recovers once it stays
+	// under it for duckingRelease milliseconds.
+	duckingThreshold = 0.05
+	duckingRatio     = 8
+	duckingAttack    = 20
+	duckingRelease   = 400
+)
+
+// audioCodecs are the audio codecs of the outputs by extension, aac being the
+// default.
+var audioCodecs = map[string]string{
+	"mp3":  "libmp3lame",
+	"opus": "libopus",
+	"ogg":  "libopus",
+	"webm": "libopus",
+	"wav":  "pcm_s16le",
+	"flac": "flac",
+}
+
+// audioInputArgs returns the arguments reading the input of the audio
+// operation of the request, repeated when it loops.
+func audioInputArgs(req request.EditorRequest) ([]string, error) {
+	if req.Audio == nil || req.Audio.Mode == request.AudioExtract {
+		return nil, nil
+	}
+	path, err := inputPath(req.Audio.Input)
+	if err != nil {
+		return nil, fmt.Errorf("audio: %w", err)
+	}
+	if req.Audio.Loop {
+		return []string{"-stream_loop", "-1", "-i", path}, nil
+	}
+	return []string{"-i", path}, nil
+}
+
+// audioArgs maps the streams of the audio operation of the request, the
+// audio input being read at audioIndex, normalizing the output audio from the
+// measured loudness. The video is copied unless the request filters it or
+// sets its rate control.
+func (f *FfmpegEditor) audioArgs(req request.EditorRequest, audioIndex int, measured *media.LoudnessStats) []string {
+	audio := *req.Audio
+	loudness := loudnessFilters(req, measured)
+	if audio.Mode == request.AudioExtract {
+		args := []string{"-map", "0:a:0"}
+		if len(loudness) > 0 {
+			args = append(args, "-af", strings.Join(loudness, ","))
+		}
+		return append(args, audioCodecArgs(req)...)
+	}
+
+	graph := &filterGraph{}
+	filtered := hasGraphOperations(req) || len(req.Filters) > 0
+	video := "0:v:0"
+	if filtered {
+		video = "[" + f.videoChain(graph, req, "0:v", 1) + "]"
+	}
+
+	var args []string
+	if audio.Mode == request.AudioMix {
+		out := mixChain(graph, audio, "0:a", fmt.Sprintf("%d:a", audioIndex))
+		if len(loudness) > 0 {
+			out = graph.chain([]string{out}, loudness...)
+		}
+		args = append(args, "-filter_complex", graph.String(), "-map", video, "-map", "["+out+"]")
+	} else {
+		if filtered {
+			args = append(args, "-filter_complex", graph.String())
+		}
+		args = append(args, "-map", video, "-map", fmt.Sprintf("%d:a:0", audioIndex), "-shortest")
+		if len(loudness) > 0 {
+			args = append(args, "-af", strings.Join(loudness, ","))
+		}
+	}
+	if !filtered && req.RateControl == nil {
+		args = append(args, "-c:v", "copy")
+	}
+	return append(args, audioCodecArgs(req)...)
+}
+
+// mixChain mixes the music pad into the voice pad at the gain of the audio
+// operation, ducking the music under the voice when requested. The mix lasts
+// as long as the voice.
+func mixChain(g *filterGraph, audio request.Audio, voice string, music string) string {
+	if audio.Gain != 0 {
+		music = g.chain([]string{music}, fmt.Sprintf("volume=%gdB", audio.Gain))
+	}
+	if audio.Ducking {
+		// The voice is both mixed and the side chain of the compressor.
+		mixed, sidechain := g.label(), g.label()
+		g.chainTo([]string{voice}, []string{mixed, sidechain}, "asplit=2")
+		music = g.chain([]string{music, sidechain}, fmt.Sprintf("sidechaincompress=threshold=%g:ratio=%d:attack=%d:release=%d",
+			duckingThreshold, duckingRatio, duckingAttack, duckingRelease))
+		voice = mixed
+	}
+	return g.chain([]string{voice, music}, "amix=inputs=2:duration=first:dropout_transition=0:normalize=0")
+}
+
+// audioCodecArgs returns the audio codec of the request, or the one of the
+// extension of its output, and its audio bitrate.
+func audioCodecArgs(req request.EditorRequest) []string {
+	codec := req.AudioCodec
+	if codec == "" {
+		pattern := req.Output.FilePattern
+		codec = valueOr(audioCodecs[strings.ToLower(pattern[strings.LastIndex(pattern, ".")+1:])], "aac")
+	}
+	args := []string{"-c:a", codec}
+	if req.AudioBitrate != "" {
+		args = append(args, "-b:a", req.AudioBitrate)
+	}
+	return args
+}
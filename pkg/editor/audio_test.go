@@ -0,0 +1,75 @@
+package editor
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMixChain(t *testing.T) {
+	t.Run("Given a gain, it should lower the music before mixing it for as long as the voice", func(t *testing.T) {
+		graph := &filterGraph{}
+		out := mixChain(graph, request.Audio{Mode: request.AudioMix, Gain: -12}, "0:a", "1:a")
+		assert.Equal(t, "f2", out)
+		assert.Equal(t, "[1:a]volume=-12dB[f1];[0:a][f1]amix=inputs=2:duration=first:dropout_transition=0:normalize=0[f2]", graph.String())
+	})
+
+	t.Run("Given ducking, it should compress the music with the voice as side chain", func(t *testing.T) {
+		graph := &filterGraph{}
+		mixChain(graph, request.Audio{Mode: request.AudioMix, Ducking: true}, "0:a", "1:a")
+		assert.Equal(t, "[0:a]asplit=2[f1][f2];"+
+			"[1:a][f2]sidechaincompress=threshold=0.05:ratio=8:attack=20:release=400[f3];"+
+			"[f1][f3]amix=inputs=2:duration=first:dropout_transition=0:normalize=0[f4]", graph.String())
+	})
+}
+
+func TestFfmpegEditor_buildCommandWithAudio(t *testing.T) {
+	editor := NewFFMpegEditor(&configuration.Configuration{
+		Logger: slog.Default(),
+		Ffmpeg: configuration.FfmpegConfig{Path: ffmpegLocation},
+	}).(*FfmpegEditor)
+
+	t.Run("Given an extract operation, it should keep the audio with the codec of the output", func(t *testing.T) {
+		cmd, err := editor.buildCommand(request.EditorRequest{
+			Input:        request.Input{UploadedFilePath: "input.mp4"},
+			Audio:        &request.Audio{Mode: request.AudioExtract},
+			AudioBitrate: "192k",
+			Output:       request.Output{FilePattern: "output.mp3"},
+		}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			ffmpegLocation, "-y", "-i", "input.mp4", "-map", "0:a:0", "-c:a", "libmp3lame", "-b:a", "192k", "output.mp3",
+		}, cmd.Args)
+	})
+
+	t.Run("Given a replace operation, it should copy the video and map the looped audio input", func(t *testing.T) {
+		cmd, err := editor.buildCommand(request.EditorRequest{
+			Input:  request.Input{UploadedFilePath: "input.mp4"},
+			Audio:  &request.Audio{Mode: request.AudioReplace, Input: request.Input{UploadedFilePath: "music.mp3"}, Loop: true},
+			Output: request.Output{FilePattern: "output.mp4"},
+		}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			ffmpegLocation, "-y", "-i", "input.mp4", "-stream_loop", "-1", "-i", "music.mp3",
+			"-map", "0:v:0", "-map", "1:a:0", "-shortest", "-c:v", "copy", "-c:a", "aac", "output.mp4",
+		}, cmd.Args)
+	})
+
+	t.Run("Given a mix operation and an overlay, it should read the music after the overlay", func(t *testing.T) {
+		cmd, err := editor.buildCommand(request.EditorRequest{
+			Input:   request.Input{UploadedFilePath: "input.mp4"},
+			Overlay: &request.Overlay{Input: request.Input{UploadedFilePath: "logo.png"}},
+			Audio:   &request.Audio{Mode: request.AudioMix, Input: request.Input{UploadedFilePath: "music.mp3"}},
+			Output:  request.Output{FilePattern: "output.mp4"},
+		}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			ffmpegLocation, "-y", "-i", "input.mp4", "-i", "logo.png", "-i", "music.mp3",
+			"-filter_complex", "[0:v][1:v]overlay=x=W-w-0:y=H-h-0[f1];[0:a][2:a]amix=inputs=2:duration=first:dropout_transition=0:normalize=0[f2]",
+			"-map", "[f1]", "-map", "[f2]", "-c:a", "aac", "output.mp4",
+		}, cmd.Args)
+	})
+}
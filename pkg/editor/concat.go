@@ -0,0 +1,258 @@
+package editor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+)
+
+const (
+	defaultConcatFrameRate   = "30"
+	concatAudioSampleRate    = 48000
+	concatAudioChannelLayout = "stereo"
+)
+
+// concatInput is an input of a concat request along with its first video
+// and audio streams, as probed.
+type concatInput struct {
+	path     string
+	video    *media.Stream
+	audio    *media.Stream
+	duration float64
+}
+
+// buildConcatCommand joins the inputs of the request with the concat
+// demuxer, which copies the streams when the request has no filters, or with
+// the concat filter, which normalizes every input to the size and frame rate
+// of the first one and re-encodes them. It returns the path of the list of
+// inputs read by the demuxer, to be removed once the command is done.
+func (f *FfmpegEditor) buildConcatCommand(ctx context.Context, req request.EditorRequest) (*exec.Cmd, string, error) {
+	paths := make([]string, len(req.Inputs))
+	for i, input := range req.Inputs {
+		path, err := inputPath(input)
+		if err != nil {
+			return nil, "", fmt.Errorf("inputs[%d]: %w", i, err)
+		}
+		paths[i] = path
+	}
+
+	method := req.Concat.Method
+	var inputs []concatInput
+	if method != request.ConcatDemuxer {
+		var err error
+		inputs, err = f.probeConcatInputs(ctx, req.Inputs, paths)
+		if err != nil {
+			return nil, "", err
+		}
+		if method != request.ConcatFilter && concatMatches(inputs) {
+			method = request.ConcatDemuxer
+		}
+	}
+
+	if method == request.ConcatDemuxer {
+		list, err := writeConcatList("", paths)
+		if err != nil {
+			return nil, "", err
+		}
+		args, err := f.concatDemuxerArgs(list, req)
+		if err != nil {
+			return nil, list, err
+		}
+		args = append(args, f.outputArgs(req)...)
+		args = append(args, req.Output.FilePattern)
+		return exec.Command(f.BinaryPath, args...), list, nil
+	}
+
+	args, err := f.concatFilterArgs(req, inputs)
+	if err != nil {
+		return nil, "", err
+	}
+	args = append(args, f.outputArgs(req)...)
+	args = append(args, req.Output.FilePattern)
+	return exec.Command(f.BinaryPath, args...), "", nil
+}
+
+func (f *FfmpegEditor) probeConcatInputs(ctx context.Context, inputs []request.Input, paths []string) ([]concatInput, error) {
+	probed := make([]concatInput, len(inputs))
+	for i, input := range inputs {
+		result, err := f.probeInput(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("probing inputs[%d]: %w", i, err)
+		}
+
+		probed[i] = concatInput{path: paths[i], duration: result.Duration()}
+		for _, stream := range result.Streams {
+			switch {
+			case stream.CodecType == "video" && probed[i].video == nil:
+				probed[i].video = &stream
+			case stream.CodecType == "audio" && probed[i].audio == nil:
+				probed[i].audio = &stream
+			}
+		}
+		if probed[i].video == nil {
+			return nil, fmt.Errorf("inputs[%d] has no video stream", i)
+		}
+	}
+	return probed, nil
+}
+
+// concatMatches reports whether the inputs share the codecs and formats of
+// their streams, so the concat demuxer can join them.
+func concatMatches(inputs []concatInput) bool {
+	first := inputs[0]
+	for _, input := range inputs[1:] {
+		if input.video.CodecName != first.video.CodecName ||
+			input.video.Width != first.video.Width ||
+			input.video.Height != first.video.Height ||
+			input.video.AvgFrameRate != first.video.AvgFrameRate ||
+			input.video.PixFmt != first.video.PixFmt {
+			return false
+		}
+		if (input.audio == nil) != (first.audio == nil) {
+			return false
+		}
+		if input.audio != nil && (input.audio.CodecName != first.audio.CodecName ||
+			input.audio.SampleRate != first.audio.SampleRate ||
+			input.audio.Channels != first.audio.Channels) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeConcatList writes the list of files read by the concat demuxer to dir,
+// or the temp directory when empty. The demuxer resolves relative paths from
+// the directory of the list.
+func writeConcatList(dir string, paths []string) (string, error) {
+	file, err := os.CreateTemp(dir, "concat-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	for _, path := range paths {
+		if !strings.Contains(path, "://") {
+			if path, err = filepath.Abs(path); err != nil {
+				os.Remove(file.Name())
+				return "", err
+			}
+		}
+		if _, err := fmt.Fprintf(file, "file '%s'\n", strings.ReplaceAll(path, "'", `'\''`)); err != nil {
+			os.Remove(file.Name())
+			return "", err
+		}
+	}
+	return file.Name(), nil
+}
+
+func (f *FfmpegEditor) concatDemuxerArgs(list string, req request.EditorRequest) ([]string, error) {
+	// Inputs may be remote and outside of the directory of the list.
+	args := []string{"-y", "-f", "concat", "-safe", "0", "-protocol_whitelist", "file,http,https,tcp,tls", "-i", list}
+
+	switch {
+	case hasGraphOperations(req):
+		overlayArgs, err := overlayInputArgs(req)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, overlayArgs...)
+
+		graph := &filterGraph{}
+		out := f.videoChain(graph, req, "0:v", 1)
+		args = append(args, "-filter_complex", graph.String(), "-map", "["+out+"]", "-map", "0:a?")
+	case len(req.Filters) > 0:
+		args = append(args, "-vf", videoFilters(req.Filters))
+	default:
+		args = append(args, "-c", "copy")
+	}
+	return append(args, concatOutputArgs(req)...), nil
+}
+
+// concatFilterArgs scales and pads every input to the size of the first
+// one, converts them to its frame rate and their audio to a common layout,
+// filling the inputs without audio with silence, then joins them.
+func (f *FfmpegEditor) concatFilterArgs(req request.EditorRequest, inputs []concatInput) ([]string, error) {
+	first := inputs[0].video
+	frameRate := first.AvgFrameRate
+	if frameRate == "" || strings.HasPrefix(frameRate, "0") {
+		frameRate = defaultConcatFrameRate
+	}
+	audio := false
+	for _, input := range inputs {
+		audio = audio || input.audio != nil
+	}
+
+	args := []string{"-y"}
+	graph := &filterGraph{}
+	var segments []string
+	for i, input := range inputs {
+		args = append(args, "-i", input.path)
+		video := fmt.Sprintf("v%d", i)
+		graph.chainTo([]string{fmt.Sprintf("%d:v", i)}, []string{video},
+			fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", first.Width, first.Height),
+			fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2", first.Width, first.Height),
+			"setsar=1",
+			"fps="+frameRate,
+			"format=yuv420p",
+		)
+		segments = append(segments, video)
+		if !audio {
+			continue
+		}
+
+		audioFormat := fmt.Sprintf("a%d", i)
+		switch {
+		case input.audio != nil:
+			graph.chainTo([]string{fmt.Sprintf("%d:a", i)}, []string{audioFormat},
+				fmt.Sprintf("aformat=sample_rates=%d:channel_layouts=%s", concatAudioSampleRate, concatAudioChannelLayout))
+		case input.duration > 0:
+			graph.chainTo(nil, []string{audioFormat},
+				fmt.Sprintf("anullsrc=r=%d:cl=%s", concatAudioSampleRate, concatAudioChannelLayout),
+				fmt.Sprintf("atrim=duration=%g", input.duration))
+		default:
+			return nil, fmt.Errorf("inputs[%d] has no audio and an unknown duration", i)
+		}
+		segments = append(segments, audioFormat)
+	}
+
+	overlayArgs, err := overlayInputArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, overlayArgs...)
+
+	if audio {
+		graph.chainTo(segments, []string{"joined", "outa"}, fmt.Sprintf("concat=n=%d:v=1:a=1", len(inputs)))
+	} else {
+		graph.chainTo(segments, []string{"joined"}, fmt.Sprintf("concat=n=%d:v=1:a=0", len(inputs)))
+	}
+	out := f.videoChain(graph, req, "joined", len(inputs))
+
+	args = append(args, "-filter_complex", graph.String(), "-map", "["+out+"]")
+	if audio {
+		args = append(args, "-map", "[outa]")
+	}
+	return append(args, concatOutputArgs(req)...), nil
+}
+
+// concatOutputArgs applies the start time, the duration and the frames of
+// the request to the joined inputs.
+func concatOutputArgs(req request.EditorRequest) []string {
+	var args []string
+	if req.StartTime != "" {
+		args = append(args, "-ss", req.StartTime)
+	}
+	if req.Duration != "" {
+		args = append(args, "-t", req.Duration)
+	}
+	if req.Frames != "" {
+		args = append(args, "-frames:v", req.Frames)
+	}
+	return args
+}
@@ -0,0 +1,83 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func newConcatInput(path string, width int, height int, audio bool) concatInput {
+	input := concatInput{
+		path:     path,
+		video:    &media.Stream{CodecType: "video", CodecName: "h264", Width: width, Height: height, AvgFrameRate: "30/1", PixFmt: "yuv420p"},
+		duration: 10,
+	}
+	if audio {
+		input.audio = &media.Stream{CodecType: "audio", CodecName: "aac", SampleRate: "48000", Channels: 2}
+	}
+	return input
+}
+
+func TestConcatMatches(t *testing.T) {
+	t.Run("Given inputs sharing their formats, it should match", func(t *testing.T) {
+		assert.True(t, concatMatches([]concatInput{newConcatInput("a.mp4", 1280, 720, true), newConcatInput("b.mp4", 1280, 720, true)}))
+	})
+
+	t.Run("Given inputs of different sizes or audio, it should not match", func(t *testing.T) {
+		assert.False(t, concatMatches([]concatInput{newConcatInput("a.mp4", 1280, 720, true), newConcatInput("b.mp4", 640, 360, true)}))
+		assert.False(t, concatMatches([]concatInput{newConcatInput("a.mp4", 1280, 720, true), newConcatInput("b.mp4", 1280, 720, false)}))
+	})
+}
+
+func TestFfmpegEditor_concatFilterArgs(t *testing.T) {
+	editor := &FfmpegEditor{}
+
+	t.Run("Given mismatched inputs, it should normalize them to the first one", func(t *testing.T) {
+		req := request.EditorRequest{Filters: map[string]string{"hflip": ""}, StartTime: "5"}
+		args, err := editor.concatFilterArgs(req, []concatInput{newConcatInput("a.mp4", 1280, 720, true), newConcatInput("b.mp4", 640, 480, false)})
+		assert.NoError(t, err)
+
+		assert.Equal(t, []string{"-y", "-i", "a.mp4", "-i", "b.mp4", "-filter_complex"}, args[:6])
+		assert.Equal(t, strings.Join([]string{
+			"[0:v]scale=1280:720:force_original_aspect_ratio=decrease,pad=1280:720:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=30/1,format=yuv420p[v0]",
+			"[0:a]aformat=sample_rates=48000:channel_layouts=stereo[a0]",
+			"[1:v]scale=1280:720:force_original_aspect_ratio=decrease,pad=1280:720:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=30/1,format=yuv420p[v1]",
+			"anullsrc=r=48000:cl=stereo,atrim=duration=10[a1]",
+			"[v0][a0][v1][a1]concat=n=2:v=1:a=1[joined][outa]",
+			"[joined]hflip[f1]",
+		}, ";"), args[6])
+		assert.Equal(t, []string{"-map", "[f1]", "-map", "[outa]", "-ss", "5"}, args[7:])
+	})
+
+	t.Run("Given inputs without audio, it should only join their video", func(t *testing.T) {
+		args, err := editor.concatFilterArgs(request.EditorRequest{}, []concatInput{newConcatInput("a.mp4", 1280, 720, false), newConcatInput("b.mp4", 1280, 720, false)})
+		assert.NoError(t, err)
+
+		assert.True(t, strings.HasSuffix(args[6], "[v0][v1]concat=n=2:v=1:a=0[joined]"))
+		assert.Equal(t, []string{"-map", "[joined]"}, args[7:])
+	})
+}
+
+func TestFfmpegEditor_concatDemuxer(t *testing.T) {
+	editor := &FfmpegEditor{}
+
+	t.Run("Given inputs, it should list them as absolute paths or urls and copy their streams", func(t *testing.T) {
+		list, err := writeConcatList("", []string{"it's.mp4", "https://example.com/b.mp4"})
+		assert.NoError(t, err)
+		defer os.Remove(list)
+
+		content, err := os.ReadFile(list)
+		assert.NoError(t, err)
+		abs, _ := filepath.Abs("it's.mp4")
+		assert.Equal(t, "file '"+strings.ReplaceAll(abs, "'", `'\''`)+"'\nfile 'https://example.com/b.mp4'\n", string(content))
+
+		args, err := editor.concatDemuxerArgs(list, request.EditorRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"-y", "-f", "concat", "-safe", "0", "-protocol_whitelist", "file,http,https,tcp,tls", "-i", list, "-c", "copy"}, args)
+	})
+}
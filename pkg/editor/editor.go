@@ -3,78 +3,310 @@ package editor
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"regexp"
 
 	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/joblog"
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
 	"github.com/douglasdgoulart/video-editor-api/pkg/request"
-	"github.com/google/uuid"
+	"github.com/douglasdgoulart/video-editor-api/pkg/validator"
 )
 
 type EditorInterface interface {
-	HandleRequest(ctx context.Context, req request.EditorRequest) ([]string, error)
+	// HandleRequest runs the request of e, reporting its progress to
+	// onProgress when it is not nil.
+	HandleRequest(ctx context.Context, e *event.Event, onProgress ProgressFunc) (Result, error)
 }
 
+// Result of a request.
+type Result struct {
+	Files []string
+	// Loudness is the loudness of the audio measured before normalizing it,
+	// when the request normalizes its loudness.
+	Loudness *media.LoudnessStats
+	// Scenes are the scenes detected in the video, when the request detects
+	// them.
+	Scenes []media.Scene
+}
+
+const defaultLogTailLines = 20
+
 type FfmpegEditor struct {
-	BinaryPath string
-	logger     *slog.Logger
-	outputPath string
+	BinaryPath  string
+	logger      *slog.Logger
+	outputPath  string
+	timeout     time.Duration
+	maxTimeout  time.Duration
+	threads     int
+	nice        int
+	memoryLimit int64
+	cgroupPath  string
+	prober      *media.Prober
+	logDir      string
+	logTail     int
+	maxLogSize  int64
+	fontDir     string
 }
 
 func NewFFMpegEditor(cfg *configuration.Configuration) EditorInterface {
+	logDir := ""
+	if cfg.StatePath != "" {
+		logDir = joblog.Dir(cfg.StatePath)
+	}
+	logTail := cfg.Ffmpeg.LogTailLines
+	if logTail <= 0 {
+		logTail = defaultLogTailLines
+	}
+
 	return &FfmpegEditor{
-		BinaryPath: cfg.Ffmpeg.Path,
-		logger:     cfg.Logger.WithGroup("ffmpeg_editor"),
-		outputPath: cfg.OutputPath,
+		BinaryPath:  cfg.Ffmpeg.Path,
+		logger:      cfg.Logger.WithGroup("ffmpeg_editor"),
+		outputPath:  cfg.OutputPath,
+		timeout:     cfg.Ffmpeg.Timeout,
+		maxTimeout:  cfg.Ffmpeg.MaxTimeout,
+		threads:     cfg.Ffmpeg.Threads,
+		nice:        cfg.Ffmpeg.Nice,
+		memoryLimit: cfg.Ffmpeg.MemoryLimit,
+		cgroupPath:  cfg.Ffmpeg.CgroupPath,
+		prober:      media.NewProber(cfg.Ffmpeg.ProbePath),
+		logDir:      logDir,
+		logTail:     logTail,
+		maxLogSize:  cfg.Ffmpeg.MaxLogSize,
+		fontDir:     cfg.Ffmpeg.FontDir,
 	}
 
 }
 
-func (f *FfmpegEditor) HandleRequest(ctx context.Context, req request.EditorRequest) (output []string, err error) {
-	outputPattern := f.getOutputPath(req.Output.FilePattern)
+func (f *FfmpegEditor) HandleRequest(ctx context.Context, e *event.Event, onProgress ProgressFunc) (Result, error) {
+	req := e.EditorRequest
+	if err := validator.ValidateOutput("output", req.Output); err != nil {
+		return Result{}, &Error{Code: CodeInvalidRequest, Err: err}
+	}
+	outputPattern := f.getOutputPath(req.Output.FilePattern, e.Tenant, e.Id, e.Step)
 	outputPath := filepath.Dir(outputPattern)
 	req.Output.FilePattern = outputPattern
 
-	cmd, err := f.buildCommand(req)
+	timeout, err := f.getTimeout(req)
+	if err != nil {
+		return Result{}, &Error{Code: CodeInvalidRequest, Err: err}
+	}
+	if req.Texts, err = f.resolveFonts(req.Texts); err != nil {
+		return Result{}, &Error{Code: CodeInvalidRequest, Err: err}
+	}
+	if req, err = f.resolveTrim(ctx, req); err != nil {
+		return Result{}, &Error{Code: CodeInvalidRequest, Err: err}
+	}
+
+	if req.Loudness != nil {
+		if req, err = f.resolveLoudness(ctx, req); err != nil {
+			return Result{}, &Error{Code: CodeInvalidRequest, Err: err}
+		}
+	}
+
+	// Every pass of the job writes to its log, which is only created once.
+	name := joblog.Name(e.Id, e.Step)
+	log, err := joblog.Create(f.logDir, name, f.maxLogSize, f.logTail)
+	if err != nil {
+		return Result{}, &Error{Code: CodeFfmpegError, Err: fmt.Errorf("creating job log: %w", err)}
+	}
+	defer log.Close()
+
+	// Loudness normalization measures the audio in a first pass, two-pass
+	// encodes analyze the video in a first pass and smart trims encode their
+	// parts before joining them, every pass sharing the progress and the time
+	// limit of the job.
+	passes := newPasses(1, timeout, onProgress)
+	if req.Loudness != nil {
+		passes.count++
+	}
+
+	var result Result
+	if req.Loudness != nil {
+		passes.logHeader(log)
+		result.Loudness, err = f.measureLoudness(ctx, name, req, log, passes.timeout(), passes.next())
+		if err != nil {
+			return Result{}, err
+		}
+		if result.Loudness == nil {
+			req.Loudness = nil
+		}
+	}
+
+	// Two-pass encodes and smart trims write intermediate files to the temp
+	// directory of the job.
+	var tempDir string
+	if isTwoPass(req) || req.TrimMode == request.TrimSmart {
+		if tempDir, err = os.MkdirTemp("", "job-"+name+"-"); err != nil {
+			return Result{}, &Error{Code: CodeFfmpegError, Err: fmt.Errorf("creating job temp directory: %w", err)}
+		}
+		defer os.RemoveAll(tempDir)
+	}
+
+	var cmds []*exec.Cmd
+	var cmd *exec.Cmd
+	switch {
+	case req.Concat != nil:
+		var list string
+		cmd, list, err = f.buildConcatCommand(ctx, req)
+		if list != "" {
+			defer os.Remove(list)
+		}
+	case req.Output.Mode == request.OutputModeHls:
+		cmd, err = f.buildHlsCommand(req, f.hasAudio(ctx, req.Input))
+	case req.Output.Mode == request.OutputModeDash:
+		cmd, err = f.buildDashCommand(req, f.hasAudio(ctx, req.Input))
+	case req.Output.Mode == request.OutputModeSprite:
+		cmd, err = f.buildSpriteCommand(req)
+	case req.Output.Mode == request.OutputModeScenes:
+		cmd, err = f.buildScenesCommand(req)
+	case req.TrimMode == request.TrimSmart:
+		cmds, err = f.buildSmartTrimCommands(ctx, req, tempDir)
+	default:
+		cmd, err = f.buildCommand(req, result.Loudness)
+	}
 	if err != nil {
-		return
+		return Result{}, &Error{Code: CodeInvalidRequest, Err: err}
+	}
+	if cmd != nil {
+		cmds = []*exec.Cmd{cmd}
 	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if isTwoPass(req) {
+		first, second := twoPassCommands(cmds[0], filepath.Join(tempDir, passLogName))
+		cmds = []*exec.Cmd{first, second}
+	}
 
-	result := make(chan error)
+	passes.count += len(cmds) - 1
+	for _, cmd := range cmds {
+		passes.logHeader(log)
+		if err := f.run(ctx, name, cmd, log, passes.timeout(), passes.next()); err != nil {
+			return Result{}, err
+		}
+	}
+	f.logger.Info("Command finished successfully")
+
+	// HLS outputs are made of many segments, their playlists are enough to
+	// reach them.
+	switch req.Output.Mode {
+	case request.OutputModeHls:
+		result.Files = hlsOutputs(req.Output)
+	case request.OutputModeDash:
+		result.Files, err = dashOutputs(req.Output, outputPath)
+	case request.OutputModeSprite:
+		result.Files, err = f.spriteOutputs(ctx, req, outputPath)
+	case request.OutputModeScenes:
+		result.Scenes, result.Files, err = f.scenesOutputs(ctx, req, outputPath)
+	default:
+		result.Files, err = getFilesInDirectory(outputPath)
+	}
+	return result, err
+}
 
-	go func(resultChannel chan<- error) {
-		f.logger.Info("Running command", "command", strings.Join(cmd.Args, " "))
-		err := cmd.Run()
-		f.logger.Info("Command finished", "error", err)
-		resultChannel <- err
-	}(result)
+// run runs cmd within the limits of the job, killing it once ctx is done or
+// timeout elapses. The output of ffmpeg goes to log, and to the stderr of cmd
+// when set.
+func (f *FfmpegEditor) run(ctx context.Context, id string, cmd *exec.Cmd, log *joblog.Writer, timeout time.Duration, onProgress ProgressFunc) error {
+	sandbox := f.newSandbox(id)
+	defer sandbox.close()
 
-	f.logger.Info("Waiting for command to finish")
+	stderr := io.Writer(log)
+	if cmd.Stderr != nil {
+		stderr = io.MultiWriter(log, cmd.Stderr)
+	}
+	cmd.Stdout = log
+	cmd.Stderr = stderr
+	if onProgress != nil {
+		// Progress updates replace the periodic stats, which would only
+		// clutter the log.
+		cmd.Args = slices.Insert(cmd.Args, 1, "-progress", "pipe:1", "-nostats")
+		tracker := newProgressTracker(onProgress)
+		cmd.Stdout = tracker.progressWriter()
+		cmd.Stderr = io.MultiWriter(stderr, tracker.logWriter())
+	}
+	sandbox.prepare(cmd)
+
+	runCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	f.logger.Info("Running command", "command", strings.Join(cmd.Args, " "), "timeout", timeout, "job_id", id)
+	if err := cmd.Start(); err != nil {
+		f.logger.Info("Command finished", "error", err, "job_id", id)
+		return &Error{Code: CodeFfmpegError, Err: err}
+	}
+	sandbox.started(cmd.Process.Pid)
+
+	result := make(chan error, 1)
+	go func() {
+		result <- cmd.Wait()
+	}()
+
+	f.logger.Info("Waiting for command to finish", "job_id", id)
 	select {
-	case <-ctx.Done():
-		err = cmd.Process.Kill()
-		if err != nil {
-			f.logger.Error("Failed to kill process", "error", err)
+	case <-runCtx.Done():
+		if err := cmd.Process.Kill(); err != nil {
+			f.logger.Error("Failed to kill process", "error", err, "job_id", id)
+		}
+		<-result
+		if ctx.Err() != nil {
+			return &Error{Code: CodeCancelled, Err: fmt.Errorf("process killed"), Log: log.Tail()}
+		}
+		return &Error{Code: CodeTimeout, Err: fmt.Errorf("process killed after exceeding its %s time limit", timeout), Log: log.Tail()}
+	case err := <-result:
+		f.logger.Info("Command finished", "error", err, "job_id", id)
+		if err == nil {
+			return nil
+		}
+		tail := log.Tail()
+		if sandbox.outOfMemory(strings.Join(tail, "\n")) {
+			return &Error{Code: CodeMemoryLimit, Err: fmt.Errorf("process exceeded its memory limit: %w", err), Log: tail}
 		}
-		err = fmt.Errorf("process killed")
-		return
-	case err = <-result:
+		return &Error{Code: CodeFfmpegError, Err: err, Log: tail}
+	}
+}
+
+// getTimeout returns the time limit of a request: its own timeout, when set,
+// capped by the maximum timeout, or the default one.
+func (f *FfmpegEditor) getTimeout(req request.EditorRequest) (time.Duration, error) {
+	timeout := f.timeout
+	if req.Timeout != "" {
+		requested, err := time.ParseDuration(req.Timeout)
 		if err != nil {
-			return
+			return 0, fmt.Errorf("invalid timeout: %w", err)
 		}
+		timeout = requested
 	}
-	f.logger.Info("Command finished successfully")
+	if f.maxTimeout > 0 && (timeout <= 0 || timeout > f.maxTimeout) {
+		timeout = f.maxTimeout
+	}
+	return timeout, nil
+}
 
-	output, err = getFilesInDirectory(outputPath)
-	return
+// probeInput probes the input of a request.
+func (f *FfmpegEditor) probeInput(ctx context.Context, input request.Input) (*media.ProbeResult, error) {
+	if f.prober == nil {
+		return nil, fmt.Errorf("no prober configured")
+	}
+
+	path, err := inputPath(input)
+	if err != nil {
+		return nil, err
+	}
+	return f.prober.Probe(ctx, path)
 }
 
 func getFilesInDirectory(directory string) ([]string, error) {
@@ -94,7 +326,9 @@ func getFilesInDirectory(directory string) ([]string, error) {
 	return files, nil
 }
 
-func (f *FfmpegEditor) getOutputPath(outputFilePattern string) string {
+// getOutputPath places the outputs of a job under <output path>/<tenant>/<job id>,
+// and those of its pipeline steps under <output path>/<tenant>/<job id>/<step>.
+func (f *FfmpegEditor) getOutputPath(outputFilePattern string, tenant string, id string, step string) string {
 	outputPattern := "output"
 	outputFileExtention := strings.ToLower(outputFilePattern[strings.LastIndex(outputFilePattern, ".")+1:])
 	placeholderRegex := regexp.MustCompile(`%[0-9]{2}d`)
@@ -102,60 +336,115 @@ func (f *FfmpegEditor) getOutputPath(outputFilePattern string) string {
 		outputPattern = placeholderRegex.FindString(outputFilePattern)
 	}
 
-	outputFilePattern = fmt.Sprintf("%s/%s/%s.%s", f.outputPath, uuid.New().String(), outputPattern, outputFileExtention)
+	outputFilePattern = filepath.Join(f.outputPath, tenant, id, step, fmt.Sprintf("%s.%s", outputPattern, outputFileExtention))
 	_ = os.MkdirAll(filepath.Dir(outputFilePattern), os.ModePerm)
 
 	return outputFilePattern
 }
 
-func (f *FfmpegEditor) buildCommand(req request.EditorRequest) (*exec.Cmd, error) {
-	var inputFilePath string
+// buildCommand builds the command of a request writing a single output,
+// normalizing its audio from the measured loudness.
+func (f *FfmpegEditor) buildCommand(req request.EditorRequest, measured *media.LoudnessStats) (*exec.Cmd, error) {
+	args, err := inputArgs(req)
+	if err != nil {
+		return nil, err
+	}
 
-	if req.Input.FileURL != "" {
-		inputFilePath = req.Input.FileURL
-	} else if req.Input.UploadedFilePath != "" {
-		inputFilePath = req.Input.UploadedFilePath
-	} else {
-		return nil, fmt.Errorf("no valid input file provided")
+	overlayArgs, err := overlayInputArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, overlayArgs...)
+	audioArgs, err := audioInputArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, audioArgs...)
+
+	switch {
+	case req.Audio != nil:
+		// The audio input comes after the overlay, if any.
+		audioIndex := 1
+		if req.Overlay != nil {
+			audioIndex = 2
+		}
+		args = append(args, f.audioArgs(req, audioIndex, measured)...)
+	case hasGraphOperations(req):
+		// The graph only outputs the video, the audio is kept as is.
+		graph := &filterGraph{}
+		out := f.videoChain(graph, req, "0:v", 1)
+		args = append(args, "-filter_complex", graph.String(), "-map", "["+out+"]", "-map", "0:a?")
+	case len(req.Filters) > 0:
+		args = append(args, "-vf", videoFilters(req.Filters))
+	}
+	if loudness := loudnessFilters(req, measured); req.Audio == nil && len(loudness) > 0 {
+		args = append(args, "-af", strings.Join(loudness, ","))
+	}
+	if req.Frames != "" {
+		args = append(args, "-frames:v", req.Frames)
 	}
+	args = append(args, rateControlArgs(req)...)
+	args = append(args, fastTrimArgs(req)...)
+	args = append(args, splitArgs(req)...)
 
-	args := []string{"-y"}
+	args = append(args, f.outputArgs(req)...)
+	args = append(args, req.Output.FilePattern)
+
+	cmd := exec.Command(f.BinaryPath, args...)
+	return cmd, nil
+}
 
-	if req.StartTime != "" {
-		args = append(args, "-ss", req.StartTime)
+// inputArgs returns the arguments reading the input of the request from its
+// start time, for its duration.
+func inputArgs(req request.EditorRequest) ([]string, error) {
+	inputFilePath, err := inputPath(req.Input)
+	if err != nil {
+		return nil, err
 	}
 
-	args = append(args, "-i", inputFilePath)
+	args := []string{"-y"}
+	args = append(args, seekArgs(req)...)
+
+	return append(args, "-i", inputFilePath), nil
+}
 
-	if len(req.Filters) > 0 {
-		var filterStrings []string
+// inputPath returns the file url or the uploaded file of an input.
+func inputPath(input request.Input) (string, error) {
+	if input.FileURL != "" {
+		return input.FileURL, nil
+	} else if input.UploadedFilePath != "" {
+		return input.UploadedFilePath, nil
+	}
+	return "", fmt.Errorf("no valid input file provided")
+}
 
-		for name, options := range req.Filters {
-			if options == "" {
-				filterStrings = append(filterStrings, name)
-				continue
-			}
+func videoFilters(filters map[string]string) string {
+	var filterStrings []string
 
-			filterString := fmt.Sprintf("%s=%s", name, options)
-			filterStrings = append(filterStrings, filterString)
+	for name, options := range filters {
+		if options == "" {
+			filterStrings = append(filterStrings, name)
+			continue
 		}
 
-		filterGraph := strings.Join(filterStrings, ",")
-		args = append(args, "-vf", filterGraph)
-	}
-	if req.Frames != "" {
-		args = append(args, "-frames:v", req.Frames)
+		filterString := fmt.Sprintf("%s=%s", name, options)
+		filterStrings = append(filterStrings, filterString)
 	}
 
+	return strings.Join(filterStrings, ",")
+}
+
+// outputArgs returns the extra options of the request and the limits of the
+// editor, which come last before the output.
+func (f *FfmpegEditor) outputArgs(req request.EditorRequest) []string {
+	var args []string
 	if req.ExtraOptions != "" {
 		extraArgs := strings.Split(req.ExtraOptions, " ")
 		args = append(args, extraArgs...)
 	}
 
-	args = append(args, req.Output.FilePattern)
-
-	cmd := exec.Command(f.BinaryPath, args...)
-
-	f.logger.Info("Running command", "command", strings.Join(cmd.Args, " "))
-	return cmd, nil
+	if f.threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(f.threads))
+	}
+	return args
 }
@@ -9,7 +9,9 @@ import (
 	"testing"
 
 	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event"
 	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/google/uuid"
 )
 
 var ffmpegLocation = "../../bin/ffmpeg/ffmpeg"
@@ -34,7 +36,7 @@ func TestFfmpegEditor_buildCommand(t *testing.T) {
 			ExtraOptions: "-vf \"thumbnail,scale=640:480\" -frames:v 1",
 		}
 
-		cmd, err := editor.(*FfmpegEditor).buildCommand(req)
+		cmd, err := editor.(*FfmpegEditor).buildCommand(req, nil)
 		if err != nil {
 			t.Fatalf("Failed to build command: %v", err)
 		}
@@ -89,12 +91,12 @@ func TestFfmpegEditor_extractThumbnail(t *testing.T) {
 			ExtraOptions: "",
 		}
 
-		outputFiles, err := editor.HandleRequest(context.Background(), req)
+		result, err := editor.HandleRequest(context.Background(), &event.Event{Id: uuid.New().String(), EditorRequest: req}, nil)
 		if err != nil {
 			t.Fatalf("Failed to extract thumbnail: %v", err)
 		}
 
-		if _, err := os.Stat(outputFiles[0]); os.IsNotExist(err) {
+		if _, err := os.Stat(result.Files[0]); os.IsNotExist(err) {
 			t.Fatalf("Expected output file '%s' to exist", outputFile)
 		}
 	})
@@ -121,12 +123,12 @@ func TestFfmpegEditor_extractThumbnail(t *testing.T) {
 			Frames:    "1",
 		}
 
-		outputFiles, err := editor.HandleRequest(context.Background(), req)
+		result, err := editor.HandleRequest(context.Background(), &event.Event{Id: uuid.New().String(), EditorRequest: req}, nil)
 		if err != nil {
 			t.Fatalf("Failed to extract thumbnail: %v", err)
 		}
 
-		if _, err := os.Stat(outputFiles[0]); os.IsNotExist(err) {
+		if _, err := os.Stat(result.Files[0]); os.IsNotExist(err) {
 			t.Fatalf("Expected output file '%s' to exist", outputFile)
 		}
 	})
@@ -0,0 +1,46 @@
+package editor
+
+import "errors"
+
+// Error codes reported to webhooks, so clients can tell why a job failed.
+const (
+	CodeInvalidRequest = "invalid_request"
+	CodeTimeout        = "timeout"
+	CodeMemoryLimit    = "memory_limit"
+	CodeCancelled      = "cancelled"
+	CodeFfmpegError    = "ffmpeg_error"
+)
+
+type Error struct {
+	Code string
+	Err  error
+	// Log holds the last lines logged by ffmpeg, when it ran.
+	Log []string
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCode returns the code of err, or an empty string when err does not
+// come from the editor.
+func ErrorCode(err error) string {
+	var editorErr *Error
+	if errors.As(err, &editorErr) {
+		return editorErr.Code
+	}
+	return ""
+}
+
+// ErrorLog returns the last lines logged by ffmpeg before err.
+func ErrorLog(err error) []string {
+	var editorErr *Error
+	if errors.As(err, &editorErr) {
+		return editorErr.Log
+	}
+	return nil
+}
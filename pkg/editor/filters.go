@@ -0,0 +1,234 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+)
+
+const (
+	defaultTextSize      = 48
+	defaultTextColor     = "white"
+	defaultTextBoxColor  = "black@0.5"
+	defaultTextBoxBorder = 10
+)
+
+var (
+	filterOptionEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`)
+	filterGraphEscaper  = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`)
+)
+
+// escapeFilterValue escapes value, such as a path, for an option of a filter
+// of a filter graph: once for the options of the filter, and once more for
+// the graph holding it.
+func escapeFilterValue(value string) string {
+	return filterGraphEscaper.Replace(filterOptionEscaper.Replace(value))
+}
+
+// filterGraph builds the graph of a -filter_complex option, one chain of
+// filters at a time. Chains read and write pads named by their labels, such
+// as "0:v" for the video of the first input.
+type filterGraph struct {
+	chains []string
+	labels int
+}
+
+// chain adds a chain of filters reading the inputs pads to a new pad, whose
+// label it returns.
+func (g *filterGraph) chain(inputs []string, filters ...string) string {
+	output := g.label()
+	g.chainTo(inputs, []string{output}, filters...)
+	return output
+}
+
+// chainTo adds a chain of filters reading the inputs pads to the outputs pads.
+func (g *filterGraph) chainTo(inputs []string, outputs []string, filters ...string) {
+	g.chains = append(g.chains, pads(inputs)+strings.Join(filters, ",")+pads(outputs))
+}
+
+// label returns a new pad label.
+func (g *filterGraph) label() string {
+	g.labels++
+	return fmt.Sprintf("f%d", g.labels)
+}
+
+func (g *filterGraph) String() string {
+	return strings.Join(g.chains, ";")
+}
+
+func pads(labels []string) string {
+	var b strings.Builder
+	for _, label := range labels {
+		fmt.Fprintf(&b, "[%s]", label)
+	}
+	return b.String()
+}
+
+// hasGraphOperations reports whether the request has operations which only
+// a filter graph can apply, such as an overlay or texts.
+func hasGraphOperations(req request.EditorRequest) bool {
+	return req.Overlay != nil || len(req.Texts) > 0 || req.Subtitles != nil
+}
+
+// videoChain adds the filters, the subtitles, the texts and the overlay of
+// the request to the graph, in that order, the video being read from the in
+// pad and the overlay from the input overlayIndex, and returns the pad of the
+// result.
+func (f *FfmpegEditor) videoChain(g *filterGraph, req request.EditorRequest, in string, overlayIndex int) string {
+	var filters []string
+	if userFilters := videoFilters(req.Filters); userFilters != "" {
+		filters = append(filters, userFilters)
+	}
+	if req.Subtitles != nil {
+		filters = append(filters, f.subtitlesFilter(*req.Subtitles))
+	}
+	for _, text := range req.Texts {
+		filters = append(filters, drawTextFilter(text))
+	}
+
+	out := in
+	if len(filters) > 0 {
+		out = g.chain([]string{out}, filters...)
+	}
+	if req.Overlay != nil {
+		out = overlayChain(g, *req.Overlay, out, fmt.Sprintf("%d:v", overlayIndex))
+	}
+	return out
+}
+
+// overlayChain places the image pad over the base pad, after making it
+// translucent and scaling it relative to the base when requested.
+func overlayChain(g *filterGraph, overlay request.Overlay, base string, image string) string {
+	if overlay.Opacity > 0 && overlay.Opacity < 1 {
+		image = g.chain([]string{image}, "format=rgba", fmt.Sprintf("colorchannelmixer=aa=%g", overlay.Opacity))
+	}
+	if overlay.Scale > 0 {
+		scaled, reference := g.label(), g.label()
+		g.chainTo([]string{image, base}, []string{scaled, reference}, fmt.Sprintf("scale2ref=w=main_w*%g:h=ow/a", overlay.Scale))
+		image, base = scaled, reference
+	}
+
+	// W and H are the size of the video, w and h the size of the overlay.
+	x, y := placementPosition(overlay.Placement, "W", "H", "w", "h")
+	return g.chain([]string{base, image}, fmt.Sprintf("overlay=x=%s:y=%s", x, y)+placementEnable(overlay.Placement))
+}
+
+// drawTextFilter draws a text as is, its special characters being escaped
+// and its expansion of %{...} sequences disabled.
+func drawTextFilter(text request.Text) string {
+	options := []string{
+		"text=" + escapeFilterValue(text.Text),
+		"expansion=none",
+	}
+	if text.Font != "" {
+		options = append(options, "fontfile="+escapeFilterValue(text.Font))
+	}
+	options = append(options,
+		fmt.Sprintf("fontsize=%d", valueOrInt(text.Size, defaultTextSize)),
+		"fontcolor="+escapeFilterValue(valueOr(text.Color, defaultTextColor)),
+	)
+	if text.Box {
+		options = append(options,
+			"box=1",
+			"boxcolor="+escapeFilterValue(valueOr(text.BoxColor, defaultTextBoxColor)),
+			fmt.Sprintf("boxborderw=%d", valueOrInt(text.BoxBorder, defaultTextBoxBorder)),
+		)
+	}
+
+	// w and h are the size of the video, text_w and text_h the size of the
+	// text.
+	x, y := placementPosition(text.Placement, "w", "h", "text_w", "text_h")
+	options = append(options, "x="+x, "y="+y)
+	return "drawtext=" + strings.Join(options, ":") + placementEnable(text.Placement)
+}
+
+// subtitlesFilter burns subtitles in, looking for their fonts in the font
+// directory of the editor.
+func (f *FfmpegEditor) subtitlesFilter(subtitles request.Subtitles) string {
+	path, _ := inputPath(subtitles.Input)
+	filter := "subtitles=filename=" + escapeFilterValue(path)
+	if f.fontDir != "" {
+		filter += ":fontsdir=" + escapeFilterValue(f.fontDir)
+	}
+	if subtitles.Style != "" {
+		filter += ":force_style=" + escapeFilterValue(subtitles.Style)
+	}
+	return filter
+}
+
+// placementPosition returns the expressions of the position of an item of
+// itemWidth by itemHeight over a video of width by height.
+func placementPosition(placement request.Placement, width string, height string, itemWidth string, itemHeight string) (string, string) {
+	margin := placement.Margin
+	right := fmt.Sprintf("%s-%s-%d", width, itemWidth, margin)
+	bottom := fmt.Sprintf("%s-%s-%d", height, itemHeight, margin)
+	switch placement.Position {
+	case request.PositionTopLeft:
+		return fmt.Sprint(margin), fmt.Sprint(margin)
+	case request.PositionTopRight:
+		return right, fmt.Sprint(margin)
+	case request.PositionBottomLeft:
+		return fmt.Sprint(margin), bottom
+	case request.PositionCenter:
+		return fmt.Sprintf("(%s-%s)/2", width, itemWidth), fmt.Sprintf("(%s-%s)/2", height, itemHeight)
+	case request.PositionCustom:
+		return fmt.Sprint(placement.X), fmt.Sprint(placement.Y)
+	default:
+		return right, bottom
+	}
+}
+
+// placementEnable returns the option enabling a filter during the time range
+// of its placement, or nothing when it is always enabled.
+func placementEnable(placement request.Placement) string {
+	var enable string
+	switch {
+	case placement.End > 0:
+		enable = fmt.Sprintf("between(t,%g,%g)", placement.Start, placement.End)
+	case placement.Start > 0:
+		enable = fmt.Sprintf("gte(t,%g)", placement.Start)
+	default:
+		return ""
+	}
+	return ":enable=" + escapeFilterValue(enable)
+}
+
+// resolveFonts returns the texts with their fonts replaced by their path in
+// the font directory of the editor.
+func (f *FfmpegEditor) resolveFonts(texts []request.Text) ([]request.Text, error) {
+	resolved := slices.Clone(texts)
+	for i, text := range resolved {
+		if text.Font == "" {
+			continue
+		}
+		if f.fontDir == "" {
+			return nil, fmt.Errorf("texts[%d]: no font directory is configured", i)
+		}
+		if text.Font != filepath.Base(text.Font) || strings.HasPrefix(text.Font, ".") {
+			return nil, fmt.Errorf("texts[%d]: invalid font %q", i, text.Font)
+		}
+		path := filepath.Join(f.fontDir, text.Font)
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("texts[%d]: font %q not found", i, text.Font)
+		}
+		resolved[i].Font = path
+	}
+	return resolved, nil
+}
+
+// overlayInputArgs returns the arguments reading the overlay of the request,
+// if any, as the next input.
+func overlayInputArgs(req request.EditorRequest) ([]string, error) {
+	if req.Overlay == nil {
+		return nil, nil
+	}
+	path, err := inputPath(req.Overlay.Input)
+	if err != nil {
+		return nil, fmt.Errorf("overlay: %w", err)
+	}
+	return []string{"-i", path}, nil
+}
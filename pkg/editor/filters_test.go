@@ -0,0 +1,116 @@
+package editor
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeFilterValue(t *testing.T) {
+	t.Run("Given special characters, it should escape them for the filter and the graph", func(t *testing.T) {
+		assert.Equal(t, `/out/a\\:b\,c\\\\d`, escapeFilterValue(`/out/a:b,c\d`))
+		assert.Equal(t, `it\\\'s`, escapeFilterValue(`it's`))
+	})
+}
+
+func TestOverlayChain(t *testing.T) {
+	t.Run("Given the default position, it should place the overlay in the bottom right corner", func(t *testing.T) {
+		graph := &filterGraph{}
+		out := overlayChain(graph, request.Overlay{Placement: request.Placement{Margin: 10}}, "0:v", "1:v")
+		assert.Equal(t, "f1", out)
+		assert.Equal(t, "[0:v][1:v]overlay=x=W-w-10:y=H-h-10[f1]", graph.String())
+	})
+
+	t.Run("Given an opacity, a scale and a time range, it should chain them before the overlay", func(t *testing.T) {
+		graph := &filterGraph{}
+		overlayChain(graph, request.Overlay{Placement: request.Placement{Position: request.PositionTopLeft, Margin: 20, Start: 1, End: 5.5}, Opacity: 0.5, Scale: 0.2}, "0:v", "1:v")
+		assert.Equal(t, "[1:v]format=rgba,colorchannelmixer=aa=0.5[f1];"+
+			"[f1][0:v]scale2ref=w=main_w*0.2:h=ow/a[f2][f3];"+
+			`[f3][f2]overlay=x=20:y=20:enable=between(t\,1\,5.5)[f4]`, graph.String())
+	})
+
+	t.Run("Given each position, it should return its coordinates", func(t *testing.T) {
+		for position, expected := range map[string][2]string{
+			request.PositionTopRight:   {"W-w-5", "5"},
+			request.PositionBottomLeft: {"5", "H-h-5"},
+			request.PositionCenter:     {"(W-w)/2", "(H-h)/2"},
+		} {
+			x, y := placementPosition(request.Placement{Position: position, Margin: 5}, "W", "H", "w", "h")
+			assert.Equal(t, expected, [2]string{x, y}, position)
+		}
+		x, y := placementPosition(request.Placement{Position: request.PositionCustom, X: 12, Y: 34}, "W", "H", "w", "h")
+		assert.Equal(t, [2]string{"12", "34"}, [2]string{x, y})
+	})
+}
+
+func TestDrawTextFilter(t *testing.T) {
+	t.Run("Given a text with special characters, it should escape it and disable its expansion", func(t *testing.T) {
+		filter := drawTextFilter(request.Text{Text: `It's 100%: a, b; [c] \ d`, Font: "/fonts/Roboto Bold.ttf"})
+		assert.Equal(t, `drawtext=text=It\\\'s 100%\\: a\, b\; \[c\] \\\\ d:expansion=none:fontfile=/fonts/Roboto Bold.ttf:`+
+			`fontsize=48:fontcolor=white:x=w-text_w-0:y=h-text_h-0`, filter)
+	})
+
+	t.Run("Given a box and a time range, it should draw the box while the text is shown", func(t *testing.T) {
+		filter := drawTextFilter(request.Text{
+			Text: "Title", Size: 64, Color: "#ffcc00", Box: true,
+			Placement: request.Placement{Position: request.PositionTopLeft, Margin: 24, End: 3},
+		})
+		assert.Equal(t, `drawtext=text=Title:expansion=none:fontsize=64:fontcolor=#ffcc00:box=1:boxcolor=black@0.5:boxborderw=10:`+
+			`x=24:y=24:enable=between(t\,0\,3)`, filter)
+	})
+}
+
+func TestFfmpegEditor_resolveFonts(t *testing.T) {
+	fontDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(fontDir, "Roboto.ttf"), nil, 0o644))
+	editor := &FfmpegEditor{fontDir: fontDir}
+
+	t.Run("Given fonts of the font directory, it should return their path", func(t *testing.T) {
+		texts, err := editor.resolveFonts([]request.Text{{Text: "a", Font: "Roboto.ttf"}, {Text: "b"}})
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(fontDir, "Roboto.ttf"), texts[0].Font)
+		assert.Empty(t, texts[1].Font)
+	})
+
+	t.Run("Given missing fonts or fonts outside of the font directory, it should fail", func(t *testing.T) {
+		for _, font := range []string{"Missing.ttf", "../Roboto.ttf", "/etc/Roboto.ttf"} {
+			_, err := editor.resolveFonts([]request.Text{{Text: "a", Font: font}})
+			assert.Error(t, err, font)
+		}
+	})
+}
+
+func TestFfmpegEditor_subtitlesFilter(t *testing.T) {
+	t.Run("Given subtitles, it should burn them in with the fonts of the font directory", func(t *testing.T) {
+		editor := &FfmpegEditor{fontDir: "/fonts"}
+		filter := editor.subtitlesFilter(request.Subtitles{Input: request.Input{FileURL: "https://example.com/captions.srt"}, Style: "FontName=Roboto,FontSize=24"})
+		assert.Equal(t, `subtitles=filename=https\\://example.com/captions.srt:fontsdir=/fonts:force_style=FontName=Roboto\,FontSize=24`, filter)
+	})
+}
+
+func TestFfmpegEditor_buildCommandWithOverlay(t *testing.T) {
+	editor := NewFFMpegEditor(&configuration.Configuration{
+		Logger: slog.Default(),
+		Ffmpeg: configuration.FfmpegConfig{Path: ffmpegLocation},
+	}).(*FfmpegEditor)
+
+	t.Run("Given an overlay, it should read it as a second input and map the graph output", func(t *testing.T) {
+		cmd, err := editor.buildCommand(request.EditorRequest{
+			Input:   request.Input{UploadedFilePath: "input.mp4"},
+			Filters: map[string]string{"scale": "1280:-2"},
+			Overlay: &request.Overlay{Input: request.Input{FileURL: "https://example.com/logo.png"}, Placement: request.Placement{Position: request.PositionCenter, Start: 2}},
+			Output:  request.Output{FilePattern: "output.mp4"},
+		}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			ffmpegLocation, "-y", "-i", "input.mp4", "-i", "https://example.com/logo.png",
+			"-filter_complex", "[0:v]scale=1280:-2[f1];[f1][1:v]overlay=x=(W-w)/2:y=(H-h)/2:enable=gte(t\\,2)[f2]",
+			"-map", "[f2]", "-map", "0:a?", "output.mp4",
+		}, cmd.Args)
+	})
+}
@@ -0,0 +1,121 @@
+//go:build linux
+
+package editor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandbox applies the nice level and memory limit of a job to its ffmpeg
+// process. Memory is limited by a cgroup v2 created for the job under the
+// configured cgroup, which must be delegated to the worker, and falls back to
+// the address space rlimit.
+type sandbox struct {
+	f        *FfmpegEditor
+	cgroup   string
+	cgroupFD *os.File
+}
+
+func (f *FfmpegEditor) newSandbox(id string) *sandbox {
+	s := &sandbox{f: f}
+	if f.memoryLimit <= 0 || f.cgroupPath == "" {
+		return s
+	}
+
+	dir := filepath.Join(f.cgroupPath, fmt.Sprintf("ffmpeg-%s", id))
+	err := os.Mkdir(dir, 0o755)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "memory.max"), []byte(strconv.FormatInt(f.memoryLimit, 10)), 0o644)
+		if err == nil {
+			s.cgroupFD, err = os.Open(dir)
+		}
+		if err != nil {
+			_ = os.Remove(dir)
+		}
+	}
+	if err != nil {
+		f.logger.Warn("Failed to create cgroup, limiting memory with rlimit", "error", err, "cgroup", dir)
+		return s
+	}
+
+	s.cgroup = dir
+	return s
+}
+
+// prepare places the process in the cgroup of the job as it is created.
+func (s *sandbox) prepare(cmd *exec.Cmd) {
+	if s.cgroupFD == nil {
+		return
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		UseCgroupFD: true,
+		CgroupFD:    int(s.cgroupFD.Fd()),
+	}
+}
+
+// started applies the limits that can only be set once the process exists.
+func (s *sandbox) started(pid int) {
+	if s.f.nice != 0 {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, pid, s.f.nice); err != nil {
+			s.f.logger.Warn("Failed to set nice level", "error", err, "nice", s.f.nice)
+		}
+	}
+
+	if s.f.memoryLimit > 0 && s.cgroup == "" {
+		limit := uint64(s.f.memoryLimit)
+		if err := unix.Prlimit(pid, unix.RLIMIT_AS, &unix.Rlimit{Cur: limit, Max: limit}, nil); err != nil {
+			s.f.logger.Warn("Failed to set memory limit", "error", err)
+		}
+	}
+}
+
+// outOfMemory reports whether the process failed because of the memory
+// limit, as counted by the cgroup or as reported by ffmpeg once an
+// allocation is refused by the rlimit.
+func (s *sandbox) outOfMemory(stderr string) bool {
+	if s.f.memoryLimit <= 0 {
+		return false
+	}
+	if s.cgroup != "" {
+		return oomKills(filepath.Join(s.cgroup, "memory.events")) > 0
+	}
+	return strings.Contains(stderr, "Cannot allocate memory") || strings.Contains(strings.ToLower(stderr), "out of memory")
+}
+
+func (s *sandbox) close() {
+	if s.cgroupFD != nil {
+		s.cgroupFD.Close()
+	}
+	if s.cgroup != "" {
+		if err := os.Remove(s.cgroup); err != nil {
+			s.f.logger.Warn("Failed to remove cgroup", "error", err, "cgroup", s.cgroup)
+		}
+	}
+}
+
+func oomKills(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		name, value, _ := strings.Cut(scanner.Text(), " ")
+		if name == "oom_kill" {
+			kills, _ := strconv.Atoi(value)
+			return kills
+		}
+	}
+	return 0
+}
@@ -0,0 +1,21 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOomKills(t *testing.T) {
+	t.Run("Given the memory events of a cgroup, it should return its oom kills", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "memory.events")
+		events := "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\noom_group_kill 0\n"
+		if err := os.WriteFile(path, []byte(events), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if kills := oomKills(path); kills != 1 {
+			t.Errorf("Expected 1 oom kill; got %v", kills)
+		}
+	})
+}
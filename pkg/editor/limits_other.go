@@ -0,0 +1,26 @@
+//go:build !linux
+
+package editor
+
+import "os/exec"
+
+// sandbox only limits the wall clock time of jobs outside of linux, nice
+// levels and memory limits being ignored.
+type sandbox struct{}
+
+func (f *FfmpegEditor) newSandbox(id string) *sandbox {
+	if f.nice != 0 || f.memoryLimit > 0 {
+		f.logger.Warn("Nice levels and memory limits are only supported on linux")
+	}
+	return &sandbox{}
+}
+
+func (s *sandbox) prepare(cmd *exec.Cmd) {}
+
+func (s *sandbox) started(pid int) {}
+
+func (s *sandbox) outOfMemory(stderr string) bool {
+	return false
+}
+
+func (s *sandbox) close() {}
@@ -0,0 +1,96 @@
+package editor
+
+import (
+	"context"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/joblog"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+)
+
+func TestFfmpegEditor_getTimeout(t *testing.T) {
+	editor := &FfmpegEditor{logger: slog.Default(), timeout: time.Minute, maxTimeout: time.Hour}
+
+	for _, tt := range []struct {
+		requested string
+		expected  time.Duration
+	}{
+		{"", time.Minute},
+		{"30m", 30 * time.Minute},
+		{"2h", time.Hour},
+	} {
+		timeout, err := editor.getTimeout(request.EditorRequest{Timeout: tt.requested})
+		if err != nil {
+			t.Fatalf("Failed to get timeout: %v", err)
+		}
+		if timeout != tt.expected {
+			t.Errorf("Expected timeout %v for %q; got %v", tt.expected, tt.requested, timeout)
+		}
+	}
+
+	if _, err := editor.getTimeout(request.EditorRequest{Timeout: "soon"}); err == nil {
+		t.Errorf("Expected an error for an invalid timeout")
+	}
+}
+
+func TestFfmpegEditor_run(t *testing.T) {
+	editor := &FfmpegEditor{logger: slog.Default(), threads: 2}
+	log, err := joblog.Create("", "job", 0, 10)
+	if err != nil {
+		t.Fatalf("Failed to create log: %v", err)
+	}
+
+	t.Run("Given a process running past its timeout, it should be killed with the timeout code", func(t *testing.T) {
+		err := editor.run(context.Background(), "job", exec.Command("sleep", "5"), log, 50*time.Millisecond, nil)
+		if ErrorCode(err) != CodeTimeout {
+			t.Errorf("Expected code %q; got %v", CodeTimeout, err)
+		}
+	})
+
+	t.Run("Given a cancelled job, it should be killed with the cancelled code", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		err := editor.run(ctx, "job", exec.Command("sleep", "5"), log, time.Minute, nil)
+		if ErrorCode(err) != CodeCancelled {
+			t.Errorf("Expected code %q; got %v", CodeCancelled, err)
+		}
+	})
+
+	t.Run("Given a failing process, it should return the ffmpeg error code", func(t *testing.T) {
+		err := editor.run(context.Background(), "job", exec.Command("false"), log, 0, nil)
+		if ErrorCode(err) != CodeFfmpegError {
+			t.Errorf("Expected code %q; got %v", CodeFfmpegError, err)
+		}
+	})
+
+	t.Run("Given a process with its own stderr, it should write the output to it as well", func(t *testing.T) {
+		var stderr strings.Builder
+		cmd := exec.Command("sh", "-c", "echo stats >&2")
+		cmd.Stderr = &stderr
+		if err := editor.run(context.Background(), "job", cmd, log, 0, nil); err != nil {
+			t.Fatalf("Failed to run command: %v", err)
+		}
+		if stderr.String() != "stats\n" {
+			t.Errorf("Expected the output in stderr; got %q", stderr.String())
+		}
+	})
+
+	t.Run("Given a thread limit, it should pass it to ffmpeg", func(t *testing.T) {
+		cmd, err := editor.buildCommand(request.EditorRequest{
+			Input:  request.Input{FileURL: "https://example.com/video.mp4"},
+			Output: request.Output{FilePattern: "output.mp4"},
+		}, nil)
+		if err != nil {
+			t.Fatalf("Failed to build command: %v", err)
+		}
+		if !slices.Contains(cmd.Args, "-threads") || cmd.Args[len(cmd.Args)-2] != "2" {
+			t.Errorf("Expected -threads 2 before the output; got %v", cmd.Args)
+		}
+	})
+}
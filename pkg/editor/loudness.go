@@ -0,0 +1,182 @@
+package editor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/joblog"
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+)
+
+const (
+	defaultIntegratedLoudness = -23
+	defaultTruePeak           = -1
+	defaultLoudnessRange      = 7
+	// loudnorm resamples the audio to 192 kHz, which most audio codecs do
+	// not support.
+	loudnormSampleRate = 48000
+)
+
+// resolveLoudness checks the request has audio to normalize. The
+// normalization of an input without audio is dropped, while the audio it is
+// replaced or mixed with must exist.
+func (f *FfmpegEditor) resolveLoudness(ctx context.Context, req request.EditorRequest) (request.EditorRequest, error) {
+	if req.Audio != nil && req.Audio.Mode == request.AudioReplace {
+		if !f.hasAudio(ctx, req.Audio.Input) {
+			return req, fmt.Errorf("field audio.input has no audio to normalize")
+		}
+		return req, nil
+	}
+
+	if !f.hasAudio(ctx, req.Input) {
+		if req.Audio != nil {
+			return req, fmt.Errorf("field input has no audio to mix with field audio")
+		}
+		f.logger.Warn("Skipping the loudness normalization of an input without audio")
+		req.Loudness = nil
+	}
+	return req, nil
+}
+
+// measureLoudness runs the first pass of loudness normalization, measuring
+// the loudness of the audio of the request with loudnorm. Silent audio
+// cannot be normalized, no stats are returned for it.
+func (f *FfmpegEditor) measureLoudness(ctx context.Context, id string, req request.EditorRequest, log *joblog.Writer, timeout time.Duration, onProgress ProgressFunc) (*media.LoudnessStats, error) {
+	cmd, err := f.buildLoudnessCommand(req)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidRequest, Err: err}
+	}
+	stats := &loudnormStats{}
+	cmd.Stderr = stats.logWriter()
+	if err := f.run(ctx, id, cmd, log, timeout, onProgress); err != nil {
+		return nil, err
+	}
+
+	loudness, err := media.ParseLoudnorm(stats.json())
+	if errors.Is(err, media.ErrSilent) {
+		f.logger.Warn("Skipping the loudness normalization of silent audio", "job_id", id)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &Error{Code: CodeFfmpegError, Err: err}
+	}
+	return loudness, nil
+}
+
+// buildLoudnessCommand measures the audio the request outputs: its mix with
+// the background music, the audio replacing its own, or its own audio.
+// Looped audio is measured once, repeating it keeping its loudness.
+func (f *FfmpegEditor) buildLoudnessCommand(req request.EditorRequest) (*exec.Cmd, error) {
+	filter := loudnormFilter(*req.Loudness, nil) + ":print_format=json"
+
+	var args []string
+	switch {
+	case req.Audio != nil && req.Audio.Mode == request.AudioReplace:
+		path, err := inputPath(req.Audio.Input)
+		if err != nil {
+			return nil, fmt.Errorf("audio: %w", err)
+		}
+		args = []string{"-y", "-i", path, "-map", "0:a:0", "-af", filter}
+	case req.Audio != nil && req.Audio.Mode == request.AudioMix:
+		var err error
+		if args, err = inputArgs(req); err != nil {
+			return nil, err
+		}
+		audioArgs, err := audioInputArgs(req)
+		if err != nil {
+			return nil, err
+		}
+		graph := &filterGraph{}
+		out := graph.chain([]string{mixChain(graph, *req.Audio, "0:a", "1:a")}, filter)
+		args = append(args, audioArgs...)
+		args = append(args, "-filter_complex", graph.String(), "-map", "["+out+"]")
+	default:
+		var err error
+		if args, err = inputArgs(req); err != nil {
+			return nil, err
+		}
+		args = append(args, "-map", "0:a:0", "-af", filter)
+	}
+
+	if f.threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(f.threads))
+	}
+	args = append(args, "-f", "null", "-")
+	return exec.Command(f.BinaryPath, args...), nil
+}
+
+// loudnormFilter returns the loudnorm filter normalizing the audio to the
+// targets of loudness, linearly from the stats of the first pass when
+// measured is set.
+func loudnormFilter(loudness request.Loudness, measured *media.LoudnessStats) string {
+	integrated := loudness.Integrated
+	if integrated == 0 {
+		integrated = defaultIntegratedLoudness
+	}
+	truePeak := loudness.TruePeak
+	if truePeak == 0 {
+		truePeak = defaultTruePeak
+	}
+	loudnessRange := loudness.Range
+	if loudnessRange == 0 {
+		loudnessRange = defaultLoudnessRange
+	}
+
+	filter := fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g", integrated, truePeak, loudnessRange)
+	if measured != nil {
+		filter += fmt.Sprintf(":measured_I=%g:measured_TP=%g:measured_LRA=%g:measured_thresh=%g:offset=%g:linear=true",
+			measured.InputIntegrated, measured.InputTruePeak, measured.InputRange, measured.InputThreshold, measured.TargetOffset)
+	}
+	return filter
+}
+
+// loudnessFilters returns the filters normalizing the audio in the second
+// pass, none when the request is not normalized.
+func loudnessFilters(req request.EditorRequest, measured *media.LoudnessStats) []string {
+	if req.Loudness == nil {
+		return nil
+	}
+	return []string{loudnormFilter(*req.Loudness, measured), fmt.Sprintf("aresample=%d", loudnormSampleRate)}
+}
+
+// loudnormStats keeps the last JSON object loudnorm prints on its own lines
+// at the end of its pass.
+type loudnormStats struct {
+	mu     sync.Mutex
+	inside bool
+	lines  []string
+	last   string
+}
+
+func (s *loudnormStats) logWriter() *lineWriter {
+	return &lineWriter{fn: func(line string) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "{":
+			s.inside = true
+			s.lines = []string{line}
+		case s.inside:
+			s.lines = append(s.lines, line)
+			if line == "}" {
+				s.inside = false
+				s.last = strings.Join(s.lines, "\n")
+			}
+		}
+	}}
+}
+
+func (s *loudnormStats) json() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return []byte(s.last)
+}
@@ -0,0 +1,172 @@
+package editor
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/joblog"
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoudnormFilter(t *testing.T) {
+	t.Run("Given no targets, it should normalize to the EBU R128 defaults", func(t *testing.T) {
+		assert.Equal(t, "loudnorm=I=-23:TP=-1:LRA=7", loudnormFilter(request.Loudness{}, nil))
+	})
+
+	t.Run("Given measured stats, it should normalize linearly from them", func(t *testing.T) {
+		filter := loudnormFilter(request.Loudness{Integrated: -16, TruePeak: -1.5, Range: 11}, &media.LoudnessStats{
+			InputIntegrated: -27.61, InputTruePeak: -4.47, InputRange: 18.06, InputThreshold: -39.2, TargetOffset: 0.04,
+		})
+		assert.Equal(t, "loudnorm=I=-16:TP=-1.5:LRA=11:measured_I=-27.61:measured_TP=-4.47:measured_LRA=18.06:"+
+			"measured_thresh=-39.2:offset=0.04:linear=true", filter)
+	})
+}
+
+func TestLoudnormStats(t *testing.T) {
+	t.Run("Given the log of the first pass, it should keep the stats printed by loudnorm", func(t *testing.T) {
+		stats := &loudnormStats{}
+		writer := stats.logWriter()
+		_, _ = writer.Write([]byte("size=N/A time=00:00:10.00 bitrate=N/A speed= 250x\r[Parsed_loudnorm_0 @ 0x5581] \n{\n"))
+		_, _ = writer.Write([]byte("\t\"input_i\" : \"-27.61\",\n\t\"target_offset\" : \"0.04\"\n}\n"))
+		assert.Equal(t, "{\n\"input_i\" : \"-27.61\",\n\"target_offset\" : \"0.04\"\n}", string(stats.json()))
+	})
+}
+
+func TestFfmpegEditor_buildLoudnessCommand(t *testing.T) {
+	editor := NewFFMpegEditor(&configuration.Configuration{
+		Logger: slog.Default(),
+		Ffmpeg: configuration.FfmpegConfig{Path: ffmpegLocation},
+	}).(*FfmpegEditor)
+
+	t.Run("Given a request, it should measure its audio from its start time", func(t *testing.T) {
+		cmd, err := editor.buildLoudnessCommand(request.EditorRequest{
+			Input:     request.Input{UploadedFilePath: "input.mp4"},
+			StartTime: "5",
+			Loudness:  &request.Loudness{},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			ffmpegLocation, "-y", "-ss", "5", "-i", "input.mp4",
+			"-map", "0:a:0", "-af", "loudnorm=I=-23:TP=-1:LRA=7:print_format=json", "-f", "null", "-",
+		}, cmd.Args)
+	})
+
+	t.Run("Given a mix operation, it should measure the mixed audio", func(t *testing.T) {
+		cmd, err := editor.buildLoudnessCommand(request.EditorRequest{
+			Input:    request.Input{UploadedFilePath: "input.mp4"},
+			Audio:    &request.Audio{Mode: request.AudioMix, Input: request.Input{UploadedFilePath: "music.mp3"}, Loop: true},
+			Loudness: &request.Loudness{},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			ffmpegLocation, "-y", "-i", "input.mp4", "-stream_loop", "-1", "-i", "music.mp3",
+			"-filter_complex", "[0:a][1:a]amix=inputs=2:duration=first:dropout_transition=0:normalize=0[f1];" +
+				"[f1]loudnorm=I=-23:TP=-1:LRA=7:print_format=json[f2]",
+			"-map", "[f2]", "-f", "null", "-",
+		}, cmd.Args)
+	})
+}
+
+func TestFfmpegEditor_buildCommandWithLoudness(t *testing.T) {
+	editor := NewFFMpegEditor(&configuration.Configuration{
+		Logger: slog.Default(),
+		Ffmpeg: configuration.FfmpegConfig{Path: ffmpegLocation},
+	}).(*FfmpegEditor)
+	measured := &media.LoudnessStats{InputIntegrated: -30, InputTruePeak: -6, InputRange: 5, InputThreshold: -40, TargetOffset: 0.5}
+
+	t.Run("Given measured stats, it should normalize the audio and resample it", func(t *testing.T) {
+		cmd, err := editor.buildCommand(request.EditorRequest{
+			Input:    request.Input{UploadedFilePath: "input.mp4"},
+			Loudness: &request.Loudness{Integrated: -16},
+			Output:   request.Output{FilePattern: "output.mp4"},
+		}, measured)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			ffmpegLocation, "-y", "-i", "input.mp4",
+			"-af", "loudnorm=I=-16:TP=-1:LRA=7:measured_I=-30:measured_TP=-6:measured_LRA=5:measured_thresh=-40:offset=0.5:linear=true,aresample=48000",
+			"output.mp4",
+		}, cmd.Args)
+	})
+}
+
+func TestFfmpegEditor_resolveLoudness(t *testing.T) {
+	ctx := context.Background()
+	editor := newProbedEditor(t, "h264")
+
+	t.Run("Given an input without audio, it should not normalize it", func(t *testing.T) {
+		req, err := editor.resolveLoudness(ctx, request.EditorRequest{
+			Input:    request.Input{UploadedFilePath: "input.mp4"},
+			Loudness: &request.Loudness{},
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, req.Loudness)
+	})
+
+	t.Run("Given audio without any to replace it with or to mix with, it should fail", func(t *testing.T) {
+		_, err := editor.resolveLoudness(ctx, request.EditorRequest{
+			Input:    request.Input{UploadedFilePath: "input.mp4"},
+			Audio:    &request.Audio{Mode: request.AudioReplace, Input: request.Input{UploadedFilePath: "video.mp4"}},
+			Loudness: &request.Loudness{},
+		})
+		assert.ErrorContains(t, err, "audio.input has no audio")
+
+		_, err = editor.resolveLoudness(ctx, request.EditorRequest{
+			Input:    request.Input{UploadedFilePath: "input.mp4"},
+			Audio:    &request.Audio{Mode: request.AudioMix, Input: request.Input{UploadedFilePath: "music.mp3"}},
+			Loudness: &request.Loudness{},
+		})
+		assert.ErrorContains(t, err, "input has no audio")
+	})
+}
+
+func TestFfmpegEditor_HandleRequestLoudness(t *testing.T) {
+	t.Run("Given silent audio, it should keep it as is and log both passes", func(t *testing.T) {
+		dir := t.TempDir()
+		calls := filepath.Join(dir, "calls.txt")
+		binary := filepath.Join(dir, "ffmpeg")
+		script := "#!/bin/sh\necho \"$@\" >> " + calls + "\n" +
+			"case \"$*\" in\n" +
+			"*print_format=json*)\n" +
+			"\techo 'measuring' >&2\n" +
+			"\tprintf '{\\n\"input_i\" : \"-inf\",\\n\"input_tp\" : \"-inf\",\\n\"target_offset\" : \"inf\"\\n}\\n' >&2\n" +
+			"\t;;\n" +
+			"*)\n" +
+			"\techo 'encoding' >&2\n" +
+			"\tfor last; do :; done\n\ttouch \"$last\"\n" +
+			"\t;;\n" +
+			"esac\n"
+		assert.NoError(t, os.WriteFile(binary, []byte(script), 0o755))
+
+		cfg := &configuration.Configuration{
+			Logger:     slog.Default(),
+			OutputPath: filepath.Join(dir, "output"),
+			StatePath:  filepath.Join(dir, "state"),
+			Ffmpeg:     configuration.FfmpegConfig{Path: binary},
+		}
+		result, err := NewFFMpegEditor(cfg).HandleRequest(context.Background(), &event.Event{Id: "job", EditorRequest: request.EditorRequest{
+			Input:    request.Input{UploadedFilePath: "input.mp4"},
+			Loudness: &request.Loudness{},
+			Output:   request.Output{FilePattern: "video.mp4"},
+		}}, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, result.Loudness)
+
+		content, err := os.ReadFile(calls)
+		assert.NoError(t, err)
+		passes := strings.Split(strings.TrimSpace(string(content)), "\n")
+		assert.Len(t, passes, 2)
+		assert.NotContains(t, passes[1], "loudnorm")
+
+		log, err := os.ReadFile(joblog.Path(joblog.Dir(cfg.StatePath), "job"))
+		assert.NoError(t, err)
+		assert.Regexp(t, `(?s)^\[pass 1/2\]\nmeasuring\n.*\[pass 2/2\]\nencoding\n$`, string(log))
+	})
+}
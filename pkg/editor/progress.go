@@ -0,0 +1,164 @@
+package editor
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress of a running job.
+type Progress struct {
+	// Processed is the position reached in the output.
+	Processed time.Duration
+	// Percent of the input processed, zero while its duration is unknown.
+	Percent float64
+}
+
+type ProgressFunc func(Progress)
+
+// scaleProgress reports the progress of one of the passes of a job, which
+// goes from offset to offset+share percent of the whole job.
+func scaleProgress(onProgress ProgressFunc, offset float64, share float64) ProgressFunc {
+	if onProgress == nil {
+		return nil
+	}
+	return func(progress Progress) {
+		progress.Percent = offset + progress.Percent*share/100
+		onProgress(progress)
+	}
+}
+
+// passes splits the progress and the time limit of a job between the count
+// passes it runs one after the other.
+type passes struct {
+	count      int
+	done       int
+	deadline   time.Time
+	onProgress ProgressFunc
+}
+
+func newPasses(count int, timeout time.Duration, onProgress ProgressFunc) *passes {
+	p := &passes{count: count, onProgress: onProgress}
+	if timeout > 0 {
+		p.deadline = time.Now().Add(timeout)
+	}
+	return p
+}
+
+// next returns the progress function of the next pass.
+func (p *passes) next() ProgressFunc {
+	share := 100 / float64(p.count)
+	onProgress := scaleProgress(p.onProgress, float64(p.done)*share, share)
+	p.done++
+	return onProgress
+}
+
+// logHeader writes the header of the next pass to log, telling apart the
+// output of the passes of jobs running several.
+func (p *passes) logHeader(log io.Writer) {
+	if p.count > 1 {
+		fmt.Fprintf(log, "[pass %d/%d]\n", p.done+1, p.count)
+	}
+}
+
+// timeout returns the time left to the job, or zero when it has no limit.
+func (p *passes) timeout() time.Duration {
+	if p.deadline.IsZero() {
+		return 0
+	}
+	return max(time.Until(p.deadline), time.Millisecond)
+}
+
+var durationRegex = regexp.MustCompile(`Duration: (\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+
+// progressTracker follows the updates ffmpeg writes with "-progress pipe:1",
+// and the input duration it logs, to report the progress of a job.
+type progressTracker struct {
+	mu         sync.Mutex
+	duration   time.Duration
+	processed  time.Duration
+	onProgress ProgressFunc
+}
+
+func newProgressTracker(onProgress ProgressFunc) *progressTracker {
+	return &progressTracker{onProgress: onProgress}
+}
+
+// progressWriter parses the key=value lines of -progress, each block ending
+// with a "progress" key.
+func (p *progressTracker) progressWriter() *lineWriter {
+	return &lineWriter{fn: func(line string) {
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "out_time_us", "out_time_ms":
+			// out_time_ms is in microseconds as well.
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				p.mu.Lock()
+				p.processed = time.Duration(us) * time.Microsecond
+				p.mu.Unlock()
+			}
+		case "progress":
+			p.report(value == "end")
+		}
+	}}
+}
+
+// logWriter looks for the duration of the input in the log of ffmpeg.
+func (p *progressTracker) logWriter() *lineWriter {
+	return &lineWriter{fn: func(line string) {
+		match := durationRegex.FindStringSubmatch(line)
+		if match == nil {
+			return
+		}
+		hours, _ := strconv.Atoi(match[1])
+		minutes, _ := strconv.Atoi(match[2])
+		seconds, _ := strconv.ParseFloat(match[3], 64)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.duration == 0 {
+			p.duration = time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second))
+		}
+	}}
+}
+
+func (p *progressTracker) report(end bool) {
+	p.mu.Lock()
+	progress := Progress{Processed: p.processed}
+	if end {
+		progress.Percent = 100
+	} else if p.duration > 0 {
+		progress.Percent = min(100, 100*p.processed.Seconds()/p.duration.Seconds())
+	}
+	p.mu.Unlock()
+
+	p.onProgress(progress)
+}
+
+// lineWriter calls fn with each line written to it.
+type lineWriter struct {
+	mu      sync.Mutex
+	current strings.Builder
+	fn      func(line string)
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, b := range p {
+		if b != '\n' && b != '\r' {
+			l.current.WriteByte(b)
+			continue
+		}
+		if l.current.Len() > 0 {
+			l.fn(l.current.String())
+			l.current.Reset()
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,80 @@
+package editor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressTracker(t *testing.T) {
+	t.Run("Given ffmpeg progress updates, it should report the percent of the input processed", func(t *testing.T) {
+		var reports []Progress
+		tracker := newProgressTracker(func(p Progress) {
+			reports = append(reports, p)
+		})
+
+		_, _ = tracker.logWriter().Write([]byte("Input #0, mov,mp4\n  Duration: 00:00:10.00, start: 0.000000, bitrate: 120 kb/s\n"))
+		progress := tracker.progressWriter()
+		_, _ = progress.Write([]byte("frame=25\nout_time_us=2500000\nprogress=continue\n"))
+		_, _ = progress.Write([]byte("out_time_us=10000000\nprogress=end\n"))
+
+		if len(reports) != 2 {
+			t.Fatalf("Expected 2 progress reports; got %v", reports)
+		}
+		if reports[0].Percent != 25 || reports[0].Processed != 2500*time.Millisecond {
+			t.Errorf("Expected 25%% after 2.5s; got %+v", reports[0])
+		}
+		if reports[1].Percent != 100 {
+			t.Errorf("Expected 100%% at the end; got %+v", reports[1])
+		}
+	})
+}
+
+func TestScaleProgress(t *testing.T) {
+	t.Run("Given the second of two passes, it should report the second half of the job", func(t *testing.T) {
+		var reports []Progress
+		onProgress := scaleProgress(func(p Progress) {
+			reports = append(reports, p)
+		}, 50, 50)
+
+		onProgress(Progress{Percent: 0})
+		onProgress(Progress{Percent: 100})
+		if len(reports) != 2 || reports[0].Percent != 50 || reports[1].Percent != 100 {
+			t.Errorf("Expected 50%% then 100%%; got %v", reports)
+		}
+	})
+
+	t.Run("Given no progress function, it should return none", func(t *testing.T) {
+		if scaleProgress(nil, 0, 50) != nil {
+			t.Error("Expected no progress function")
+		}
+	})
+}
+
+func TestPasses(t *testing.T) {
+	t.Run("Given three passes, it should report a third of the job per pass", func(t *testing.T) {
+		var reports []float64
+		passes := newPasses(3, 0, func(p Progress) {
+			reports = append(reports, p.Percent)
+		})
+
+		for range 3 {
+			passes.next()(Progress{Percent: 100})
+		}
+		if len(reports) != 3 || reports[0] != 100.0/3 || reports[2] != 100 {
+			t.Errorf("Expected a third of the job per pass; got %v", reports)
+		}
+		if passes.timeout() != 0 {
+			t.Errorf("Expected no timeout; got %v", passes.timeout())
+		}
+	})
+
+	t.Run("Given a timeout, it should leave the remaining time to the next pass", func(t *testing.T) {
+		passes := newPasses(2, time.Minute, nil)
+		if timeout := passes.timeout(); timeout <= 0 || timeout > time.Minute {
+			t.Errorf("Expected at most a minute left; got %v", timeout)
+		}
+		if passes.next() != nil {
+			t.Error("Expected no progress function")
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package editor
+
+import (
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+)
+
+// passLogName is the prefix of the pass log files of two-pass encodes,
+// written to the temp directory of the job.
+const passLogName = "ffmpeg2pass"
+
+// rateControlArgs returns the arguments encoding the video with the rate
+// control of the request, if any. libvpx-vp9 and libaom-av1 only target a
+// constant quality with a zero bitrate, their bitrate capping it otherwise.
+func rateControlArgs(req request.EditorRequest) []string {
+	rateControl := req.RateControl
+	if rateControl == nil {
+		return nil
+	}
+	codec := valueOr(req.Codec, defaultVideoCodec)
+	args := []string{"-c:v", codec}
+
+	switch rateControl.Mode {
+	case request.RateControlCRF:
+		args = append(args, "-crf", strconv.Itoa(rateControl.CRF))
+		if codec == "libvpx-vp9" || codec == "libaom-av1" {
+			args = append(args, "-b:v", valueOr(rateControl.MaxRate, "0"))
+		}
+	case request.RateControlTwoPass:
+		args = append(args, "-b:v", rateControl.Bitrate)
+	}
+	if rateControl.MaxRate != "" {
+		args = append(args, "-maxrate", rateControl.MaxRate, "-bufsize", rateControl.BufSize)
+	}
+	return args
+}
+
+// isTwoPass reports whether the video of the request is encoded in two
+// passes.
+func isTwoPass(req request.EditorRequest) bool {
+	return req.RateControl != nil && req.RateControl.Mode == request.RateControlTwoPass
+}
+
+// twoPassCommands returns the passes of a two-pass encode of cmd, sharing
+// the pass log files starting with passLog. The first pass only analyzes the
+// video, discarding its output.
+func twoPassCommands(cmd *exec.Cmd, passLog string) (*exec.Cmd, *exec.Cmd) {
+	output := len(cmd.Args) - 1
+	args := cmd.Args[1:output]
+
+	first := slices.Concat(args, []string{"-pass", "1", "-passlogfile", passLog, "-f", "null", os.DevNull})
+	second := slices.Concat(args, []string{"-pass", "2", "-passlogfile", passLog, cmd.Args[output]})
+	return exec.Command(cmd.Args[0], first...), exec.Command(cmd.Args[0], second...)
+}
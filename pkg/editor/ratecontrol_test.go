@@ -0,0 +1,102 @@
+package editor
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateControlArgs(t *testing.T) {
+	t.Run("Given a constrained CRF, it should cap the quality of the default codec", func(t *testing.T) {
+		args := rateControlArgs(request.EditorRequest{RateControl: &request.RateControl{Mode: request.RateControlCRF, CRF: 23, MaxRate: "3M", BufSize: "6M"}})
+		assert.Equal(t, []string{"-c:v", "libx264", "-crf", "23", "-maxrate", "3M", "-bufsize", "6M"}, args)
+	})
+
+	t.Run("Given a CRF with libvpx-vp9, it should target the quality with a zero bitrate", func(t *testing.T) {
+		args := rateControlArgs(request.EditorRequest{Codec: "libvpx-vp9", RateControl: &request.RateControl{Mode: request.RateControlCRF, CRF: 31}})
+		assert.Equal(t, []string{"-c:v", "libvpx-vp9", "-crf", "31", "-b:v", "0"}, args)
+	})
+
+	t.Run("Given a two-pass encode, it should target its bitrate", func(t *testing.T) {
+		args := rateControlArgs(request.EditorRequest{RateControl: &request.RateControl{Mode: request.RateControlTwoPass, Bitrate: "2500k"}})
+		assert.Equal(t, []string{"-c:v", "libx264", "-b:v", "2500k"}, args)
+	})
+
+	t.Run("Given no rate control, it should return no arguments", func(t *testing.T) {
+		assert.Empty(t, rateControlArgs(request.EditorRequest{}))
+	})
+}
+
+func TestTwoPassCommands(t *testing.T) {
+	t.Run("Given a command, it should analyze the video first and write the output in the second pass", func(t *testing.T) {
+		first, second := twoPassCommands(exec.Command("ffmpeg", "-y", "-i", "input.mp4", "-b:v", "1M", "output.mp4"), "/tmp/job/ffmpeg2pass")
+		assert.Equal(t, []string{"ffmpeg", "-y", "-i", "input.mp4", "-b:v", "1M", "-pass", "1", "-passlogfile", "/tmp/job/ffmpeg2pass", "-f", "null", os.DevNull}, first.Args)
+		assert.Equal(t, []string{"ffmpeg", "-y", "-i", "input.mp4", "-b:v", "1M", "-pass", "2", "-passlogfile", "/tmp/job/ffmpeg2pass", "output.mp4"}, second.Args)
+	})
+}
+
+func TestFfmpegEditor_buildCommandWithRateControl(t *testing.T) {
+	editor := NewFFMpegEditor(&configuration.Configuration{
+		Logger: slog.Default(),
+		Ffmpeg: configuration.FfmpegConfig{Path: ffmpegLocation},
+	}).(*FfmpegEditor)
+
+	t.Run("Given a rate control and replaced audio, it should encode the video instead of copying it", func(t *testing.T) {
+		cmd, err := editor.buildCommand(request.EditorRequest{
+			Input:        request.Input{UploadedFilePath: "input.mp4"},
+			Audio:        &request.Audio{Mode: request.AudioReplace, Input: request.Input{UploadedFilePath: "music.mp3"}},
+			RateControl:  &request.RateControl{Mode: request.RateControlCRF, CRF: 20},
+			ExtraOptions: "-preset slow",
+			Output:       request.Output{FilePattern: "output.mp4"},
+		}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			ffmpegLocation, "-y", "-i", "input.mp4", "-i", "music.mp3",
+			"-map", "0:v:0", "-map", "1:a:0", "-shortest", "-c:a", "aac",
+			"-c:v", "libx264", "-crf", "20", "-preset", "slow", "output.mp4",
+		}, cmd.Args)
+	})
+}
+
+func TestFfmpegEditor_HandleRequestTwoPass(t *testing.T) {
+	t.Run("Given a two-pass encode, it should run both passes and remove their pass log", func(t *testing.T) {
+		dir := t.TempDir()
+		calls := filepath.Join(dir, "calls.txt")
+		binary := filepath.Join(dir, "ffmpeg")
+		script := "#!/bin/sh\necho \"$@\" >> " + calls + "\nfor last; do :; done\n[ \"$last\" = " + os.DevNull + " ] || touch \"$last\"\n"
+		assert.NoError(t, os.WriteFile(binary, []byte(script), 0o755))
+
+		editor := NewFFMpegEditor(&configuration.Configuration{
+			Logger:     slog.Default(),
+			OutputPath: filepath.Join(dir, "output"),
+			Ffmpeg:     configuration.FfmpegConfig{Path: binary},
+		})
+		result, err := editor.HandleRequest(context.Background(), &event.Event{Id: "job", EditorRequest: request.EditorRequest{
+			Input:       request.Input{UploadedFilePath: "input.mp4"},
+			RateControl: &request.RateControl{Mode: request.RateControlTwoPass, Bitrate: "1M"},
+			Output:      request.Output{FilePattern: "video.mp4"},
+		}}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(dir, "output", "job", "output.mp4")}, result.Files)
+
+		content, err := os.ReadFile(calls)
+		assert.NoError(t, err)
+		passes := strings.Split(strings.TrimSpace(string(content)), "\n")
+		assert.Len(t, passes, 2)
+		assert.Contains(t, passes[0], "-pass 1 -passlogfile ")
+		assert.Contains(t, passes[1], "-pass 2 -passlogfile ")
+
+		passLog := strings.Fields(passes[0])[slices.Index(strings.Fields(passes[0]), "-passlogfile")+1]
+		assert.NoDirExists(t, filepath.Dir(passLog))
+	})
+}
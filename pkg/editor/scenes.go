@@ -0,0 +1,130 @@
+package editor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/timecode"
+)
+
+const (
+	defaultSceneThreshold = 0.3
+	defaultSceneWidth     = 320
+	scenePrefix           = "scene_"
+	sceneFramesFile       = "scene_frames.txt"
+)
+
+// sceneOptions returns the scenes options of an output with their defaults.
+func sceneOptions(output request.Output) request.Scenes {
+	var scenes request.Scenes
+	if output.Scenes != nil {
+		scenes = *output.Scenes
+	}
+	if scenes.Threshold <= 0 {
+		scenes.Threshold = defaultSceneThreshold
+	}
+	if scenes.Width <= 0 {
+		scenes.Width = defaultSceneWidth
+	}
+	return scenes
+}
+
+// buildScenesCommand selects the first frame of the input and the frames
+// changing scene, writing their time and score to a file, and a thumbnail of
+// each next to the output file pattern, named scene_001.jpg and so on, when
+// requested.
+func (f *FfmpegEditor) buildScenesCommand(req request.EditorRequest) (*exec.Cmd, error) {
+	args, err := inputArgs(req)
+	if err != nil {
+		return nil, err
+	}
+
+	scenes := sceneOptions(req.Output)
+	dir := filepath.Dir(req.Output.FilePattern)
+
+	var filters []string
+	if userFilters := videoFilters(req.Filters); userFilters != "" {
+		filters = append(filters, userFilters)
+	}
+	filters = append(filters,
+		"select="+escapeFilterValue(fmt.Sprintf("eq(n,0)+gt(scene,%g)", scenes.Threshold)),
+		"metadata=mode=print:file="+escapeFilterValue(filepath.Join(dir, sceneFramesFile)),
+	)
+	if scenes.Thumbnails {
+		filters = append(filters, fmt.Sprintf("scale=%d:-2", scenes.Width))
+	}
+	args = append(args, "-vf", strings.Join(filters, ","), "-an", "-fps_mode", "vfr")
+
+	args = append(args, f.outputArgs(req)...)
+	if scenes.Thumbnails {
+		args = append(args, filepath.Join(dir, scenePrefix+"%03d.jpg"))
+	} else {
+		args = append(args, "-f", "null", os.DevNull)
+	}
+	return exec.Command(f.BinaryPath, args...), nil
+}
+
+// scenesOutputs writes the scenes of the input to the output file, the last
+// one lasting until the end of the clip when known, and returns them along
+// with the file followed by the thumbnails.
+func (f *FfmpegEditor) scenesOutputs(ctx context.Context, req request.EditorRequest, dir string) ([]media.Scene, []string, error) {
+	framesPath := filepath.Join(dir, sceneFramesFile)
+	data, err := os.ReadFile(framesPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading scene frames: %w", err)
+	}
+	if err := os.Remove(framesPath); err != nil {
+		return nil, nil, err
+	}
+	scenes, err := media.ParseScenes(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files := []string{req.Output.FilePattern}
+	if last := len(scenes) - 1; last >= 0 {
+		if duration := f.clipDuration(ctx, req); duration > scenes[last].Start {
+			scenes[last].End = duration
+		}
+	}
+	if sceneOptions(req.Output).Thumbnails {
+		for i := range scenes {
+			scenes[i].Thumbnail = scenePrefix + fmt.Sprintf("%03d", i+1) + ".jpg"
+			files = append(files, filepath.Join(dir, scenes[i].Thumbnail))
+		}
+	}
+
+	content, err := json.MarshalIndent(scenes, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(req.Output.FilePattern, content, 0o644); err != nil {
+		return nil, nil, err
+	}
+	return scenes, files, nil
+}
+
+// splitArgs returns the arguments cutting the output into a clip per range
+// between the split times of the request, with a keyframe at every cut.
+func splitArgs(req request.EditorRequest) []string {
+	if req.Output.Mode != request.OutputModeSplit || req.Output.Split == nil {
+		return nil
+	}
+	times := make([]string, len(req.Output.Split.Times))
+	for i, time := range req.Output.Split.Times {
+		times[i] = timecode.FormatSeconds(time)
+	}
+	return []string{
+		"-force_key_frames", strings.Join(times, ","),
+		"-f", "segment",
+		"-segment_times", strings.Join(times, ","),
+		"-reset_timestamps", "1",
+	}
+}
@@ -0,0 +1,89 @@
+package editor
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFfmpegEditor_buildScenesCommand(t *testing.T) {
+	editor := NewFFMpegEditor(&configuration.Configuration{
+		Logger: slog.Default(),
+		Ffmpeg: configuration.FfmpegConfig{Path: ffmpegLocation},
+	}).(*FfmpegEditor)
+
+	t.Run("Given no thumbnails, it should only print the scene changes", func(t *testing.T) {
+		cmd, err := editor.buildScenesCommand(request.EditorRequest{
+			Input:  request.Input{UploadedFilePath: "input.mp4"},
+			Output: request.Output{FilePattern: "/out/job/output.json", Mode: request.OutputModeScenes},
+		})
+		assert.NoError(t, err)
+
+		args := strings.Join(cmd.Args[1:], " ")
+		assert.Contains(t, args, `-vf select=eq(n\,0)+gt(scene\,0.3),metadata=mode=print:file=/out/job/scene_frames.txt -an`)
+		assert.True(t, strings.HasSuffix(args, "-f null "+os.DevNull), args)
+	})
+
+	t.Run("Given thumbnails, it should write one per scene", func(t *testing.T) {
+		cmd, err := editor.buildScenesCommand(request.EditorRequest{
+			Input: request.Input{UploadedFilePath: "input.mp4"},
+			Output: request.Output{
+				FilePattern: "/out/job/output.json",
+				Mode:        request.OutputModeScenes,
+				Scenes:      &request.Scenes{Threshold: 0.45, Thumbnails: true, Width: 480},
+			},
+		})
+		assert.NoError(t, err)
+
+		args := strings.Join(cmd.Args[1:], " ")
+		assert.Contains(t, args, `gt(scene\,0.45),metadata=mode=print:file=/out/job/scene_frames.txt,scale=480:-2 -an -fps_mode vfr`)
+		assert.Equal(t, "/out/job/scene_%03d.jpg", cmd.Args[len(cmd.Args)-1])
+	})
+}
+
+func TestFfmpegEditor_scenesOutputs(t *testing.T) {
+	t.Run("Given the printed scene changes, it should write them with their thumbnails", func(t *testing.T) {
+		dir := t.TempDir()
+		frames := "frame:0    pts:0       pts_time:0\nlavfi.scene_score=0.000000\nframe:1    pts:53760   pts_time:4.2\nlavfi.scene_score=0.532100\n"
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, sceneFramesFile), []byte(frames), 0o644))
+
+		editor := &FfmpegEditor{logger: slog.Default()}
+		req := request.EditorRequest{
+			Input:  request.Input{UploadedFilePath: "input.mp4"},
+			Output: request.Output{FilePattern: filepath.Join(dir, "output.json"), Mode: request.OutputModeScenes, Scenes: &request.Scenes{Thumbnails: true}},
+		}
+		scenes, files, err := editor.scenesOutputs(context.Background(), req, dir)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []media.Scene{
+			{Start: 0, End: 4.2, Score: 0, Thumbnail: "scene_001.jpg"},
+			{Start: 4.2, Score: 0.5321, Thumbnail: "scene_002.jpg"},
+		}, scenes)
+		assert.Equal(t, []string{req.Output.FilePattern, filepath.Join(dir, "scene_001.jpg"), filepath.Join(dir, "scene_002.jpg")}, files)
+		assert.NoFileExists(t, filepath.Join(dir, sceneFramesFile))
+
+		content, err := os.ReadFile(req.Output.FilePattern)
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), `"score": 0.5321`)
+	})
+}
+
+func TestFfmpegEditor_buildCommandSplit(t *testing.T) {
+	t.Run("Given split times, it should cut the output into clips on keyframes", func(t *testing.T) {
+		editor := &FfmpegEditor{logger: slog.Default(), BinaryPath: "ffmpeg"}
+		cmd, err := editor.buildCommand(request.EditorRequest{
+			Input:  request.Input{UploadedFilePath: "input.mp4"},
+			Output: request.Output{FilePattern: "output%03d.mp4", Mode: request.OutputModeSplit, Split: &request.Split{Times: []float64{4.2, 9}}},
+		}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "ffmpeg -y -i input.mp4 -force_key_frames 4.2,9 -f segment -segment_times 4.2,9 -reset_timestamps 1 output%03d.mp4", strings.Join(cmd.Args, " "))
+	})
+}
@@ -0,0 +1,209 @@
+package editor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/timecode"
+)
+
+const (
+	defaultSpriteInterval = 10
+	defaultSpriteColumns  = 5
+	defaultSpriteRows     = 5
+	defaultSpriteWidth    = 160
+	defaultSpriteHeight   = 90
+	spritePrefix          = "sprite_"
+	spriteFramesFile      = "sprite_frames.txt"
+	storyboardFile        = "storyboard.vtt"
+)
+
+// spriteOptions returns the sprite options of an output with their defaults.
+func spriteOptions(output request.Output) request.Sprite {
+	var sprite request.Sprite
+	if output.Sprite != nil {
+		sprite = *output.Sprite
+	}
+	if sprite.Interval <= 0 && sprite.SceneThreshold <= 0 {
+		sprite.Interval = defaultSpriteInterval
+	}
+	if sprite.Columns <= 0 {
+		sprite.Columns = defaultSpriteColumns
+	}
+	if sprite.Rows <= 0 {
+		sprite.Rows = defaultSpriteRows
+	}
+	if sprite.Width <= 0 {
+		sprite.Width = defaultSpriteWidth
+	}
+	if sprite.Height <= 0 {
+		sprite.Height = defaultSpriteHeight
+	}
+	return sprite
+}
+
+// buildSpriteCommand samples frames of the input and tiles them into sprite
+// sheets next to the output file pattern, named sprite_001 and so on. The
+// time of every sampled frame is written to a file for the storyboard.
+func (f *FfmpegEditor) buildSpriteCommand(req request.EditorRequest) (*exec.Cmd, error) {
+	args, err := inputArgs(req)
+	if err != nil {
+		return nil, err
+	}
+
+	sprite := spriteOptions(req.Output)
+	dir := filepath.Dir(req.Output.FilePattern)
+	extension := filepath.Ext(req.Output.FilePattern)
+
+	var filters []string
+	if userFilters := videoFilters(req.Filters); userFilters != "" {
+		filters = append(filters, userFilters)
+	}
+	if sprite.SceneThreshold > 0 {
+		// The first frame is always sampled, so the storyboard starts with
+		// the video.
+		filters = append(filters, "select="+escapeFilterValue(fmt.Sprintf("eq(n,0)+gt(scene,%g)", sprite.SceneThreshold)))
+	} else {
+		filters = append(filters, fmt.Sprintf("fps=1/%g", sprite.Interval))
+	}
+	filters = append(filters,
+		"metadata=mode=add:key=sprite:value=1",
+		"metadata=mode=print:file="+escapeFilterValue(filepath.Join(dir, spriteFramesFile)),
+		fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", sprite.Width, sprite.Height),
+		fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2", sprite.Width, sprite.Height),
+		fmt.Sprintf("tile=%dx%d", sprite.Columns, sprite.Rows),
+	)
+	args = append(args, "-vf", strings.Join(filters, ","), "-an")
+
+	args = append(args, f.outputArgs(req)...)
+	args = append(args, filepath.Join(dir, spritePrefix+"%03d"+extension))
+
+	return exec.Command(f.BinaryPath, args...), nil
+}
+
+// spriteOutputs writes the WebVTT storyboard of the sprite sheets in dir,
+// mapping the time range of every sampled frame to its tile, and returns it
+// followed by the sheets.
+func (f *FfmpegEditor) spriteOutputs(ctx context.Context, req request.EditorRequest, dir string) ([]string, error) {
+	framesPath := filepath.Join(dir, spriteFramesFile)
+	times, err := readFrameTimes(framesPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading sprite frame times: %w", err)
+	}
+	if err := os.Remove(framesPath); err != nil {
+		return nil, err
+	}
+
+	sprite := spriteOptions(req.Output)
+	storyboard := storyboard(times, f.clipDuration(ctx, req), sprite, filepath.Ext(req.Output.FilePattern))
+	storyboardPath := filepath.Join(dir, storyboardFile)
+	if err := os.WriteFile(storyboardPath, []byte(storyboard), 0o644); err != nil {
+		return nil, err
+	}
+
+	sheets, err := filepath.Glob(filepath.Join(dir, spritePrefix+"*"+filepath.Ext(req.Output.FilePattern)))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(sheets)
+	return append([]string{storyboardPath}, sheets...), nil
+}
+
+// storyboard returns a WebVTT document with a cue per sampled frame, lasting
+// until the next one, pointing at its tile in the sprite sheets. The last cue
+// lasts until the end of the clip when known, or for an interval otherwise.
+func storyboard(times []float64, duration float64, sprite request.Sprite, extension string) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+
+	tiles := sprite.Columns * sprite.Rows
+	for i, start := range times {
+		end := start + sprite.Interval
+		if i+1 < len(times) {
+			end = times[i+1]
+		} else if duration > start {
+			end = duration
+		} else if sprite.Interval <= 0 {
+			end = start + defaultSpriteInterval
+		}
+		if i == 0 {
+			start = 0
+		}
+
+		tile := i % tiles
+		fmt.Fprintf(&b, "\n%s --> %s\n%s%03d%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end),
+			spritePrefix, i/tiles+1, extension,
+			tile%sprite.Columns*sprite.Width, tile/sprite.Columns*sprite.Height, sprite.Width, sprite.Height,
+		)
+	}
+	return b.String()
+}
+
+// readFrameTimes returns the pts_time of every frame printed by the metadata
+// filter to path.
+func readFrameTimes(path string) ([]float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var times []float64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if !strings.HasPrefix(scanner.Text(), "frame:") {
+			continue
+		}
+		for _, field := range strings.Fields(scanner.Text()) {
+			value, ok := strings.CutPrefix(field, "pts_time:")
+			if !ok {
+				continue
+			}
+			t, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid frame time %q", value)
+			}
+			times = append(times, t)
+		}
+	}
+	return times, scanner.Err()
+}
+
+// clipDuration returns the duration of the input from the start time of the
+// request, up to its duration, or zero when it is unknown. Times are in
+// seconds once resolveTrim converted them.
+func (f *FfmpegEditor) clipDuration(ctx context.Context, req request.EditorRequest) float64 {
+	result, err := f.probeInput(ctx, req.Input)
+	if err != nil {
+		return 0
+	}
+
+	var start timecode.Time
+	if req.StartTime != "" {
+		start, err = timecode.Parse(req.StartTime)
+		if err != nil || start.InFrames {
+			return 0
+		}
+	}
+	duration := max(result.Duration()-start.Seconds, 0)
+	if req.Duration != "" {
+		if requested, err := timecode.Parse(req.Duration); err == nil && !requested.InFrames {
+			duration = min(duration, requested.Seconds)
+		}
+	}
+	return duration
+}
+
+func vttTimestamp(seconds float64) string {
+	millis := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", millis/3600000, millis/60000%60, millis/1000%60, millis%1000)
+}
@@ -0,0 +1,125 @@
+package editor
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFfmpegEditor_buildSpriteCommand(t *testing.T) {
+	editor := NewFFMpegEditor(&configuration.Configuration{
+		Logger: slog.Default(),
+		Ffmpeg: configuration.FfmpegConfig{Path: ffmpegLocation},
+	}).(*FfmpegEditor)
+
+	t.Run("Given an interval, it should sample and tile frames at that interval", func(t *testing.T) {
+		cmd, err := editor.buildSpriteCommand(request.EditorRequest{
+			Input: request.Input{UploadedFilePath: "input.mp4"},
+			Output: request.Output{
+				FilePattern: "/out/job/output.jpg",
+				Mode:        request.OutputModeSprite,
+				Sprite:      &request.Sprite{Interval: 2.5, Columns: 4, Rows: 3, Width: 128, Height: 72},
+			},
+		})
+		assert.NoError(t, err)
+
+		args := strings.Join(cmd.Args[1:], " ")
+		assert.Contains(t, args, "-vf fps=1/2.5,metadata=mode=add:key=sprite:value=1,metadata=mode=print:file=/out/job/sprite_frames.txt,"+
+			"scale=128:72:force_original_aspect_ratio=decrease,pad=128:72:(ow-iw)/2:(oh-ih)/2,tile=4x3 -an")
+		assert.Equal(t, "/out/job/sprite_%03d.jpg", cmd.Args[len(cmd.Args)-1])
+	})
+
+	t.Run("Given a scene threshold, it should sample the first frame and scene changes", func(t *testing.T) {
+		cmd, err := editor.buildSpriteCommand(request.EditorRequest{
+			Input: request.Input{UploadedFilePath: "input.mp4"},
+			Output: request.Output{
+				FilePattern: "/out/job/output.png",
+				Mode:        request.OutputModeSprite,
+				Sprite:      &request.Sprite{SceneThreshold: 0.4},
+			},
+		})
+		assert.NoError(t, err)
+
+		args := strings.Join(cmd.Args[1:], " ")
+		assert.Contains(t, args, `-vf select=eq(n\,0)+gt(scene\,0.4),metadata=mode=add`)
+		assert.Contains(t, args, "tile=5x5")
+		assert.Equal(t, "/out/job/sprite_%03d.png", cmd.Args[len(cmd.Args)-1])
+	})
+}
+
+func TestStoryboard(t *testing.T) {
+	sprite := request.Sprite{Interval: 10, Columns: 2, Rows: 2, Width: 160, Height: 90}
+
+	t.Run("Given frames sampled at an interval, it should map each range to its tile", func(t *testing.T) {
+		vtt := storyboard([]float64{0, 10, 20, 30, 40}, 45, sprite, ".jpg")
+		assert.Equal(t, `WEBVTT
+
+00:00:00.000 --> 00:00:10.000
+sprite_001.jpg#xywh=0,0,160,90
+
+00:00:10.000 --> 00:00:20.000
+sprite_001.jpg#xywh=160,0,160,90
+
+00:00:20.000 --> 00:00:30.000
+sprite_001.jpg#xywh=0,90,160,90
+
+00:00:30.000 --> 00:00:40.000
+sprite_001.jpg#xywh=160,90,160,90
+
+00:00:40.000 --> 00:00:45.000
+sprite_002.jpg#xywh=0,0,160,90
+`, vtt)
+	})
+
+	t.Run("Given scene changes of an unknown duration, it should start at zero and end the last cue after an interval", func(t *testing.T) {
+		sprite := request.Sprite{SceneThreshold: 0.4, Columns: 2, Rows: 2, Width: 160, Height: 90}
+		vtt := storyboard([]float64{0.04, 3723.5}, 0, sprite, ".jpg")
+		assert.Contains(t, vtt, "00:00:00.000 --> 01:02:03.500\n")
+		assert.Contains(t, vtt, "01:02:03.500 --> 01:02:13.500\n")
+	})
+}
+
+func TestReadFrameTimes(t *testing.T) {
+	t.Run("Given the output of the metadata filter, it should return the frame times", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), spriteFramesFile)
+		content := "frame:0    pts:0       pts_time:0\nsprite=1\nframe:1    pts:1       pts_time:2.5\nsprite=1\nlavfi.scene_score=0.5\n"
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+		times, err := readFrameTimes(path)
+		assert.NoError(t, err)
+		assert.Equal(t, []float64{0, 2.5}, times)
+	})
+}
+
+func TestFfmpegEditor_clipDuration(t *testing.T) {
+	ctx := context.Background()
+	editor := newProbedEditor(t, "h264")
+	input := request.Input{UploadedFilePath: "input.mp4"}
+
+	t.Run("Given a start time and a duration, it should return the duration of the clip in seconds", func(t *testing.T) {
+		for _, tc := range []struct {
+			start, duration string
+			expected        float64
+		}{
+			{"", "", 10},
+			{"00:00:02.5", "", 7.5},
+			{"2", "3", 3},
+			{"8", "5", 2},
+			{"12", "", 0},
+		} {
+			req := request.EditorRequest{Input: input, StartTime: tc.start, Duration: tc.duration}
+			assert.Equal(t, tc.expected, editor.clipDuration(ctx, req), tc)
+		}
+	})
+
+	t.Run("Given a time it cannot read, it should return an unknown duration", func(t *testing.T) {
+		assert.Zero(t, editor.clipDuration(ctx, request.EditorRequest{Input: input, StartTime: "1:aa"}))
+	})
+}
@@ -0,0 +1,260 @@
+package editor
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+)
+
+const (
+	defaultSegmentDuration = 6
+	defaultVideoCodec      = "libx264"
+	defaultAudioCodec      = "aac"
+	defaultAudioBitrate    = "128k"
+	// streamPrefix names the variant playlists and segments of a rendition,
+	// so they never collide with the master playlist.
+	streamPrefix = "stream_"
+)
+
+// buildHlsCommand encodes every rendition of the ladder of the request in a
+// single run and packages them as HLS: a variant playlist per rendition,
+// named after it, next to the master playlist of the output file pattern.
+func (f *FfmpegEditor) buildHlsCommand(req request.EditorRequest, audio bool) (*exec.Cmd, error) {
+	args, err := inputArgs(req)
+	if err != nil {
+		return nil, err
+	}
+
+	overlayArgs, err := overlayInputArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, overlayArgs...)
+
+	output := req.Output
+	dir := filepath.Dir(output.FilePattern)
+	segmentDuration := getSegmentDuration(output)
+	args = append(args, f.ladderArgs(req, audio, segmentDuration)...)
+
+	segmentType, segmentExtension := "mpegts", "ts"
+	if output.SegmentType == "fmp4" {
+		segmentType, segmentExtension = "fmp4", "m4s"
+		args = append(args, "-hls_fmp4_init_filename", streamPrefix+"%v_init.mp4")
+	}
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(segmentDuration),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_type", segmentType,
+		"-hls_segment_filename", filepath.Join(dir, fmt.Sprintf("%s%%v_%%05d.%s", streamPrefix, segmentExtension)),
+		"-master_pl_name", filepath.Base(output.FilePattern),
+		"-var_stream_map", streamMap(output.Ladder, audio),
+	)
+
+	args = append(args, f.outputArgs(req)...)
+	args = append(args, filepath.Join(dir, streamPrefix+"%v.m3u8"))
+
+	return exec.Command(f.BinaryPath, args...), nil
+}
+
+// buildDashCommand encodes every rendition of the ladder of the request in a
+// single run and packages them as DASH: a manifest at the output file pattern
+// with a video representation per rendition, and an audio one when the input
+// has audio, segmented along templates.
+func (f *FfmpegEditor) buildDashCommand(req request.EditorRequest, audio bool) (*exec.Cmd, error) {
+	args, err := inputArgs(req)
+	if err != nil {
+		return nil, err
+	}
+
+	overlayArgs, err := overlayInputArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, overlayArgs...)
+
+	segmentDuration := getSegmentDuration(req.Output)
+	args = append(args, f.ladderArgs(req, audio, segmentDuration)...)
+
+	adaptationSets := "id=0,streams=v"
+	if audio {
+		adaptationSets += " id=1,streams=a"
+	}
+	args = append(args,
+		"-f", "dash",
+		"-seg_duration", strconv.Itoa(segmentDuration),
+		"-dash_segment_type", "mp4",
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-init_seg_name", streamPrefix+"$RepresentationID$_init.m4s",
+		"-media_seg_name", streamPrefix+"$RepresentationID$_$Number%05d$.m4s",
+		"-adaptation_sets", adaptationSets,
+	)
+
+	args = append(args, f.outputArgs(req)...)
+	args = append(args, req.Output.FilePattern)
+
+	return exec.Command(f.BinaryPath, args...), nil
+}
+
+// ladderArgs applies the filters and the overlay of the request, scales the
+// video once per rendition and encodes each rendition with its bitrate,
+// keyframes being aligned on segment boundaries so players can switch
+// between renditions.
+func (f *FfmpegEditor) ladderArgs(req request.EditorRequest, audio bool, segmentDuration int) []string {
+	ladder := req.Output.Ladder
+	videoCodec := valueOr(req.Codec, defaultVideoCodec)
+	audioCodec := valueOr(req.AudioCodec, defaultAudioCodec)
+
+	graph := &filterGraph{}
+	video := f.videoChain(graph, req, "0:v", 1)
+	splits := make([]string, len(ladder))
+	for i := range ladder {
+		splits[i] = fmt.Sprintf("s%d", i)
+	}
+	graph.chainTo([]string{video}, splits, fmt.Sprintf("split=%d", len(ladder)))
+	for i, rendition := range ladder {
+		graph.chainTo([]string{splits[i]}, []string{fmt.Sprintf("v%d", i)}, fmt.Sprintf("scale=%s:%s", scaleSize(rendition.Width), scaleSize(rendition.Height)))
+	}
+
+	args := []string{"-filter_complex", graph.String()}
+	for i, rendition := range ladder {
+		args = append(args,
+			"-map", fmt.Sprintf("[v%d]", i),
+			fmt.Sprintf("-c:v:%d", i), videoCodec,
+			fmt.Sprintf("-b:v:%d", i), rendition.VideoBitrate,
+		)
+		if bitrate, ok := parseBitrate(rendition.VideoBitrate); ok {
+			args = append(args,
+				fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", bitrate*107/100/1000),
+				fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", bitrate*150/100/1000),
+			)
+		}
+	}
+	args = append(args,
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentDuration),
+		"-sc_threshold", "0",
+	)
+
+	if audio {
+		for i, rendition := range ladder {
+			args = append(args,
+				"-map", "0:a:0",
+				fmt.Sprintf("-c:a:%d", i), audioCodec,
+				fmt.Sprintf("-b:a:%d", i), valueOr(rendition.AudioBitrate, valueOr(req.AudioBitrate, defaultAudioBitrate)),
+			)
+		}
+	}
+
+	return args
+}
+
+// streamMap groups the video and audio streams of each rendition in a
+// variant named after it.
+func streamMap(ladder []request.Rendition, audio bool) string {
+	variants := make([]string, len(ladder))
+	for i, rendition := range ladder {
+		if audio {
+			variants[i] = fmt.Sprintf("v:%d,a:%d,name:%s", i, i, rendition.Name)
+		} else {
+			variants[i] = fmt.Sprintf("v:%d,name:%s", i, rendition.Name)
+		}
+	}
+	return strings.Join(variants, " ")
+}
+
+// hlsOutputs returns the playlists of a HLS output, the master playlist
+// first.
+func hlsOutputs(output request.Output) []string {
+	dir := filepath.Dir(output.FilePattern)
+	outputs := []string{output.FilePattern}
+	for _, rendition := range output.Ladder {
+		outputs = append(outputs, filepath.Join(dir, fmt.Sprintf("%s%s.m3u8", streamPrefix, rendition.Name)))
+	}
+	return outputs
+}
+
+// dashOutputs returns the manifest of a DASH output followed by its
+// segments, which are only known once packaged.
+func dashOutputs(output request.Output, dir string) ([]string, error) {
+	files, err := getFilesInDirectory(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	outputs := []string{output.FilePattern}
+	for _, file := range files {
+		if file != output.FilePattern {
+			outputs = append(outputs, file)
+		}
+	}
+	return outputs, nil
+}
+
+// hasAudio reports whether the input has an audio stream. Inputs are
+// assumed to have one when they can not be probed.
+func (f *FfmpegEditor) hasAudio(ctx context.Context, input request.Input) bool {
+	result, err := f.probeInput(ctx, input)
+	if err != nil {
+		f.logger.Warn("Failed to probe input, assuming it has audio", "error", err)
+		return true
+	}
+	for _, stream := range result.Streams {
+		if stream.CodecType == "audio" {
+			return true
+		}
+	}
+	return false
+}
+
+func getSegmentDuration(output request.Output) int {
+	if output.SegmentDuration > 0 {
+		return output.SegmentDuration
+	}
+	return defaultSegmentDuration
+}
+
+// parseBitrate returns a bitrate such as "2500k" or "2.5M" in bits per second.
+func parseBitrate(value string) (int64, bool) {
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(value, "k"), strings.HasSuffix(value, "K"):
+		multiplier = 1e3
+	case strings.HasSuffix(value, "m"), strings.HasSuffix(value, "M"):
+		multiplier = 1e6
+	}
+	number, err := strconv.ParseFloat(strings.TrimRight(value, "kKmM"), 64)
+	if err != nil || number <= 0 {
+		return 0, false
+	}
+	return int64(number * multiplier), true
+}
+
+// scaleSize keeps the aspect ratio, with an even size, for unset sizes.
+func scaleSize(size int) string {
+	if size <= 0 {
+		return "-2"
+	}
+	return strconv.Itoa(size)
+}
+
+func valueOr(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func valueOrInt(value int, fallback int) int {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
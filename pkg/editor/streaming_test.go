@@ -0,0 +1,121 @@
+package editor
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFfmpegEditor_buildHlsCommand(t *testing.T) {
+	editor := NewFFMpegEditor(&configuration.Configuration{
+		Logger: slog.Default(),
+		Ffmpeg: configuration.FfmpegConfig{Path: ffmpegLocation},
+	}).(*FfmpegEditor)
+
+	req := request.EditorRequest{
+		Input: request.Input{UploadedFilePath: "input.mp4"},
+		Output: request.Output{
+			FilePattern: "/out/job/output.m3u8",
+			Mode:        request.OutputModeHls,
+			SegmentType: "fmp4",
+			Ladder: []request.Rendition{
+				{Name: "720p", Height: 720, VideoBitrate: "3000k"},
+				{Name: "360p", Width: 640, Height: 360, VideoBitrate: "0.8M", AudioBitrate: "96k"},
+			},
+		},
+	}
+
+	t.Run("Given a ladder, it should encode and package every rendition in a single run", func(t *testing.T) {
+		cmd, err := editor.buildHlsCommand(req, true)
+		assert.NoError(t, err)
+
+		args := strings.Join(cmd.Args[1:], " ")
+		assert.Contains(t, args, "-filter_complex [0:v]split=2[s0][s1];[s0]scale=-2:720[v0];[s1]scale=640:360[v1]")
+		assert.Contains(t, args, "-map [v0] -c:v:0 libx264 -b:v:0 3000k -maxrate:v:0 3210k -bufsize:v:0 4500k")
+		assert.Contains(t, args, "-map [v1] -c:v:1 libx264 -b:v:1 0.8M -maxrate:v:1 856k -bufsize:v:1 1200k")
+		assert.Contains(t, args, "-force_key_frames expr:gte(t,n_forced*6)")
+		assert.Contains(t, args, "-map 0:a:0 -c:a:0 aac -b:a:0 128k -map 0:a:0 -c:a:1 aac -b:a:1 96k")
+		assert.Contains(t, args, "-hls_fmp4_init_filename stream_%v_init.mp4")
+		assert.Contains(t, args, "-hls_segment_type fmp4 -hls_segment_filename /out/job/stream_%v_%05d.m4s")
+		assert.Contains(t, args, "-master_pl_name output.m3u8 -var_stream_map v:0,a:0,name:720p v:1,a:1,name:360p")
+		assert.Equal(t, "/out/job/stream_%v.m3u8", cmd.Args[len(cmd.Args)-1])
+	})
+
+	t.Run("Given an input without audio, it should only map the video", func(t *testing.T) {
+		cmd, err := editor.buildHlsCommand(req, false)
+		assert.NoError(t, err)
+
+		args := strings.Join(cmd.Args[1:], " ")
+		assert.NotContains(t, args, "0:a:0")
+		assert.Contains(t, args, "-var_stream_map v:0,name:720p v:1,name:360p")
+	})
+
+	t.Run("Given the request, it should return the master playlist first", func(t *testing.T) {
+		assert.Equal(t, []string{"/out/job/output.m3u8", "/out/job/stream_720p.m3u8", "/out/job/stream_360p.m3u8"}, hlsOutputs(req.Output))
+	})
+}
+
+func TestFfmpegEditor_buildDashCommand(t *testing.T) {
+	editor := NewFFMpegEditor(&configuration.Configuration{
+		Logger: slog.Default(),
+		Ffmpeg: configuration.FfmpegConfig{Path: ffmpegLocation},
+	}).(*FfmpegEditor)
+
+	req := request.EditorRequest{
+		Input: request.Input{UploadedFilePath: "input.mp4"},
+		Output: request.Output{
+			FilePattern:     "/out/job/output.mpd",
+			Mode:            request.OutputModeDash,
+			SegmentDuration: 4,
+			Ladder: []request.Rendition{
+				{Name: "720p", Height: 720, VideoBitrate: "3000k"},
+				{Name: "360p", Height: 360, VideoBitrate: "800k"},
+			},
+		},
+	}
+
+	t.Run("Given a ladder, it should share the encoding of HLS and package it as DASH", func(t *testing.T) {
+		cmd, err := editor.buildDashCommand(req, true)
+		assert.NoError(t, err)
+
+		args := strings.Join(cmd.Args[1:], " ")
+		assert.Contains(t, args, "-filter_complex [0:v]split=2[s0][s1];[s0]scale=-2:720[v0];[s1]scale=-2:360[v1]")
+		assert.Contains(t, args, "-force_key_frames expr:gte(t,n_forced*4)")
+		assert.Contains(t, args, "-f dash -seg_duration 4 -dash_segment_type mp4 -use_template 1 -use_timeline 1")
+		assert.Contains(t, args, "-init_seg_name stream_$RepresentationID$_init.m4s -media_seg_name stream_$RepresentationID$_$Number%05d$.m4s")
+		assert.Contains(t, args, "-adaptation_sets id=0,streams=v id=1,streams=a")
+		assert.Equal(t, "/out/job/output.mpd", cmd.Args[len(cmd.Args)-1])
+	})
+
+	t.Run("Given an input without audio, it should only hold a video adaptation set", func(t *testing.T) {
+		cmd, err := editor.buildDashCommand(req, false)
+		assert.NoError(t, err)
+
+		args := strings.Join(cmd.Args[1:], " ")
+		assert.NotContains(t, args, "0:a:0")
+		assert.NotContains(t, args, "streams=a")
+	})
+
+	t.Run("Given packaged segments, it should return the manifest first", func(t *testing.T) {
+		dir := t.TempDir()
+		output := request.Output{FilePattern: filepath.Join(dir, "output.mpd")}
+		for _, name := range []string{"stream_1_00001.m4s", "output.mpd", "stream_0_init.m4s", "stream_0_00001.m4s"} {
+			assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+		}
+
+		outputs, err := dashOutputs(output, dir)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			filepath.Join(dir, "output.mpd"),
+			filepath.Join(dir, "stream_0_00001.m4s"),
+			filepath.Join(dir, "stream_0_init.m4s"),
+			filepath.Join(dir, "stream_1_00001.m4s"),
+		}, outputs)
+	})
+}
@@ -0,0 +1,230 @@
+package editor
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/timecode"
+)
+
+const (
+	// smartTrimCRF keeps the re-encoded ends of smart trims close to the
+	// quality of the copied middle.
+	smartTrimCRF = 18
+	// keyframeEpsilon is the gap, in seconds, under which a cut is considered
+	// to fall on a keyframe.
+	keyframeEpsilon = 0.001
+)
+
+// smartTrimEncoders are the encoders re-encoding the ends of smart trims,
+// by the codec of the input, whose copied middle they are joined with.
+var smartTrimEncoders = map[string]string{
+	"h264": "libx264",
+	"hevc": "libx265",
+}
+
+// resolveTrim converts the start time, the end time and the duration of the
+// request to seconds, probing the frame rate of its first input for times in
+// frames, and turns its end time into a duration.
+func (f *FfmpegEditor) resolveTrim(ctx context.Context, req request.EditorRequest) (request.EditorRequest, error) {
+	if req.StartTime == "" && req.EndTime == "" && req.Duration == "" {
+		return req, nil
+	}
+
+	var times [3]timecode.Time
+	for i, value := range []string{req.StartTime, req.EndTime, req.Duration} {
+		if value == "" {
+			continue
+		}
+		time, err := timecode.Parse(value)
+		if err != nil {
+			return req, err
+		}
+		times[i] = time
+	}
+	start, end, duration := times[0], times[1], times[2]
+
+	var frameRate float64
+	if start.InFrames || end.InFrames || duration.InFrames {
+		result, err := f.probeInput(ctx, req.AllInputs()[0])
+		if err != nil {
+			return req, fmt.Errorf("probing the frame rate of the input: %w", err)
+		}
+		for _, stream := range result.Streams {
+			if stream.CodecType == "video" {
+				frameRate = stream.FrameRate()
+				break
+			}
+		}
+		if frameRate <= 0 {
+			return req, fmt.Errorf("the input has no frame rate to convert frames to seconds")
+		}
+	}
+
+	startSeconds := start.ToSeconds(frameRate)
+	if req.StartTime != "" {
+		req.StartTime = timecode.FormatSeconds(startSeconds)
+	}
+	switch {
+	case req.EndTime != "":
+		endSeconds := end.ToSeconds(frameRate)
+		if endSeconds <= startSeconds {
+			return req, fmt.Errorf("end_time must come after start_time")
+		}
+		req.Duration = timecode.FormatSeconds(endSeconds - startSeconds)
+		req.EndTime = ""
+	case req.Duration != "":
+		req.Duration = timecode.FormatSeconds(duration.ToSeconds(frameRate))
+	}
+	return req, nil
+}
+
+// seekArgs returns the input arguments reading an input from the start time
+// of the request, for its duration.
+func seekArgs(req request.EditorRequest) []string {
+	var args []string
+	if req.StartTime != "" {
+		args = append(args, "-ss", req.StartTime)
+	}
+	if req.Duration != "" {
+		args = append(args, "-t", req.Duration)
+	}
+	return args
+}
+
+// fastTrimArgs returns the arguments copying the streams of a fast trim,
+// which starts at the keyframe before its start time.
+func fastTrimArgs(req request.EditorRequest) []string {
+	if req.TrimMode != request.TrimFast {
+		return nil
+	}
+	return []string{"-c", "copy", "-avoid_negative_ts", "make_zero"}
+}
+
+// smartTrim is the plan of a smart trim: the video between its first and
+// last keyframes is copied, and the frames before and after them re-encoded.
+type smartTrim struct {
+	path    string
+	encoder string
+	pixFmt  string
+	start   float64
+	end     float64
+	first   float64
+	last    float64
+}
+
+// planSmartTrim plans the smart trim of the request, failing when the codec
+// of the input cannot be re-encoded or no keyframes fall within the trim.
+func (f *FfmpegEditor) planSmartTrim(ctx context.Context, req request.EditorRequest) (*smartTrim, error) {
+	result, err := f.probeInput(ctx, req.Input)
+	if err != nil {
+		return nil, err
+	}
+	path, err := inputPath(req.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	trim := &smartTrim{path: path}
+	for _, stream := range result.Streams {
+		if stream.CodecType == "video" {
+			trim.encoder = smartTrimEncoders[stream.CodecName]
+			trim.pixFmt = stream.PixFmt
+			break
+		}
+	}
+	if trim.encoder == "" {
+		return nil, fmt.Errorf("no encoder to re-encode the video of the input")
+	}
+
+	trim.start, _ = strconv.ParseFloat(valueOr(req.StartTime, "0"), 64)
+	trim.end = result.Duration()
+	if req.Duration != "" {
+		duration, _ := strconv.ParseFloat(req.Duration, 64)
+		trim.end = min(trim.start+duration, trim.end)
+	}
+	if trim.end <= trim.start {
+		return nil, fmt.Errorf("the trim starts after the end of the input")
+	}
+
+	keyframes, err := f.prober.Keyframes(ctx, path, result.StartTime(), trim.start, trim.end)
+	if err != nil {
+		return nil, fmt.Errorf("reading the keyframes of the input: %w", err)
+	}
+	if len(keyframes) == 0 {
+		return nil, fmt.Errorf("no keyframes within the trim")
+	}
+	trim.first, trim.last = keyframes[0], keyframes[len(keyframes)-1]
+
+	// Without a requested duration the trim runs to the end of the input,
+	// copied after its last keyframe as well.
+	if req.Duration == "" {
+		trim.last = trim.end
+	}
+	if trim.last-trim.first < keyframeEpsilon {
+		return nil, fmt.Errorf("no keyframes within the trim")
+	}
+	return trim, nil
+}
+
+// buildSmartTrimCommands builds the commands of a smart trim, writing its
+// parts to dir: the frames up to the first keyframe and from the last one
+// are re-encoded, those in between copied, and the parts joined with the
+// audio of the input. Inputs a smart trim cannot handle are trimmed
+// accurately instead.
+func (f *FfmpegEditor) buildSmartTrimCommands(ctx context.Context, req request.EditorRequest, dir string) ([]*exec.Cmd, error) {
+	trim, err := f.planSmartTrim(ctx, req)
+	if err != nil {
+		f.logger.Info("Falling back to an accurate trim", "reason", err)
+		req.TrimMode = request.TrimAccurate
+		cmd, err := f.buildCommand(req, nil)
+		if err != nil {
+			return nil, err
+		}
+		return []*exec.Cmd{cmd}, nil
+	}
+
+	var cmds []*exec.Cmd
+	var parts []string
+	part := func(name string, from float64, to float64, seek float64, codecArgs ...string) {
+		output := filepath.Join(dir, name+".ts")
+		args := []string{"-y", "-ss", timecode.FormatSeconds(from + seek), "-i", trim.path, "-t", timecode.FormatSeconds(to - from), "-map", "0:v:0", "-an", "-sn"}
+		args = append(args, codecArgs...)
+		if f.threads > 0 {
+			args = append(args, "-threads", strconv.Itoa(f.threads))
+		}
+		args = append(args, output)
+		cmds = append(cmds, exec.Command(f.BinaryPath, args...))
+		parts = append(parts, output)
+	}
+	encodeArgs := []string{"-c:v", trim.encoder, "-crf", strconv.Itoa(smartTrimCRF)}
+	if trim.pixFmt != "" {
+		encodeArgs = append(encodeArgs, "-pix_fmt", trim.pixFmt)
+	}
+
+	if trim.first-trim.start > keyframeEpsilon {
+		part("head", trim.start, trim.first, 0, encodeArgs...)
+	}
+	// Seeking just past the keyframe lands on it when copying.
+	part("middle", trim.first, trim.last, keyframeEpsilon/2, "-c:v", "copy")
+	if trim.end-trim.last > keyframeEpsilon {
+		part("tail", trim.last, trim.end, 0, encodeArgs...)
+	}
+
+	list, err := writeConcatList(dir, parts)
+	if err != nil {
+		return nil, fmt.Errorf("writing the parts of the trim: %w", err)
+	}
+	args := []string{"-y", "-f", "concat", "-safe", "0", "-i", list}
+	args = slices.Concat(args, seekArgs(req), []string{"-i", trim.path, "-map", "0:v:0", "-map", "1:a?", "-c", "copy", "-avoid_negative_ts", "make_zero"})
+	if req.Frames != "" {
+		args = append(args, "-frames:v", req.Frames)
+	}
+	args = slices.Concat(args, f.outputArgs(req), []string{req.Output.FilePattern})
+	return append(cmds, exec.Command(f.BinaryPath, args...)), nil
+}
@@ -0,0 +1,130 @@
+package editor
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+// newProbedEditor returns an editor whose ffprobe describes a video of codec
+// at 25 frames per second lasting 10 seconds, with a keyframe every 2
+// seconds.
+func newProbedEditor(t *testing.T, codec string) *FfmpegEditor {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "ffprobe")
+	script := `#!/bin/sh
+case "$*" in
+*-read_intervals*)
+	for time in 0 2 4 6 8; do
+		echo "$time.000000,K__"
+		echo "$time.040000,___"
+	done
+	;;
+*)
+	echo '{"streams":[{"codec_type":"video","codec_name":"` + codec + `","avg_frame_rate":"25/1","pix_fmt":"yuv420p"}],"format":{"format_name":"mov","start_time":"0.000000","duration":"10.000000"}}'
+	;;
+esac
+`
+	assert.NoError(t, os.WriteFile(binary, []byte(script), 0o755))
+	return &FfmpegEditor{logger: slog.Default(), BinaryPath: "ffmpeg", prober: media.NewProber(binary)}
+}
+
+func TestFfmpegEditor_resolveTrim(t *testing.T) {
+	ctx := context.Background()
+	input := request.Input{UploadedFilePath: "input.mp4"}
+
+	t.Run("Given an end time, it should turn it into a duration in seconds", func(t *testing.T) {
+		editor := &FfmpegEditor{logger: slog.Default()}
+		req, err := editor.resolveTrim(ctx, request.EditorRequest{Input: input, StartTime: "00:01:05.5", EndTime: "1:10"})
+		assert.NoError(t, err)
+		assert.Equal(t, "65.5", req.StartTime)
+		assert.Equal(t, "4.5", req.Duration)
+		assert.Empty(t, req.EndTime)
+	})
+
+	t.Run("Given times in frames, it should convert them at the frame rate of the input", func(t *testing.T) {
+		editor := newProbedEditor(t, "h264")
+		req, err := editor.resolveTrim(ctx, request.EditorRequest{Input: input, StartTime: "50f", Duration: "100f"})
+		assert.NoError(t, err)
+		assert.Equal(t, "2", req.StartTime)
+		assert.Equal(t, "4", req.Duration)
+	})
+
+	t.Run("Given times in frames without a prober, it should fail", func(t *testing.T) {
+		editor := &FfmpegEditor{logger: slog.Default()}
+		_, err := editor.resolveTrim(ctx, request.EditorRequest{Input: input, EndTime: "100f"})
+		assert.ErrorContains(t, err, "frame rate")
+	})
+
+	t.Run("Given an end time before the start time, it should fail", func(t *testing.T) {
+		editor := newProbedEditor(t, "h264")
+		_, err := editor.resolveTrim(ctx, request.EditorRequest{Input: input, StartTime: "5", EndTime: "100f"})
+		assert.ErrorContains(t, err, "end_time must come after start_time")
+	})
+}
+
+func TestFfmpegEditor_buildCommandTrim(t *testing.T) {
+	editor := &FfmpegEditor{logger: slog.Default(), BinaryPath: "ffmpeg"}
+
+	t.Run("Given a fast trim, it should copy the streams for the duration", func(t *testing.T) {
+		cmd, err := editor.buildCommand(request.EditorRequest{
+			Input:     request.Input{UploadedFilePath: "input.mp4"},
+			StartTime: "2.5",
+			Duration:  "4",
+			TrimMode:  request.TrimFast,
+			Output:    request.Output{FilePattern: "output.mp4"},
+		}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "ffmpeg -y -ss 2.5 -t 4 -i input.mp4 -c copy -avoid_negative_ts make_zero output.mp4", strings.Join(cmd.Args, " "))
+	})
+}
+
+func TestFfmpegEditor_buildSmartTrimCommands(t *testing.T) {
+	ctx := context.Background()
+	req := request.EditorRequest{
+		Input:     request.Input{UploadedFilePath: "input.mp4"},
+		StartTime: "1",
+		Duration:  "6.5",
+		TrimMode:  request.TrimSmart,
+		Output:    request.Output{FilePattern: "output.mp4"},
+	}
+
+	t.Run("Given keyframes within the trim, it should only re-encode its ends", func(t *testing.T) {
+		dir := t.TempDir()
+		cmds, err := newProbedEditor(t, "h264").buildSmartTrimCommands(ctx, req, dir)
+		assert.NoError(t, err)
+		if !assert.Len(t, cmds, 4) {
+			return
+		}
+
+		head := filepath.Join(dir, "head.ts")
+		middle := filepath.Join(dir, "middle.ts")
+		tail := filepath.Join(dir, "tail.ts")
+		assert.Equal(t, "ffmpeg -y -ss 1 -i input.mp4 -t 1 -map 0:v:0 -an -sn -c:v libx264 -crf 18 -pix_fmt yuv420p "+head, strings.Join(cmds[0].Args, " "))
+		assert.Equal(t, "ffmpeg -y -ss 2.0005 -i input.mp4 -t 4 -map 0:v:0 -an -sn -c:v copy "+middle, strings.Join(cmds[1].Args, " "))
+		assert.Equal(t, "ffmpeg -y -ss 6 -i input.mp4 -t 1.5 -map 0:v:0 -an -sn -c:v libx264 -crf 18 -pix_fmt yuv420p "+tail, strings.Join(cmds[2].Args, " "))
+
+		join := strings.Join(cmds[3].Args, " ")
+		assert.Contains(t, join, "-ss 1 -t 6.5 -i input.mp4 -map 0:v:0 -map 1:a? -c copy")
+		assert.True(t, strings.HasSuffix(join, " output.mp4"))
+
+		list, err := os.ReadFile(cmds[3].Args[7])
+		assert.NoError(t, err)
+		assert.Equal(t, "file '"+head+"'\nfile '"+middle+"'\nfile '"+tail+"'\n", string(list))
+	})
+
+	t.Run("Given a codec it cannot re-encode, it should trim accurately", func(t *testing.T) {
+		cmds, err := newProbedEditor(t, "vp9").buildSmartTrimCommands(ctx, req, t.TempDir())
+		assert.NoError(t, err)
+		if assert.Len(t, cmds, 1) {
+			assert.Equal(t, "ffmpeg -y -ss 1 -t 6.5 -i input.mp4 output.mp4", strings.Join(cmds[0].Args, " "))
+		}
+	})
+}
@@ -5,10 +5,11 @@ import (
 
 	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
 	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event/queue"
 )
 
 type InternalQueueEventEmitter struct {
-	queue chan<- event.Event
+	queue *queue.Queue[event.Event]
 }
 
 func NewInternalQueueEmitter(cfg *configuration.Configuration) EventEmitter {
@@ -18,8 +19,6 @@ func NewInternalQueueEmitter(cfg *configuration.Configuration) EventEmitter {
 }
 
 func (i *InternalQueueEventEmitter) Send(ctx context.Context, e event.Event) error {
-	go func(queue chan<- event.Event, e event.Event) {
-		i.queue <- e
-	}(i.queue, e)
+	i.queue.Push(e.Priority(), e.Tenant, e)
 	return nil
 }
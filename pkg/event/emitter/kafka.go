@@ -25,16 +25,16 @@ func NewKafkaEmitter(cfg *configuration.KafkaProducerConfig) EventEmitter {
 	}
 }
 
-func (k *KafkaEmitter) Send(ctx context.Context, event event.Event) error {
-	serializedEvent, err := json.Marshal(event)
+func (k *KafkaEmitter) Send(ctx context.Context, e event.Event) error {
+	serializedEvent, err := json.Marshal(e)
 	if err != nil {
 		return err
 	}
 
 	err = k.cl.ProduceSync(ctx, &kgo.Record{
-		Topic: k.topic,
+		Topic: event.Topic(k.topic, e.Priority()),
 		Value: serializedEvent,
-		Key:   []byte(event.Id),
+		Key:   []byte(e.Id),
 	}).FirstErr()
 
 	return err
@@ -7,6 +7,7 @@ import (
 
 	"github.com/douglasdgoulart/video-editor-api/internal/mocks"
 	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
 	"github.com/stretchr/testify/mock"
 	"github.com/twmb/franz-go/pkg/kgo"
 )
@@ -53,3 +54,26 @@ func TestKafkaEmitter_Send(t *testing.T) {
 		})
 	}
 }
+
+func TestKafkaEmitter_SendPriority(t *testing.T) {
+	t.Run("Given events of several priorities, it should send them to the topic of their priority", func(t *testing.T) {
+		mockClient := new(mocks.KgoClientMock)
+		for _, topic := range []string{"event", "event-high", "event-low"} {
+			mockClient.On("ProduceSync", mock.Anything, mock.MatchedBy(func(r *kgo.Record) bool {
+				return r.Topic == topic
+			})).Return(kgo.ProduceResults{}).Once()
+		}
+
+		k := &KafkaEmitter{
+			cl:    mockClient,
+			topic: "event",
+		}
+		for _, priority := range []string{"", event.PriorityHigh, event.PriorityLow} {
+			e := event.Event{EditorRequest: request.EditorRequest{Priority: priority}}
+			if err := k.Send(context.Background(), e); err != nil {
+				t.Errorf("KafkaEmitter.Send() error = %v", err)
+			}
+		}
+		mockClient.AssertExpectations(t)
+	})
+}
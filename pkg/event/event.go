@@ -9,10 +9,15 @@ import (
 
 type KgoClient interface {
 	ProduceSync(ctx context.Context, rs ...*kgo.Record) kgo.ProduceResults
-	PollFetches(ctx context.Context) kgo.Fetches
+	PollRecords(ctx context.Context, maxPollRecords int) kgo.Fetches
+	MarkCommitRecords(rs ...*kgo.Record)
 }
 
 type Event struct {
 	Id            string                `json:"id"`
+	Owner         string                `json:"owner,omitempty"`
+	Tenant        string                `json:"tenant,omitempty"`
+	BatchId       string                `json:"batch_id,omitempty"`
+	Step          string                `json:"step,omitempty"`
 	EditorRequest request.EditorRequest `json:"editor_request"`
 }
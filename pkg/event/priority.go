@@ -0,0 +1,77 @@
+package event
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/event/queue"
+)
+
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// Priorities lists the priorities from the most to the least urgent.
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+// DefaultPriorityWeights serves about six high priority events for every
+// three normal and one low priority ones when all of them are pending.
+var DefaultPriorityWeights = map[string]int{
+	PriorityHigh:   6,
+	PriorityNormal: 3,
+	PriorityLow:    1,
+}
+
+// Priority returns the priority of the event, normal when unset.
+func (e *Event) Priority() string {
+	if e.EditorRequest.Priority == "" {
+		return PriorityNormal
+	}
+	return e.EditorRequest.Priority
+}
+
+func ValidatePriority(priority string) error {
+	if priority != "" && !slices.Contains(Priorities, priority) {
+		return fmt.Errorf("invalid priority %q, expected one of %v", priority, Priorities)
+	}
+	return nil
+}
+
+// PriorityTiers returns the queue tiers of the priorities, using the default
+// weight of the priorities missing from weights.
+func PriorityTiers(weights map[string]int) []queue.Tier {
+	tiers := make([]queue.Tier, 0, len(Priorities))
+	for _, priority := range Priorities {
+		weight, ok := weights[priority]
+		if !ok {
+			weight = DefaultPriorityWeights[priority]
+		}
+		tiers = append(tiers, queue.Tier{Name: priority, Weight: weight})
+	}
+	return tiers
+}
+
+// NewQueue returns the queue used to pass events to local workers.
+func NewQueue(weights map[string]int) *queue.Queue[Event] {
+	return queue.New[Event](PriorityTiers(weights))
+}
+
+// Topic returns the kafka topic of the priority: normal events go to the
+// base topic, the others to "<topic>-<priority>".
+func Topic(topic string, priority string) string {
+	if priority == "" || priority == PriorityNormal {
+		return topic
+	}
+	return fmt.Sprintf("%s-%s", topic, priority)
+}
+
+// Topics returns the kafka topics of every priority.
+func Topics(topic string) []string {
+	topics := make([]string, 0, len(Priorities))
+	for _, priority := range Priorities {
+		topics = append(topics, Topic(topic, priority))
+	}
+	return topics
+}
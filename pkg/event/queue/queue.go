@@ -0,0 +1,156 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+// Tier is a priority level of the queue. Tiers are served in proportion to
+// their weight, so lower tiers keep making progress while higher ones are
+// busy.
+type Tier struct {
+	Name   string
+	Weight int
+}
+
+type tier[T any] struct {
+	Tier
+	current int
+	// tenants holds the tenants with pending items, in the order they are
+	// served.
+	tenants []string
+	items   map[string][]T
+	pending int
+}
+
+// Queue is a priority queue that picks tiers with smooth weighted round
+// robin, and round robins between the tenants of a tier, so a tenant that
+// queues many items does not delay the items of the others.
+type Queue[T any] struct {
+	mu     sync.Mutex
+	tiers  []*tier[T]
+	byName map[string]*tier[T]
+	len    int
+	notify chan struct{}
+}
+
+func New[T any](tiers []Tier) *Queue[T] {
+	q := &Queue[T]{
+		byName: make(map[string]*tier[T], len(tiers)),
+		notify: make(chan struct{}, 1),
+	}
+	for _, t := range tiers {
+		q.addTier(t)
+	}
+	return q
+}
+
+func (q *Queue[T]) addTier(t Tier) *tier[T] {
+	if t.Weight <= 0 {
+		t.Weight = 1
+	}
+	added := &tier[T]{Tier: t, items: make(map[string][]T)}
+	q.tiers = append(q.tiers, added)
+	q.byName[t.Name] = added
+	return added
+}
+
+// Push adds v to the tier named priority on behalf of tenant. Unknown tiers
+// are added with a weight of 1.
+func (q *Queue[T]) Push(priority string, tenant string, v T) {
+	q.mu.Lock()
+	t, ok := q.byName[priority]
+	if !ok {
+		t = q.addTier(Tier{Name: priority})
+	}
+	if len(t.items[tenant]) == 0 {
+		t.tenants = append(t.tenants, tenant)
+	}
+	t.items[tenant] = append(t.items[tenant], v)
+	t.pending++
+	q.len++
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+// Pop removes the next item, waiting for one until ctx is done.
+func (q *Queue[T]) Pop(ctx context.Context) (T, error) {
+	for {
+		if v, ok := q.TryPop(); ok {
+			return v, nil
+		}
+
+		select {
+		case <-q.notify:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// TryPop removes the next item if there is one.
+func (q *Queue[T]) TryPop() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var zero T
+	t := q.nextTier()
+	if t == nil {
+		return zero, false
+	}
+
+	tenant := t.tenants[0]
+	v := t.items[tenant][0]
+	t.items[tenant] = t.items[tenant][1:]
+	t.tenants = t.tenants[1:]
+	if len(t.items[tenant]) > 0 {
+		t.tenants = append(t.tenants, tenant)
+	} else {
+		delete(t.items, tenant)
+	}
+	t.pending--
+	q.len--
+
+	// Wake up another waiter, as pushes only wake up one of them.
+	if q.len > 0 {
+		q.signal()
+	}
+
+	return v, true
+}
+
+// nextTier picks the tier to serve with smooth weighted round robin among the
+// tiers with pending items.
+func (q *Queue[T]) nextTier() *tier[T] {
+	var best *tier[T]
+	total := 0
+	for _, t := range q.tiers {
+		if t.pending == 0 {
+			continue
+		}
+		t.current += t.Weight
+		total += t.Weight
+		if best == nil || t.current > best.current {
+			best = t
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.len
+}
+
+func (q *Queue[T]) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,59 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	t.Run("Given pending items of several tiers, it should serve them by weight", func(t *testing.T) {
+		q := New[string]([]Tier{{Name: "high", Weight: 2}, {Name: "low", Weight: 1}})
+		for range 3 {
+			q.Push("low", "a", "low")
+			q.Push("high", "a", "high")
+		}
+
+		var served []string
+		for range 6 {
+			v, ok := q.TryPop()
+			assert.True(t, ok)
+			served = append(served, v)
+		}
+		assert.Equal(t, []string{"high", "low", "high", "high", "low", "low"}, served)
+	})
+
+	t.Run("Given tenants sharing a tier, it should let them take turns", func(t *testing.T) {
+		q := New[string](nil)
+		q.Push("normal", "a", "a1")
+		q.Push("normal", "a", "a2")
+		q.Push("normal", "a", "a3")
+		q.Push("normal", "b", "b1")
+
+		var served []string
+		for q.Len() > 0 {
+			v, _ := q.TryPop()
+			served = append(served, v)
+		}
+		assert.Equal(t, []string{"a1", "b1", "a2", "a3"}, served)
+	})
+
+	t.Run("Given an empty queue, it should wait for a push or the context", func(t *testing.T) {
+		q := New[string](nil)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			q.Push("normal", "a", "a1")
+		}()
+
+		v, err := q.Pop(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "a1", v)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = q.Pop(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -6,10 +6,11 @@ import (
 
 	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
 	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event/queue"
 )
 
 type InternalQueueEventReceiver struct {
-	queue  <-chan event.Event
+	queue  *queue.Queue[event.Event]
 	logger *slog.Logger
 }
 
@@ -22,14 +23,14 @@ func NewInternalQueueEventReceiver(cfg *configuration.Configuration) EventReceiv
 
 func (i *InternalQueueEventReceiver) Receive(ctx context.Context, handler func(event *event.Event) error) {
 	for {
-		select {
-		case e := <-i.queue:
-			err := handler(&e)
-			if err != nil {
-				i.logger.Error("error handling event", "error", err, "event", e)
-			}
-		case <-ctx.Done():
+		e, err := i.queue.Pop(ctx)
+		if err != nil {
 			return
 		}
+
+		err = handler(&e)
+		if err != nil {
+			i.logger.Error("error handling event", "error", err, "event", e)
+		}
 	}
 }
@@ -7,12 +7,72 @@ import (
 
 	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
 	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event/queue"
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
+// maxBufferedRecords bounds the records a worker holds to pick the next event
+// by priority and tenant.
+const maxBufferedRecords = 16
+
+type pendingRecord struct {
+	event  event.Event
+	record *kgo.Record
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// commits tracks the buffered records of every partition in offset order.
+// Committing a record commits the earlier ones of its partition as well, so
+// records handled out of order are only marked once all the earlier ones of
+// their partition are handled.
+type commits struct {
+	records map[topicPartition][]*kgo.Record
+	handled map[*kgo.Record]bool
+}
+
+func newCommits() *commits {
+	return &commits{records: map[topicPartition][]*kgo.Record{}, handled: map[*kgo.Record]bool{}}
+}
+
+// add tracks a polled record, polled after the earlier ones of its partition.
+func (c *commits) add(record *kgo.Record) {
+	key := topicPartition{record.Topic, record.Partition}
+	c.records[key] = append(c.records[key], record)
+}
+
+// done marks a record as handled, returning the records of its partition
+// that can now be committed.
+func (c *commits) done(record *kgo.Record) []*kgo.Record {
+	c.handled[record] = true
+	key := topicPartition{record.Topic, record.Partition}
+	records := c.records[key]
+
+	var ready []*kgo.Record
+	for len(records) > 0 && c.handled[records[0]] {
+		delete(c.handled, records[0])
+		ready = append(ready, records[0])
+		records = records[1:]
+	}
+	if len(records) == 0 {
+		delete(c.records, key)
+	} else {
+		c.records[key] = records
+	}
+	return ready
+}
+
+// KafkaEventReceiver consumes the topics of every priority. Polled records are
+// buffered in a priority queue, so each event handled is the most urgent one
+// available and tenants take turns, rather than the oldest one.
 type KafkaEventReceiver struct {
-	cl     event.KgoClient
-	logger *slog.Logger
+	cl      event.KgoClient
+	pending *queue.Queue[pendingRecord]
+	commits *commits
+	logger  *slog.Logger
 }
 
 func NewKafkaEventReceiver(cfg *configuration.Configuration) EventReceiver {
@@ -23,14 +83,24 @@ func NewKafkaEventReceiver(cfg *configuration.Configuration) EventReceiver {
 	cl, err := kgo.NewClient(
 		kgo.SeedBrokers(kafkaConsumerConfig.Brokers...),
 		kgo.ConsumerGroup(kafkaConsumerConfig.GroupID),
-		kgo.ConsumeTopics(kafkaConsumerConfig.Topic),
+		kgo.ConsumeTopics(event.Topics(kafkaConsumerConfig.Topic)...),
+		// Only records handled along with all the earlier ones of their
+		// partition are committed, buffered ones are consumed again after a
+		// restart.
+		kgo.AutoCommitMarks(),
 	)
 	if err != nil {
 		panic(err)
 	}
+	return newKafkaEventReceiver(cl, cfg.Job.PriorityWeights, logger)
+}
+
+func newKafkaEventReceiver(cl event.KgoClient, weights map[string]int, logger *slog.Logger) *KafkaEventReceiver {
 	return &KafkaEventReceiver{
-		cl:     cl,
-		logger: logger,
+		cl:      cl,
+		pending: queue.New[pendingRecord](event.PriorityTiers(weights)),
+		commits: newCommits(),
+		logger:  logger,
 	}
 }
 
@@ -48,23 +118,56 @@ func (k *KafkaEventReceiver) Receive(ctx context.Context, handle func(event *eve
 		case <-ctx.Done():
 			return
 		default:
-			fetches := k.cl.PollFetches(ctx)
-			iter := fetches.RecordIter()
-			for !iter.Done() {
-				var e event.Event
-				record := iter.Next()
-
-				if err := json.Unmarshal(record.Value, &e); err != nil {
-					k.logger.Error("error unmarshalling event", "error", err, "event", string(record.Value))
-					continue
-				}
-				k.logger.Debug("received event", "event", e)
-
-				var processErr error
-				if processErr = handle(&e); processErr != nil {
-					k.logger.Error("error handling event", "error", processErr)
-				}
+			k.poll(ctx)
+
+			p, ok := k.pending.TryPop()
+			if !ok {
+				continue
+			}
+			k.logger.Debug("received event", "event", p.event)
+
+			if processErr := handle(&p.event); processErr != nil {
+				k.logger.Error("error handling event", "error", processErr)
 			}
+			k.commit(p.record)
+		}
+	}
+}
+
+// poll buffers the polled records. It only waits for records when none are
+// buffered, otherwise it takes the ones the client already fetched, which is
+// what polling with a nil context does.
+func (k *KafkaEventReceiver) poll(ctx context.Context) {
+	room := maxBufferedRecords - k.pending.Len()
+	if room <= 0 {
+		return
+	}
+
+	pollCtx := ctx
+	if k.pending.Len() > 0 {
+		pollCtx = nil
+	}
+	fetches := k.cl.PollRecords(pollCtx, room)
+
+	iter := fetches.RecordIter()
+	for !iter.Done() {
+		var e event.Event
+		record := iter.Next()
+		k.commits.add(record)
+
+		if err := json.Unmarshal(record.Value, &e); err != nil {
+			k.logger.Error("error unmarshalling event", "error", err, "event", string(record.Value))
+			k.commit(record)
+			continue
 		}
+		k.pending.Push(e.Priority(), e.Tenant, pendingRecord{event: e, record: record})
+	}
+}
+
+// commit marks a handled record for commit once the earlier records of its
+// partition are handled too.
+func (k *KafkaEventReceiver) commit(record *kgo.Record) {
+	if ready := k.commits.done(record); len(ready) > 0 {
+		k.cl.MarkCommitRecords(ready...)
 	}
 }
@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"log/slog"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/twmb/franz-go/pkg/kfake"
@@ -106,10 +108,7 @@ func TestKafkaEventReceiver_Receive(t *testing.T) {
 			)
 			assert.NoError(t, err)
 
-			k := &KafkaEventReceiver{
-				cl:     cl,
-				logger: slog.Default(),
-			}
+			k := newKafkaEventReceiver(cl, nil, slog.Default())
 
 			go func() {
 				if tt.name == "unmarshal failure" {
@@ -147,3 +146,65 @@ func produceInvalidMessage(fakeKafka *kgo.Client, topic string) {
 		Value: []byte("invalid json"),
 	})
 }
+
+// fakeKgoClient returns its records on the first poll, recording the records
+// marked for commit.
+type fakeKgoClient struct {
+	records []*kgo.Record
+	polled  bool
+	marked  [][]int64
+}
+
+func (f *fakeKgoClient) ProduceSync(ctx context.Context, rs ...*kgo.Record) kgo.ProduceResults {
+	return nil
+}
+
+func (f *fakeKgoClient) PollRecords(ctx context.Context, maxPollRecords int) kgo.Fetches {
+	if f.polled {
+		if ctx != nil {
+			<-ctx.Done()
+		}
+		return nil
+	}
+	f.polled = true
+	return kgo.Fetches{{Topics: []kgo.FetchTopic{{
+		Topic:      "event",
+		Partitions: []kgo.FetchPartition{{Partition: 0, Records: f.records}},
+	}}}}
+}
+
+func (f *fakeKgoClient) MarkCommitRecords(rs ...*kgo.Record) {
+	var offsets []int64
+	for _, r := range rs {
+		offsets = append(offsets, r.Offset)
+	}
+	f.marked = append(f.marked, offsets)
+}
+
+func TestKafkaEventReceiver_commit(t *testing.T) {
+	t.Run("Given a later record of a partition handled first, it should only commit it with the earlier one", func(t *testing.T) {
+		record := func(offset int64, priority string) *kgo.Record {
+			value, _ := json.Marshal(event.Event{Id: priority, EditorRequest: request.EditorRequest{Priority: priority}})
+			return &kgo.Record{Topic: "event", Partition: 0, Offset: offset, Value: value}
+		}
+		cl := &fakeKgoClient{records: []*kgo.Record{record(0, event.PriorityLow), record(1, event.PriorityHigh)}}
+		k := newKafkaEventReceiver(cl, nil, slog.Default())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var handled []string
+		var marked [][][]int64
+		k.Receive(ctx, func(e *event.Event) error {
+			handled = append(handled, e.Id)
+			marked = append(marked, slices.Clone(cl.marked))
+			if len(handled) == 2 {
+				cancel()
+			}
+			return nil
+		})
+
+		assert.Equal(t, []string{event.PriorityHigh, event.PriorityLow}, handled)
+		assert.Empty(t, marked[1], "the later record must not be committed before the earlier one is handled")
+		assert.Equal(t, [][]int64{{0, 1}}, cl.marked)
+	})
+}
@@ -1,50 +1,85 @@
 package job
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"net/http"
+	"math"
 	"strings"
+	"time"
 
+	"github.com/douglasdgoulart/video-editor-api/pkg/batch"
 	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
 	"github.com/douglasdgoulart/video-editor-api/pkg/editor"
 	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event/emitter"
 	"github.com/douglasdgoulart/video-editor-api/pkg/event/receiver"
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/douglasdgoulart/video-editor-api/pkg/tenant"
+	"github.com/douglasdgoulart/video-editor-api/pkg/webhook"
 )
 
 type JobInterface interface {
 	Run(ctx context.Context)
 }
 
+const ErrorCodeQuotaExceeded = "quota_exceeded"
+
+// errAlreadyHandled is returned when starting a job that already finished or
+// runs on another worker, such as an event delivered again after a restart.
+var errAlreadyHandled = errors.New("job already handled")
+
+const (
+	cancelPollInterval = time.Second
+	progressInterval   = time.Second
+	requeueDelay       = 5 * time.Second
+	// heartbeatInterval leaves a few heartbeats to each lease.
+	heartbeatInterval = state.LeaseDuration / 4
+)
+
 type Job struct {
 	eventReceiver receiver.EventReceiver
+	eventEmitter  emitter.EventEmitter
 	editor        editor.EditorInterface
+	store         state.Store
+	batches       *batch.Store
+	quotas        *tenant.Quotas
 	logger        *slog.Logger
 	apiHost       string
 	apiPort       string
 	outputPath    string
+	// maxParallelSteps caps the steps of a pipeline running at once.
+	maxParallelSteps int
 }
 
 func NewJob(cfg *configuration.Configuration, jobId int) JobInterface {
 	var eventReceiver receiver.EventReceiver
+	var eventEmitter emitter.EventEmitter
 	if cfg.Kafka.Enabled {
 		eventReceiver = receiver.NewKafkaEventReceiver(cfg)
+		eventEmitter = emitter.NewKafkaEmitter(&cfg.Kafka.KafkaProducerConfig)
 	} else {
 		eventReceiver = receiver.NewInternalQueueEventReceiver(cfg)
+		eventEmitter = emitter.NewInternalQueueEmitter(cfg)
 	}
 
 	editor := editor.NewFFMpegEditor(cfg)
 	logger := cfg.Logger.WithGroup(fmt.Sprintf("job_%d", jobId))
+	store := state.NewFileStore(cfg.StatePath)
 	return &Job{
-		eventReceiver: eventReceiver,
-		editor:        editor,
-		logger:        logger,
-		apiHost:       cfg.Api.Host,
-		apiPort:       cfg.Api.Port,
-		outputPath:    cfg.OutputPath,
+		eventReceiver:    eventReceiver,
+		eventEmitter:     eventEmitter,
+		editor:           editor,
+		store:            store,
+		batches:          batch.NewStore(cfg.StatePath),
+		quotas:           tenant.NewQuotas(cfg, store),
+		logger:           logger,
+		apiHost:          cfg.Api.Host,
+		apiPort:          cfg.Api.Port,
+		outputPath:       cfg.OutputPath,
+		maxParallelSteps: cfg.Job.MaxParallelSteps,
 	}
 }
 
@@ -55,24 +90,248 @@ func (j *Job) Run(ctx context.Context) {
 
 func (j *Job) handleEvent(ctx context.Context) func(event *event.Event) error {
 	return func(event *event.Event) error {
-		otputFileLocation, err := j.editor.HandleRequest(ctx, event.EditorRequest)
+		if event.Tenant == "" {
+			event.Tenant = tenant.Default
+		}
+
+		if job, err := j.store.Get(ctx, event.Id); err == nil {
+			if job.Status == state.StatusCancelled {
+				j.logger.Info("skipping cancelled job", "job_id", event.Id)
+				return j.notify(ctx, event, state.StatusCancelled, editor.Result{}, nil)
+			}
+			if alreadyHandled(job, time.Now()) {
+				j.logger.Info("skipping already handled job", "job_id", event.Id, "status", job.Status)
+				return nil
+			}
+		}
+
+		var job *state.JobState
+		err := j.quotas.Start(ctx, event.Tenant, event.Id, func() error {
+			var err error
+			job, err = j.start(ctx, event)
+			return err
+		})
+		if errors.Is(err, errAlreadyHandled) {
+			j.logger.Info("skipping already handled job", "job_id", event.Id)
+			return nil
+		}
+		if err != nil {
+			var quotaErr *tenant.QuotaError
+			if !errors.As(err, &quotaErr) {
+				j.logger.Error("error starting job", "error", err, "job_id", event.Id)
+				return err
+			}
+			if quotaErr.Reason == tenant.ReasonRunningJobs {
+				return j.requeue(ctx, event)
+			}
+
+			j.logger.Info("tenant quota exceeded", "tenant", event.Tenant, "reason", quotaErr.Reason, "job_id", event.Id)
+			j.finish(ctx, event.Id, state.StatusError, editor.Result{}, err, 0)
+			return j.notify(ctx, event, state.StatusError, editor.Result{}, err)
+		}
+		if job.Status == state.StatusCancelled {
+			j.logger.Info("skipping cancelled job", "job_id", event.Id)
+			return j.notify(ctx, event, state.StatusCancelled, editor.Result{}, nil)
+		}
+
+		jobCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go j.watchCancellation(jobCtx, event.Id, cancel)
+		go j.renewLease(jobCtx, event.Id)
+
+		startedAt := time.Now()
+		var result editor.Result
+		if len(event.EditorRequest.Steps) > 0 {
+			result.Files, err = j.runPipeline(jobCtx, event)
+		} else {
+			result, err = j.editor.HandleRequest(jobCtx, event, j.reportProgress(ctx, event.Id))
+		}
+		status := state.StatusSuccess
+		if err != nil {
+			status = state.StatusError
+			if jobCtx.Err() != nil && ctx.Err() == nil {
+				status = state.StatusCancelled
+			}
+		}
+		j.finish(ctx, event.Id, status, result, err, time.Since(startedAt).Seconds())
+
 		if err != nil {
 			j.logger.Error("error handling event", "error", err)
-			err := j.callWebhook(event, otputFileLocation, err)
+			err := j.notify(ctx, event, status, result, err)
 			if err != nil {
 				j.logger.Error("error calling webhook", "error", err)
 			}
 			return err
 		}
-		return j.callWebhook(event, otputFileLocation, err)
+		return j.notify(ctx, event, status, result, err)
+	}
+}
+
+// requeue sends the event back to the queue when its tenant already runs as
+// many jobs as allowed. It waits before doing so, so jobs of a saturated
+// tenant do not spin between workers.
+func (j *Job) requeue(ctx context.Context, event *event.Event) error {
+	j.logger.Info("tenant running jobs limit reached, requeueing job", "tenant", event.Tenant, "job_id", event.Id)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(requeueDelay):
+	}
+
+	return j.eventEmitter.Send(context.WithoutCancel(ctx), *event)
+}
+
+// start marks the job as running, unless it was cancelled while queued, and
+// returns errAlreadyHandled when it finished or runs on another worker. Jobs
+// without a state, e.g. queued by an older api, get one created.
+func (j *Job) start(ctx context.Context, event *event.Event) (*state.JobState, error) {
+	now := time.Now().UTC()
+	job, err := j.store.Update(ctx, event.Id, func(job *state.JobState) error {
+		if alreadyHandled(job, now) {
+			return errAlreadyHandled
+		}
+		if job.Status != state.StatusCancelled {
+			job.Status = state.StatusRunning
+			job.StartedAt = &now
+			job.HeartbeatAt = &now
+		}
+		return nil
+	})
+	if errors.Is(err, state.ErrNotFound) {
+		job = &state.JobState{
+			Id:          event.Id,
+			Owner:       event.Owner,
+			Tenant:      event.Tenant,
+			BatchId:     event.BatchId,
+			Status:      state.StatusRunning,
+			Request:     event.EditorRequest,
+			StartedAt:   &now,
+			HeartbeatAt: &now,
+		}
+		err = j.store.Save(ctx, job)
+	}
+	if err != nil {
+		if !errors.Is(err, errAlreadyHandled) {
+			j.logger.Error("error updating job state", "error", err, "job_id", event.Id)
+		}
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// alreadyHandled reports whether the job finished, other than by being
+// cancelled while queued, or runs on a worker still renewing its lease.
+func alreadyHandled(job *state.JobState, now time.Time) bool {
+	if job.Status == state.StatusCancelled {
+		return false
+	}
+	return job.Done() || job.Status == state.StatusRunning && !job.LeaseExpired(now)
+}
+
+// reportProgress saves the progress of a job in its state, at most once per
+// progressInterval, so the api can stream it from any replica.
+func (j *Job) reportProgress(ctx context.Context, id string) editor.ProgressFunc {
+	var lastReport time.Time
+	return func(progress editor.Progress) {
+		if progress.Percent < 100 && time.Since(lastReport) < progressInterval {
+			return
+		}
+		lastReport = time.Now()
+
+		_, err := j.store.Update(ctx, id, func(job *state.JobState) error {
+			job.Progress = math.Round(progress.Percent*10) / 10
+			return nil
+		})
+		if err != nil {
+			j.logger.Error("error saving job progress", "error", err, "job_id", id)
+		}
+	}
+}
+
+// finish records the final status of the job along with the processing time
+// counted against the daily quota of its tenant.
+func (j *Job) finish(ctx context.Context, id string, status state.Status, result editor.Result, inputErr error, processedSeconds float64) {
+	now := time.Now().UTC()
+	_, err := j.store.Update(ctx, id, func(job *state.JobState) error {
+		job.Status = status
+		job.FileLocations = j.getFileLocationURL(result.Files, j.apiHost, j.apiPort)
+		job.Loudness = result.Loudness
+		job.Scenes = result.Scenes
+		job.ProcessedSeconds = processedSeconds
+		job.FinishedAt = &now
+		if status == state.StatusSuccess {
+			job.Progress = 100
+		}
+		if inputErr != nil {
+			job.ErrorMsg = inputErr.Error()
+			job.ErrorCode = errorCode(inputErr)
+		}
+		return nil
+	})
+	if err != nil {
+		j.logger.Error("error updating job state", "error", err, "job_id", id)
+	}
+}
+
+// renewLease renews the lease of the running job until ctx is done, telling
+// the other workers it did not crash.
+func (j *Job) renewLease(ctx context.Context, id string) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now().UTC()
+			_, err := j.store.Update(ctx, id, func(job *state.JobState) error {
+				if job.Status == state.StatusRunning {
+					job.HeartbeatAt = &now
+				}
+				return nil
+			})
+			if err != nil && ctx.Err() == nil {
+				j.logger.Error("error renewing job lease", "error", err, "job_id", id)
+			}
+		}
+	}
+}
+
+// watchCancellation cancels the job context once a cancellation was requested
+// through the api.
+func (j *Job) watchCancellation(ctx context.Context, id string, cancel context.CancelFunc) {
+	ticker := time.NewTicker(cancelPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job, err := j.store.Get(ctx, id)
+			if err != nil {
+				continue
+			}
+			if job.CancelRequested {
+				j.logger.Info("cancelling job", "job_id", id)
+				cancel()
+				return
+			}
+		}
 	}
 }
 
 type WebhookResponse struct {
-	Status        string   `json:"status"`
-	Id            string   `json:"id"`
-	FileLocations []string `json:"file_location,omitempty"`
-	ErrorMsg      string   `json:"error_msg,omitempty"`
+	Status        string               `json:"status"`
+	Id            string               `json:"id"`
+	FileLocations []string             `json:"file_location,omitempty"`
+	Loudness      *media.LoudnessStats `json:"loudness,omitempty"`
+	Scenes        []media.Scene        `json:"scenes,omitempty"`
+	ErrorMsg      string               `json:"error_msg,omitempty"`
+	ErrorCode     string               `json:"error_code,omitempty"`
+	Log           []string             `json:"log,omitempty"`
 }
 
 func (j *Job) getFileLocationURL(fileLocations []string, host string, port string) []string {
@@ -91,47 +350,59 @@ func (j *Job) getFileLocationURL(fileLocations []string, host string, port strin
 	return urls
 }
 
-func (j *Job) callWebhook(event *event.Event, outputFilesLocation []string, inputErr error) error {
-	outputFileLocationsURL := j.getFileLocationURL(outputFilesLocation, j.apiHost, j.apiPort)
+// errorCode tells webhooks why a job failed, e.g. because it hit one of its
+// limits.
+func errorCode(err error) string {
+	var quotaErr *tenant.QuotaError
+	if errors.As(err, &quotaErr) {
+		return ErrorCodeQuotaExceeded
+	}
+	return editor.ErrorCode(err)
+}
+
+// notify calls the webhook of the job, then the one of its batch when it was
+// the last job of the batch to finish.
+func (j *Job) notify(ctx context.Context, event *event.Event, status state.Status, result editor.Result, inputErr error) error {
+	err := j.callWebhook(event, status, result, inputErr)
+	if event.BatchId != "" {
+		if err := j.completeBatch(ctx, event.BatchId); err != nil {
+			j.logger.Error("error completing batch", "error", err, "batch_id", event.BatchId, "job_id", event.Id)
+		}
+	}
+	return err
+}
+
+// completeBatch calls the webhook of the batch id once all of its jobs are
+// done, which every worker finishing a job of the batch checks.
+func (j *Job) completeBatch(ctx context.Context, id string) error {
+	summary, err := j.batches.Complete(ctx, j.store, id)
+	if summary != nil {
+		j.logger.Info("batch done", "batch_id", id, "status", summary.Status)
+	}
+	return err
+}
+
+func (j *Job) callWebhook(event *event.Event, status state.Status, result editor.Result, inputErr error) error {
+	outputFileLocationsURL := j.getFileLocationURL(result.Files, j.apiHost, j.apiPort)
 	if event.EditorRequest.Output.WebhookURL == "" {
 		return nil
 	}
 	url := event.EditorRequest.Output.WebhookURL
 
-	status := "success"
 	errMsg := ""
 	if inputErr != nil {
-		status = "error"
 		errMsg = inputErr.Error()
 	}
 	payload := WebhookResponse{
-		Status:        status,
+		Status:        string(status),
 		Id:            event.Id,
 		FileLocations: outputFileLocationsURL,
+		Loudness:      result.Loudness,
+		Scenes:        result.Scenes,
 		ErrorMsg:      errMsg,
+		ErrorCode:     errorCode(inputErr),
+		Log:           editor.ErrorLog(inputErr),
 	}
 
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		fmt.Println("Error encoding JSON:", err)
-		return err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		fmt.Println("Error creating request:", err)
-		return err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Println("Error performing request:", err)
-		return err
-	}
-	defer resp.Body.Close()
-
-	return nil
+	return webhook.Post(url, payload)
 }
@@ -0,0 +1,114 @@
+package job
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/editor"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/douglasdgoulart/video-editor-api/pkg/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingEditor counts the requests it handles, succeeding every one.
+type countingEditor struct {
+	calls atomic.Int32
+}
+
+func (c *countingEditor) HandleRequest(ctx context.Context, e *event.Event, onProgress editor.ProgressFunc) (editor.Result, error) {
+	c.calls.Add(1)
+	return editor.Result{}, nil
+}
+
+func newTestJob(t *testing.T, editor editor.EditorInterface) *Job {
+	cfg := &configuration.Configuration{
+		Logger:     slog.Default(),
+		OutputPath: t.TempDir(),
+		StatePath:  t.TempDir(),
+	}
+	store := state.NewFileStore(cfg.StatePath)
+	return &Job{
+		editor:     editor,
+		store:      store,
+		quotas:     tenant.NewQuotas(cfg, store),
+		logger:     cfg.Logger,
+		apiHost:    "localhost",
+		outputPath: cfg.OutputPath,
+	}
+}
+
+func TestJob_handleEvent(t *testing.T) {
+	ctx := context.Background()
+	newEvent := func(t *testing.T, j *Job) *event.Event {
+		e := &event.Event{
+			Id:            uuid.New().String(),
+			Tenant:        tenant.Default,
+			EditorRequest: request.EditorRequest{Input: request.Input{FileURL: "https://example.com/video.mp4"}},
+		}
+		assert.NoError(t, j.store.Save(ctx, &state.JobState{Id: e.Id, Tenant: e.Tenant, Status: state.StatusQueued}))
+		return e
+	}
+
+	t.Run("Given the same event twice, it should only run the job once", func(t *testing.T) {
+		editor := &countingEditor{}
+		j := newTestJob(t, editor)
+		e := newEvent(t, j)
+		handle := j.handleEvent(ctx)
+
+		assert.NoError(t, handle(e))
+		finished, err := j.store.Get(ctx, e.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, state.StatusSuccess, finished.Status)
+
+		redelivered := *e
+		assert.NoError(t, handle(&redelivered))
+		assert.Equal(t, int32(1), editor.calls.Load())
+
+		job, err := j.store.Get(ctx, e.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, state.StatusSuccess, job.Status)
+		assert.Equal(t, finished.FinishedAt, job.FinishedAt)
+	})
+
+	t.Run("Given the event of a job running on another worker, it should not start it again", func(t *testing.T) {
+		editor := &countingEditor{}
+		j := newTestJob(t, editor)
+		e := newEvent(t, j)
+		startedAt := time.Now().UTC()
+		_, err := j.store.Update(ctx, e.Id, func(job *state.JobState) error {
+			job.Status = state.StatusRunning
+			job.StartedAt = &startedAt
+			job.HeartbeatAt = &startedAt
+			return nil
+		})
+		assert.NoError(t, err)
+
+		assert.NoError(t, j.handleEvent(ctx)(e))
+		assert.Zero(t, editor.calls.Load())
+
+		job, err := j.store.Get(ctx, e.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, state.StatusRunning, job.Status)
+		assert.Nil(t, job.FinishedAt)
+	})
+
+	t.Run("Given a job handled between its check and its start, it should not run it", func(t *testing.T) {
+		j := newTestJob(t, &countingEditor{})
+		e := newEvent(t, j)
+		_, err := j.store.Update(ctx, e.Id, func(job *state.JobState) error {
+			job.Status = state.StatusError
+			return nil
+		})
+		assert.NoError(t, err)
+
+		_, err = j.start(ctx, e)
+		assert.ErrorIs(t, err, errAlreadyHandled)
+	})
+}
@@ -0,0 +1,291 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/editor"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/douglasdgoulart/video-editor-api/pkg/validator"
+)
+
+var errDependencyFailed = errors.New("a step it depends on failed")
+
+type stepResult struct {
+	files    []string
+	loudness *media.LoudnessStats
+	scenes   []media.Scene
+	err      error
+}
+
+// pipeline schedules the steps of a pipeline job. Every step runs in its own
+// goroutine, which waits for the steps it depends on and starts as soon as
+// they all succeeded and a slot is free, so independent steps run in parallel
+// up to the maxParallelSteps of the job.
+type pipeline struct {
+	job   *Job
+	event *event.Event
+	steps []request.Step
+	// consumed holds the steps that other steps take their input from, whose
+	// outputs are intermediate files unless the step is kept.
+	consumed map[string]bool
+	done     map[string]chan struct{}
+	results  map[string]*stepResult
+	slots    chan struct{}
+
+	mu       sync.Mutex
+	progress []float64
+}
+
+// runPipeline runs the steps of the pipeline request of e and returns the
+// outputs of its final and kept steps. Intermediate outputs are removed once
+// every step is done.
+func (j *Job) runPipeline(ctx context.Context, e *event.Event) ([]string, error) {
+	steps := e.EditorRequest.Steps
+	if err := validator.ValidateSteps(steps); err != nil {
+		return nil, &editor.Error{Code: editor.CodeInvalidRequest, Err: err}
+	}
+
+	p := &pipeline{
+		job:      j,
+		event:    e,
+		steps:    steps,
+		consumed: map[string]bool{},
+		done:     make(map[string]chan struct{}, len(steps)),
+		results:  make(map[string]*stepResult, len(steps)),
+		slots:    make(chan struct{}, max(j.maxParallelSteps, 1)),
+		progress: make([]float64, len(steps)),
+	}
+	for _, step := range steps {
+		p.done[step.Id] = make(chan struct{})
+		p.results[step.Id] = &stepResult{}
+		for _, dependency := range step.Dependencies() {
+			p.consumed[dependency] = true
+		}
+	}
+	p.saveSteps(ctx)
+
+	var wg sync.WaitGroup
+	for i := range steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.runStep(ctx, i)
+		}()
+	}
+	wg.Wait()
+
+	var files []string
+	var err error
+	for _, step := range steps {
+		result := p.results[step.Id]
+		if result.err != nil && err == nil && !errors.Is(result.err, errDependencyFailed) {
+			err = fmt.Errorf("step %s: %w", step.Id, result.err)
+		}
+		if p.isOutput(step) {
+			files = append(files, result.files...)
+			continue
+		}
+		if rmErr := os.RemoveAll(p.stepDir(step)); rmErr != nil {
+			j.logger.Error("error removing intermediate files", "error", rmErr, "job_id", e.Id, "step", step.Id)
+		}
+	}
+
+	return files, err
+}
+
+func (p *pipeline) runStep(ctx context.Context, index int) {
+	step := p.steps[index]
+	result := p.results[step.Id]
+	defer close(p.done[step.Id])
+
+	inputs := map[string][]string{}
+	for _, dependency := range step.Dependencies() {
+		select {
+		case <-ctx.Done():
+			result.err = &editor.Error{Code: editor.CodeCancelled, Err: ctx.Err()}
+			p.finishStep(ctx, index, state.StatusCancelled, result)
+			return
+		case <-p.done[dependency]:
+		}
+
+		dependencyResult := p.results[dependency]
+		if dependencyResult.err != nil {
+			result.err = errDependencyFailed
+			p.finishStep(ctx, index, state.StatusSkipped, result)
+			return
+		}
+		inputs[dependency] = dependencyResult.files
+	}
+	if ctx.Err() != nil {
+		result.err = &editor.Error{Code: editor.CodeCancelled, Err: ctx.Err()}
+		p.finishStep(ctx, index, state.StatusCancelled, result)
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		result.err = &editor.Error{Code: editor.CodeCancelled, Err: ctx.Err()}
+		p.finishStep(ctx, index, state.StatusCancelled, result)
+		return
+	case p.slots <- struct{}{}:
+	}
+	defer func() { <-p.slots }()
+
+	stepEvent := *p.event
+	stepEvent.Step = step.Id
+	stepEvent.EditorRequest = p.stepRequest(step, inputs)
+
+	now := time.Now().UTC()
+	p.updateStep(ctx, index, func(stepState *state.StepState) {
+		stepState.Status = state.StatusRunning
+		stepState.StartedAt = &now
+	})
+
+	editorResult, err := p.job.editor.HandleRequest(ctx, &stepEvent, p.reportProgress(ctx, index))
+	result.files, result.loudness, result.scenes, result.err = editorResult.Files, editorResult.Loudness, editorResult.Scenes, err
+	status := state.StatusSuccess
+	if result.err != nil {
+		status = state.StatusError
+		if ctx.Err() != nil {
+			status = state.StatusCancelled
+		}
+	} else if len(result.files) == 0 && p.consumed[step.Id] {
+		result.err = &editor.Error{Code: editor.CodeFfmpegError, Err: errors.New("step produced no output")}
+		status = state.StatusError
+	}
+	p.finishStep(ctx, index, status, result)
+}
+
+// stepRequest returns the request of a step, taking the inputs referencing
+// another step from the first output of that step, and its input from the
+// pipeline request when it has none of its own.
+func (p *pipeline) stepRequest(step request.Step, outputs map[string][]string) request.EditorRequest {
+	req := step.EditorRequest
+	stepInput := func(input request.Input) request.Input {
+		if input.Step == "" {
+			return input
+		}
+		return request.Input{UploadedFilePath: outputs[input.Step][0]}
+	}
+
+	switch {
+	case len(req.Inputs) > 0:
+		req.Inputs = slices.Clone(req.Inputs)
+		for i, input := range req.Inputs {
+			req.Inputs[i] = stepInput(input)
+		}
+	case req.Input.Step != "":
+		req.Input = stepInput(req.Input)
+	case req.Input.FileURL == "" && req.Input.UploadedFilePath == "":
+		req.Input = p.event.EditorRequest.Input
+	}
+	if req.Timeout == "" {
+		req.Timeout = p.event.EditorRequest.Timeout
+	}
+	return req
+}
+
+func (p *pipeline) isOutput(step request.Step) bool {
+	return step.Keep || !p.consumed[step.Id]
+}
+
+func (p *pipeline) stepDir(step request.Step) string {
+	return filepath.Join(p.job.outputPath, p.event.Tenant, p.event.Id, step.Id)
+}
+
+// saveSteps records every step as queued in the state of the job.
+func (p *pipeline) saveSteps(ctx context.Context) {
+	_, err := p.job.store.Update(context.WithoutCancel(ctx), p.event.Id, func(job *state.JobState) error {
+		job.Steps = make([]state.StepState, len(p.steps))
+		for i, step := range p.steps {
+			job.Steps[i] = state.StepState{Id: step.Id, Status: state.StatusQueued}
+		}
+		return nil
+	})
+	if err != nil {
+		p.job.logger.Error("error saving pipeline steps", "error", err, "job_id", p.event.Id)
+	}
+}
+
+func (p *pipeline) finishStep(ctx context.Context, index int, status state.Status, result *stepResult) {
+	step := p.steps[index]
+	if status == state.StatusSuccess {
+		p.setProgress(index, 100)
+	}
+
+	now := time.Now().UTC()
+	p.updateStep(ctx, index, func(stepState *state.StepState) {
+		stepState.Status = status
+		stepState.FinishedAt = &now
+		if status == state.StatusSuccess {
+			stepState.Progress = 100
+		}
+		stepState.Loudness = result.loudness
+		stepState.Scenes = result.scenes
+		if p.isOutput(step) {
+			stepState.FileLocations = p.job.getFileLocationURL(result.files, p.job.apiHost, p.job.apiPort)
+		}
+		if result.err != nil {
+			stepState.ErrorMsg = result.err.Error()
+			stepState.ErrorCode = errorCode(result.err)
+		}
+	})
+}
+
+// reportProgress saves the progress of a step, along with the progress of
+// the whole pipeline, at most once per progressInterval.
+func (p *pipeline) reportProgress(ctx context.Context, index int) editor.ProgressFunc {
+	var lastReport time.Time
+	return func(progress editor.Progress) {
+		p.setProgress(index, progress.Percent)
+		if progress.Percent < 100 && time.Since(lastReport) < progressInterval {
+			return
+		}
+		lastReport = time.Now()
+
+		p.updateStep(ctx, index, func(stepState *state.StepState) {
+			stepState.Progress = math.Round(progress.Percent*10) / 10
+		})
+	}
+}
+
+func (p *pipeline) setProgress(index int, percent float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress[index] = percent
+}
+
+// updateStep applies fn to the state of the step index and updates the
+// progress of the job, the average progress of its steps.
+func (p *pipeline) updateStep(ctx context.Context, index int, fn func(stepState *state.StepState)) {
+	p.mu.Lock()
+	total := 0.0
+	for _, progress := range p.progress {
+		total += progress
+	}
+	p.mu.Unlock()
+
+	// Steps are still updated once the job is cancelled.
+	_, err := p.job.store.Update(context.WithoutCancel(ctx), p.event.Id, func(job *state.JobState) error {
+		if index >= len(job.Steps) {
+			return nil
+		}
+		fn(&job.Steps[index])
+		job.Progress = math.Round(total/float64(len(p.steps))*10) / 10
+		return nil
+	})
+	if err != nil {
+		p.job.logger.Error("error updating pipeline step", "error", err, "job_id", p.event.Id, "step", p.steps[index].Id)
+	}
+}
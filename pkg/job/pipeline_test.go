@@ -0,0 +1,250 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/editor"
+	"github.com/douglasdgoulart/video-editor-api/pkg/event"
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// stepEditor writes an output per step, recording the inputs it was given
+// and the most steps it ran at once. Steps in failing fail, steps in wait
+// only finish once all of them started, and every step takes at least delay.
+type stepEditor struct {
+	outputPath string
+	failing    map[string]bool
+	wait       *sync.WaitGroup
+	delay      time.Duration
+
+	mu         sync.Mutex
+	inputs     map[string]string
+	running    int
+	maxRunning int
+}
+
+func (s *stepEditor) HandleRequest(ctx context.Context, e *event.Event, onProgress editor.ProgressFunc) (editor.Result, error) {
+	s.mu.Lock()
+	var inputs []string
+	for _, input := range e.EditorRequest.AllInputs() {
+		inputs = append(inputs, input.UploadedFilePath+input.FileURL)
+	}
+	s.inputs[e.Step] = strings.Join(inputs, ",")
+	s.running++
+	s.maxRunning = max(s.maxRunning, s.running)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running--
+		s.mu.Unlock()
+	}()
+
+	time.Sleep(s.delay)
+	if s.wait != nil {
+		s.wait.Done()
+		s.wait.Wait()
+	}
+	if s.failing[e.Step] {
+		return editor.Result{}, &editor.Error{Code: editor.CodeFfmpegError, Err: errors.New("exit status 1")}
+	}
+
+	onProgress(editor.Progress{Percent: 50})
+	path := filepath.Join(s.outputPath, e.Tenant, e.Id, e.Step, "output.mp4")
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return editor.Result{}, err
+	}
+	result := editor.Result{Files: []string{path}}
+	if e.EditorRequest.Loudness != nil {
+		result.Loudness = &media.LoudnessStats{InputIntegrated: -30, NormalizationType: "linear"}
+	}
+	if e.EditorRequest.Output.Mode == request.OutputModeScenes {
+		result.Scenes = []media.Scene{{Start: 0, End: 4.2}, {Start: 4.2, Score: 0.53}}
+	}
+	return result, os.WriteFile(path, []byte(e.Step), 0o644)
+}
+
+func newPipelineJob(t *testing.T, stepEditor *stepEditor) (*Job, *event.Event) {
+	outputPath := t.TempDir()
+	stepEditor.outputPath = outputPath
+	stepEditor.inputs = map[string]string{}
+	j := &Job{
+		editor:     stepEditor,
+		store:      state.NewFileStore(t.TempDir()),
+		logger:     slog.Default(),
+		apiHost:    "localhost",
+		outputPath: outputPath,
+	}
+
+	e := &event.Event{
+		Id:     uuid.New().String(),
+		Tenant: "default",
+		EditorRequest: request.EditorRequest{
+			Input: request.Input{FileURL: "https://example.com/video.mp4"},
+			Steps: []request.Step{
+				{Id: "trim", EditorRequest: request.EditorRequest{Output: request.Output{FilePattern: "trim.mp4"}}},
+				{Id: "scale", EditorRequest: request.EditorRequest{Input: request.Input{Step: "trim"}, Output: request.Output{FilePattern: "scale.mp4"}}},
+				{Id: "thumbnail", EditorRequest: request.EditorRequest{Input: request.Input{Step: "scale"}, Output: request.Output{FilePattern: "thumbnail.jpg"}}},
+				{Id: "audio", EditorRequest: request.EditorRequest{Input: request.Input{Step: "trim"}, Output: request.Output{FilePattern: "audio.mp4"}}},
+			},
+		},
+	}
+	assert.NoError(t, j.store.Save(context.Background(), &state.JobState{Id: e.Id, Status: state.StatusRunning}))
+	return j, e
+}
+
+func TestJob_runPipeline(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Given chained steps, it should pass outputs along and keep the final ones", func(t *testing.T) {
+		stepEditor := &stepEditor{}
+		j, e := newPipelineJob(t, stepEditor)
+
+		files, err := j.runPipeline(ctx, e)
+		assert.NoError(t, err)
+
+		stepDir := func(step string) string { return filepath.Join(j.outputPath, e.Tenant, e.Id, step) }
+		assert.Equal(t, "https://example.com/video.mp4", stepEditor.inputs["trim"])
+		assert.Equal(t, filepath.Join(stepDir("trim"), "output.mp4"), stepEditor.inputs["scale"])
+		assert.Equal(t, filepath.Join(stepDir("scale"), "output.mp4"), stepEditor.inputs["thumbnail"])
+		assert.Equal(t, filepath.Join(stepDir("trim"), "output.mp4"), stepEditor.inputs["audio"])
+
+		assert.ElementsMatch(t, []string{filepath.Join(stepDir("thumbnail"), "output.mp4"), filepath.Join(stepDir("audio"), "output.mp4")}, files)
+		assert.NoDirExists(t, stepDir("trim"))
+		assert.NoDirExists(t, stepDir("scale"))
+
+		job, err := j.store.Get(ctx, e.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, 100.0, job.Progress)
+		for _, step := range job.Steps {
+			assert.Equal(t, state.StatusSuccess, step.Status, step.Id)
+		}
+		assert.Len(t, job.Steps[2].FileLocations, 1)
+		assert.Empty(t, job.Steps[0].FileLocations)
+	})
+
+	t.Run("Given a failing step, it should skip the steps depending on it", func(t *testing.T) {
+		stepEditor := &stepEditor{failing: map[string]bool{"scale": true}}
+		j, e := newPipelineJob(t, stepEditor)
+
+		files, err := j.runPipeline(ctx, e)
+		assert.ErrorContains(t, err, "step scale")
+		assert.Equal(t, editor.CodeFfmpegError, editor.ErrorCode(err))
+		assert.Len(t, files, 1)
+
+		job, err := j.store.Get(ctx, e.Id)
+		assert.NoError(t, err)
+		statuses := map[string]state.Status{}
+		for _, step := range job.Steps {
+			statuses[step.Id] = step.Status
+		}
+		assert.Equal(t, map[string]state.Status{
+			"trim":      state.StatusSuccess,
+			"scale":     state.StatusError,
+			"thumbnail": state.StatusSkipped,
+			"audio":     state.StatusSuccess,
+		}, statuses)
+	})
+
+	t.Run("Given independent steps, it should run them in parallel", func(t *testing.T) {
+		wait := &sync.WaitGroup{}
+		wait.Add(2)
+		stepEditor := &stepEditor{wait: wait}
+		j, e := newPipelineJob(t, stepEditor)
+		j.maxParallelSteps = 2
+		e.EditorRequest.Steps = e.EditorRequest.Steps[:1]
+		e.EditorRequest.Steps = append(e.EditorRequest.Steps, request.Step{Id: "other", EditorRequest: request.EditorRequest{Output: request.Output{FilePattern: "other.mp4"}}})
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := j.runPipeline(ctx, e)
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected both steps to run at the same time")
+		}
+	})
+
+	t.Run("Given independent steps and no parallel steps, it should run them one at a time", func(t *testing.T) {
+		stepEditor := &stepEditor{delay: 20 * time.Millisecond}
+		j, e := newPipelineJob(t, stepEditor)
+		for i := range 4 {
+			e.EditorRequest.Steps = append(e.EditorRequest.Steps, request.Step{Id: fmt.Sprintf("other%d", i), EditorRequest: request.EditorRequest{Output: request.Output{FilePattern: "other.mp4"}}})
+		}
+
+		_, err := j.runPipeline(ctx, e)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, stepEditor.maxRunning)
+	})
+
+	t.Run("Given a step joining other steps, it should take the output of each", func(t *testing.T) {
+		stepEditor := &stepEditor{}
+		j, e := newPipelineJob(t, stepEditor)
+		e.EditorRequest.Steps = append(e.EditorRequest.Steps, request.Step{Id: "joined", EditorRequest: request.EditorRequest{
+			Inputs: []request.Input{{Step: "thumbnail"}, {FileURL: "https://example.com/outro.mp4"}, {Step: "audio"}},
+			Concat: &request.Concat{},
+			Output: request.Output{FilePattern: "joined.mp4"},
+		}})
+
+		files, err := j.runPipeline(ctx, e)
+		assert.NoError(t, err)
+
+		stepDir := func(step string) string { return filepath.Join(j.outputPath, e.Tenant, e.Id, step) }
+		assert.Equal(t, strings.Join([]string{
+			filepath.Join(stepDir("thumbnail"), "output.mp4"),
+			"https://example.com/outro.mp4",
+			filepath.Join(stepDir("audio"), "output.mp4"),
+		}, ","), stepEditor.inputs["joined"])
+		assert.Equal(t, []string{filepath.Join(stepDir("joined"), "output.mp4")}, files)
+	})
+
+	t.Run("Given a step normalizing its loudness, it should record the measured loudness", func(t *testing.T) {
+		j, e := newPipelineJob(t, &stepEditor{})
+		e.EditorRequest.Steps[3].Loudness = &request.Loudness{}
+
+		_, err := j.runPipeline(ctx, e)
+		assert.NoError(t, err)
+
+		job, err := j.store.Get(ctx, e.Id)
+		assert.NoError(t, err)
+		assert.Nil(t, job.Steps[0].Loudness)
+		assert.Equal(t, &media.LoudnessStats{InputIntegrated: -30, NormalizationType: "linear"}, job.Steps[3].Loudness)
+	})
+
+	t.Run("Given a step detecting scenes, it should record the detected scenes", func(t *testing.T) {
+		j, e := newPipelineJob(t, &stepEditor{})
+		e.EditorRequest.Steps[2].Output = request.Output{FilePattern: "scenes.json", Mode: request.OutputModeScenes}
+
+		_, err := j.runPipeline(ctx, e)
+		assert.NoError(t, err)
+
+		job, err := j.store.Get(ctx, e.Id)
+		assert.NoError(t, err)
+		assert.Empty(t, job.Steps[1].Scenes)
+		assert.Equal(t, []media.Scene{{Start: 0, End: 4.2}, {Start: 4.2, Score: 0.53}}, job.Steps[2].Scenes)
+	})
+
+	t.Run("Given steps forming a cycle, it should reject the request", func(t *testing.T) {
+		j, e := newPipelineJob(t, &stepEditor{})
+		e.EditorRequest.Steps[0].Input = request.Input{Step: "audio"}
+
+		_, err := j.runPipeline(ctx, e)
+		assert.Equal(t, editor.CodeInvalidRequest, editor.ErrorCode(err))
+	})
+}
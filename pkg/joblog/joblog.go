@@ -0,0 +1,215 @@
+package joblog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const truncatedNotice = "\n[log truncated]\n"
+
+// Dir returns the directory holding the logs of jobs, under the state path
+// shared by the api and the workers.
+func Dir(statePath string) string {
+	return filepath.Join(statePath, "logs")
+}
+
+// Name returns the name of the log of a pipeline step of the job id, or of
+// the job itself when step is empty.
+func Name(id string, step string) string {
+	if step == "" {
+		return id
+	}
+	return fmt.Sprintf("%s.%s", id, step)
+}
+
+// Path returns the log file of the job id.
+func Path(dir string, id string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s.log", id))
+}
+
+// Writer stores the output of a job in its log file, up to maxSize bytes,
+// and keeps its last lines in memory.
+type Writer struct {
+	mu        sync.Mutex
+	file      *os.File
+	maxSize   int64
+	written   int64
+	truncated bool
+	tail      *Ring
+}
+
+// Create creates the log file of the job id in dir, or only keeps the last
+// lines when dir is empty. A maxSize of 0 means unlimited.
+func Create(dir string, id string, maxSize int64, tailLines int) (*Writer, error) {
+	w := &Writer{
+		maxSize: maxSize,
+		tail:    NewRing(tailLines),
+	}
+	if dir == "" {
+		return w, nil
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(Path(dir, id))
+	if err != nil {
+		return nil, err
+	}
+	w.file = file
+	return w, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.tail.Write(p)
+	if w.file == nil || w.truncated {
+		return len(p), nil
+	}
+
+	data := p
+	if w.maxSize > 0 && w.written+int64(len(data)) > w.maxSize {
+		data = data[:w.maxSize-w.written]
+		w.truncated = true
+	}
+	n, err := w.file.Write(data)
+	w.written += int64(n)
+	if err == nil && w.truncated {
+		_, err = w.file.WriteString(truncatedNotice)
+	}
+	if err != nil {
+		return n, err
+	}
+	return len(p), nil
+}
+
+// Tail returns the last lines written.
+func (w *Writer) Tail() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.tail.Lines()
+}
+
+func (w *Writer) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Close()
+}
+
+// Ring keeps the last lines written to it. A carriage return starts the
+// current line over, as a terminal would, so ffmpeg progress updates do not
+// push out the lines before them.
+type Ring struct {
+	lines   []string
+	next    int
+	full    bool
+	current strings.Builder
+}
+
+func NewRing(size int) *Ring {
+	return &Ring{lines: make([]string, max(size, 1))}
+}
+
+func (r *Ring) Write(p []byte) {
+	for _, b := range p {
+		switch b {
+		case '\n':
+			r.push(r.current.String())
+			r.current.Reset()
+		case '\r':
+			r.current.Reset()
+		default:
+			r.current.WriteByte(b)
+		}
+	}
+}
+
+func (r *Ring) push(line string) {
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Lines returns the kept lines from the oldest, along with the current line
+// when it is not empty.
+func (r *Ring) Lines() []string {
+	var lines []string
+	if r.full {
+		lines = append(lines, r.lines[r.next:]...)
+	}
+	lines = append(lines, r.lines[:r.next]...)
+	if r.current.Len() > 0 {
+		lines = append(lines, r.current.String())
+	}
+	if len(lines) > len(r.lines) {
+		lines = lines[len(lines)-len(r.lines):]
+	}
+	return lines
+}
+
+// Follow copies the log file at path to w as it grows, calling flush after
+// each write, until done reports that the job finished and the whole log was
+// copied. It waits for the file to be created when it does not exist yet.
+func Follow(ctx context.Context, path string, w io.Writer, flush func(), done func() bool, interval time.Duration) error {
+	var file *os.File
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	buf := make([]byte, 32*1024)
+	for {
+		// Checked before reading, so what was written before the job finished
+		// is always copied.
+		finished := done()
+
+		if file == nil {
+			var err error
+			file, err = os.Open(path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+
+		if file != nil {
+			for {
+				n, err := file.Read(buf)
+				if n > 0 {
+					if _, err := w.Write(buf[:n]); err != nil {
+						return err
+					}
+					flush()
+				}
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if finished {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package joblog
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	t.Run("Given more lines than its size, it should keep the last ones", func(t *testing.T) {
+		ring := NewRing(2)
+		ring.Write([]byte("first\nsecond\nthird\nfour"))
+		assert.Equal(t, []string{"third", "four"}, ring.Lines())
+	})
+
+	t.Run("Given progress updates, it should only keep the last one", func(t *testing.T) {
+		ring := NewRing(3)
+		ring.Write([]byte("Input #0\nframe=1\rframe=2\rframe=3\nerror\n"))
+		assert.Equal(t, []string{"Input #0", "frame=3", "error"}, ring.Lines())
+	})
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("Given output over the max size, it should truncate the log file but keep the tail", func(t *testing.T) {
+		dir := t.TempDir()
+		w, err := Create(dir, "job", 8, 1)
+		assert.NoError(t, err)
+
+		_, err = w.Write([]byte("0123456789\nlast line\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+
+		data, err := os.ReadFile(Path(dir, "job"))
+		assert.NoError(t, err)
+		assert.Equal(t, "01234567"+truncatedNotice, string(data))
+		assert.Equal(t, []string{"last line"}, w.Tail())
+	})
+}
+
+func TestFollow(t *testing.T) {
+	t.Run("Given a log written while following it, it should copy it until the job is done", func(t *testing.T) {
+		path := Path(t.TempDir(), "job")
+		var finished atomic.Bool
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			_ = os.WriteFile(path, []byte("first\n"), 0o644)
+			time.Sleep(20 * time.Millisecond)
+			file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+			_, _ = file.WriteString("second\n")
+			file.Close()
+			finished.Store(true)
+		}()
+
+		var out bytes.Buffer
+		err := Follow(context.Background(), path, &out, func() {}, finished.Load, 5*time.Millisecond)
+		assert.NoError(t, err)
+		assert.Equal(t, "first\nsecond\n", out.String())
+	})
+}
@@ -0,0 +1,61 @@
+package media
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// LoudnessStats is the loudness of an input measured by the loudnorm filter
+// of ffmpeg, in LUFS, dBTP and LU, along with the loudness of the input once
+// normalized.
+type LoudnessStats struct {
+	InputIntegrated   float64 `json:"input_integrated"`
+	InputTruePeak     float64 `json:"input_true_peak"`
+	InputRange        float64 `json:"input_range"`
+	InputThreshold    float64 `json:"input_threshold"`
+	OutputIntegrated  float64 `json:"output_integrated"`
+	OutputTruePeak    float64 `json:"output_true_peak"`
+	OutputRange       float64 `json:"output_range"`
+	OutputThreshold   float64 `json:"output_threshold"`
+	NormalizationType string  `json:"normalization_type"`
+	TargetOffset      float64 `json:"target_offset"`
+}
+
+// ErrSilent is returned for the stats of silent audio, whose loudness is
+// infinitely low and cannot be normalized.
+var ErrSilent = errors.New("the audio is silent")
+
+// ParseLoudnorm parses the stats the loudnorm filter prints with
+// print_format=json, whose values are all strings.
+func ParseLoudnorm(data []byte) (*LoudnessStats, error) {
+	var measured map[string]string
+	if err := json.Unmarshal(data, &measured); err != nil {
+		return nil, fmt.Errorf("parsing loudnorm stats: %w", err)
+	}
+	if integrated, err := strconv.ParseFloat(measured["input_i"], 64); err == nil && math.IsInf(integrated, -1) {
+		return nil, ErrSilent
+	}
+
+	stats := &LoudnessStats{NormalizationType: measured["normalization_type"]}
+	for key, value := range map[string]*float64{
+		"input_i":       &stats.InputIntegrated,
+		"input_tp":      &stats.InputTruePeak,
+		"input_lra":     &stats.InputRange,
+		"input_thresh":  &stats.InputThreshold,
+		"output_i":      &stats.OutputIntegrated,
+		"output_tp":     &stats.OutputTruePeak,
+		"output_lra":    &stats.OutputRange,
+		"output_thresh": &stats.OutputThreshold,
+		"target_offset": &stats.TargetOffset,
+	} {
+		parsed, err := strconv.ParseFloat(measured[key], 64)
+		if err != nil || math.IsInf(parsed, 0) || math.IsNaN(parsed) {
+			return nil, fmt.Errorf("invalid loudnorm stat %s %q", key, measured[key])
+		}
+		*value = parsed
+	}
+	return stats, nil
+}
@@ -0,0 +1,41 @@
+package media
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLoudnorm(t *testing.T) {
+	t.Run("Given the stats printed by loudnorm, it should parse them", func(t *testing.T) {
+		stats, err := ParseLoudnorm([]byte(`{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-23.04",
+	"output_tp" : "-1.00",
+	"output_lra" : "7.10",
+	"output_thresh" : "-33.58",
+	"normalization_type" : "linear",
+	"target_offset" : "0.04"
+}`))
+		assert.NoError(t, err)
+		assert.Equal(t, &LoudnessStats{
+			InputIntegrated: -27.61, InputTruePeak: -4.47, InputRange: 18.06, InputThreshold: -39.2,
+			OutputIntegrated: -23.04, OutputTruePeak: -1, OutputRange: 7.1, OutputThreshold: -33.58,
+			NormalizationType: "linear", TargetOffset: 0.04,
+		}, stats)
+	})
+
+	t.Run("Given the stats of a silent input, it should fail with ErrSilent", func(t *testing.T) {
+		_, err := ParseLoudnorm([]byte(`{"input_i" : "-inf", "input_tp" : "-inf", "input_lra" : "0.00", "input_thresh" : "-70.00",` +
+			`"output_i" : "-inf", "output_tp" : "-inf", "output_lra" : "0.00", "output_thresh" : "-70.00", "target_offset" : "inf"}`))
+		assert.ErrorIs(t, err, ErrSilent)
+	})
+
+	t.Run("Given no stats, it should fail", func(t *testing.T) {
+		_, err := ParseLoudnorm(nil)
+		assert.Error(t, err)
+	})
+}
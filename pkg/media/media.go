@@ -0,0 +1,127 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"regexp"
+)
+
+const sniffLength = 512
+
+var ErrUnsupportedMedia = errors.New("file is not a supported media container")
+
+var srtRegex = regexp.MustCompile(`^\s*[0-9]+\r?\n[0-9]{2}:[0-9]{2}:[0-9]{2},[0-9]{3} --> `)
+
+// Analyzer is an io.Writer that computes the SHA-256 checksum of everything
+// written through it and keeps the first bytes to sniff the media container.
+type Analyzer struct {
+	hash   hash.Hash
+	header []byte
+}
+
+func NewAnalyzer() *Analyzer {
+	return &Analyzer{
+		hash:   sha256.New(),
+		header: make([]byte, 0, sniffLength),
+	}
+}
+
+func (a *Analyzer) Write(p []byte) (int, error) {
+	if missing := sniffLength - len(a.header); missing > 0 {
+		a.header = append(a.header, p[:min(missing, len(p))]...)
+	}
+	return a.hash.Write(p)
+}
+
+func (a *Analyzer) Checksum() string {
+	return hex.EncodeToString(a.hash.Sum(nil))
+}
+
+func (a *Analyzer) Container() string {
+	return Sniff(a.header)
+}
+
+// Detect returns the container of the file at path, trusting the sniffed
+// container when the magic bytes were recognized and falling back to ffprobe
+// otherwise.
+func Detect(ctx context.Context, prober *Prober, path string, sniffed string) (string, error) {
+	if sniffed != "" {
+		return sniffed, nil
+	}
+	if prober == nil {
+		return "", ErrUnsupportedMedia
+	}
+
+	info, err := prober.Probe(ctx, path)
+	if err != nil || len(info.Streams) == 0 {
+		return "", ErrUnsupportedMedia
+	}
+
+	return info.Container(), nil
+}
+
+// Sniff identifies the media container from the magic bytes at the start of a
+// file. It returns the usual file extension of the container, or an empty
+// string when it is not recognized.
+func Sniff(header []byte) string {
+	switch {
+	case len(header) >= 12 && bytes.Equal(header[4:8], []byte("ftyp")):
+		if bytes.Equal(header[8:12], []byte("qt  ")) {
+			return "mov"
+		}
+		return "mp4"
+	case bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		if bytes.Contains(header, []byte("webm")) {
+			return "webm"
+		}
+		return "mkv"
+	case len(header) >= 12 && bytes.HasPrefix(header, []byte("RIFF")):
+		switch string(header[8:12]) {
+		case "AVI ":
+			return "avi"
+		case "WAVE":
+			return "wav"
+		case "WEBP":
+			return "webp"
+		}
+	case len(header) > 188 && header[0] == 0x47 && header[188] == 0x47:
+		return "ts"
+	case bytes.HasPrefix(header, []byte("FLV")):
+		return "flv"
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return "ogg"
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return "flac"
+	case bytes.HasPrefix(header, []byte("ID3")):
+		return "mp3"
+	case bytes.HasPrefix(header, []byte{0x00, 0x00, 0x01, 0xBA}):
+		return "mpg"
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xF6 == 0xF0:
+		return "aac"
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0:
+		return "mp3"
+	case bytes.HasPrefix(header, []byte{0x89, 'P', 'N', 'G'}):
+		return "png"
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpg"
+	case bytes.HasPrefix(header, []byte("GIF8")):
+		return "gif"
+	}
+
+	// Subtitles are text, possibly starting with a byte order mark.
+	text := bytes.TrimPrefix(header, []byte("\xEF\xBB\xBF"))
+	switch {
+	case bytes.HasPrefix(text, []byte("WEBVTT")):
+		return "vtt"
+	case bytes.HasPrefix(text, []byte("[Script Info]")):
+		return "ass"
+	case srtRegex.Match(text):
+		return "srt"
+	}
+
+	return ""
+}
@@ -0,0 +1,44 @@
+package media
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSniff(t *testing.T) {
+	video, err := os.ReadFile("../../internal/testdata/testsrc.mp4")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{name: "mp4", header: video[:sniffLength], want: "mp4"},
+		{name: "quicktime", header: []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x02\x00"), want: "mov"},
+		{name: "webm", header: []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm"), want: "webm"},
+		{name: "wav", header: []byte("RIFF\x24\x08\x00\x00WAVEfmt "), want: "wav"},
+		{name: "png", header: []byte("\x89PNG\r\n\x1a\n"), want: "png"},
+		{name: "srt", header: []byte("1\r\n00:00:01,000 --> 00:00:02,500\r\nHello"), want: "srt"},
+		{name: "vtt", header: []byte("\xEF\xBB\xBFWEBVTT\n\n00:01.000 --> 00:02.500\nHello"), want: "vtt"},
+		{name: "ass", header: []byte("[Script Info]\nScriptType: v4.00+"), want: "ass"},
+		{name: "text", header: []byte("definitely not a video"), want: ""},
+		{name: "empty", header: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Sniff(tt.header))
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	t.Run("Given an unknown header and no prober, it should reject the file", func(t *testing.T) {
+		_, err := Detect(context.Background(), nil, "file", "")
+		assert.ErrorIs(t, err, ErrUnsupportedMedia)
+	})
+}
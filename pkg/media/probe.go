@@ -0,0 +1,146 @@
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Stream struct {
+	Index         int    `json:"index"`
+	CodecType     string `json:"codec_type"`
+	CodecName     string `json:"codec_name"`
+	Width         int    `json:"width,omitempty"`
+	Height        int    `json:"height,omitempty"`
+	AvgFrameRate  string `json:"avg_frame_rate,omitempty"`
+	PixFmt        string `json:"pix_fmt,omitempty"`
+	SampleRate    string `json:"sample_rate,omitempty"`
+	Channels      int    `json:"channels,omitempty"`
+	ChannelLayout string `json:"channel_layout,omitempty"`
+}
+
+// FrameRate returns the average frame rate of the stream, such as 29.97 for
+// "30000/1001", or zero when it is unknown.
+func (s Stream) FrameRate() float64 {
+	numerator, denominator, found := strings.Cut(s.AvgFrameRate, "/")
+	rate, err := strconv.ParseFloat(numerator, 64)
+	if err != nil {
+		return 0
+	}
+	if found {
+		divisor, err := strconv.ParseFloat(denominator, 64)
+		if err != nil || divisor == 0 {
+			return 0
+		}
+		rate /= divisor
+	}
+	return rate
+}
+
+type Format struct {
+	FormatName string `json:"format_name"`
+	StartTime  string `json:"start_time,omitempty"`
+	Duration   string `json:"duration,omitempty"`
+	Size       string `json:"size,omitempty"`
+}
+
+type ProbeResult struct {
+	Format  Format   `json:"format"`
+	Streams []Stream `json:"streams"`
+}
+
+// Container returns the first name ffprobe reports for the format, e.g. "mov"
+// for "mov,mp4,m4a,3gp,3g2,mj2".
+func (p *ProbeResult) Container() string {
+	return strings.Split(p.Format.FormatName, ",")[0]
+}
+
+// Duration returns the duration of the media in seconds, or zero when it is
+// unknown.
+func (p *ProbeResult) Duration() float64 {
+	duration, _ := strconv.ParseFloat(p.Format.Duration, 64)
+	return duration
+}
+
+// StartTime returns the time the first stream of the media starts at, in
+// seconds, which times of requests are relative to.
+func (p *ProbeResult) StartTime() float64 {
+	start, _ := strconv.ParseFloat(p.Format.StartTime, 64)
+	return start
+}
+
+type Prober struct {
+	BinaryPath string
+}
+
+// NewProber returns nil when no ffprobe binary is configured, so callers can
+// skip probing altogether.
+func NewProber(binaryPath string) *Prober {
+	if binaryPath == "" {
+		return nil
+	}
+	return &Prober{BinaryPath: binaryPath}
+}
+
+func (p *Prober) Probe(ctx context.Context, path string) (*ProbeResult, error) {
+	cmd := exec.CommandContext(ctx, p.BinaryPath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path,
+	)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var result ProbeResult
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Keyframes returns the times of the keyframes of the first video stream of
+// path between start and end, in seconds from the start of the media, as
+// reported by ffprobe without decoding the video. offset is the start time
+// of the media, which ffprobe reports times from.
+func (p *Prober) Keyframes(ctx context.Context, path string, offset float64, start float64, end float64) ([]float64, error) {
+	cmd := exec.CommandContext(ctx, p.BinaryPath,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-read_intervals", fmt.Sprintf("%f%%%f", offset+start, offset+end),
+		"-show_entries", "packet=pts_time,flags",
+		"-print_format", "csv=p=0",
+		path,
+	)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var keyframes []float64
+	for _, line := range strings.Split(string(out), "\n") {
+		ptsTime, flags, _ := strings.Cut(strings.TrimSpace(line), ",")
+		if !strings.HasPrefix(flags, "K") {
+			continue
+		}
+		time, err := strconv.ParseFloat(ptsTime, 64)
+		if err != nil {
+			continue
+		}
+		if time -= offset; time >= start && time <= end {
+			keyframes = append(keyframes, time)
+		}
+	}
+	slices.Sort(keyframes)
+	return keyframes, nil
+}
@@ -0,0 +1,41 @@
+package media
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream_FrameRate(t *testing.T) {
+	tests := []struct {
+		name         string
+		avgFrameRate string
+		want         float64
+	}{
+		{name: "fraction", avgFrameRate: "30000/1001", want: 30000.0 / 1001},
+		{name: "integer", avgFrameRate: "25", want: 25},
+		{name: "unknown", avgFrameRate: "0/0", want: 0},
+		{name: "empty", avgFrameRate: "", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Stream{AvgFrameRate: tt.avgFrameRate}.FrameRate())
+		})
+	}
+}
+
+func TestProber_Keyframes(t *testing.T) {
+	t.Run("Given packets of a media starting late, it should return its keyframes within the interval", func(t *testing.T) {
+		binary := filepath.Join(t.TempDir(), "ffprobe")
+		script := "#!/bin/sh\nprintf '1.400000,K__\\n11.400000,K__\\n1.440000,___\\n5.400000,K_\\n9.400000,K__\\n'\n"
+		assert.NoError(t, os.WriteFile(binary, []byte(script), 0o755))
+
+		keyframes, err := NewProber(binary).Keyframes(context.Background(), "input.mp4", 1.4, 1, 9)
+		assert.NoError(t, err)
+		assert.InDeltaSlice(t, []float64{4, 8}, keyframes, 1e-9)
+	})
+}
@@ -0,0 +1,58 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Scene is a scene of a video starting at Start and ending at End, in
+// seconds, whose change from the previous scene scored Score, from 0 to 1.
+// Thumbnail is the name of the thumbnail of its first frame, if any.
+type Scene struct {
+	Start     float64 `json:"start"`
+	End       float64 `json:"end,omitempty"`
+	Score     float64 `json:"score"`
+	Thumbnail string  `json:"thumbnail,omitempty"`
+}
+
+// ParseScenes parses the frames the metadata filter of ffmpeg prints after
+// selecting the scene changes of a video, returning a scene per frame that
+// lasts until the next one. The end of the last scene is left to the caller.
+func ParseScenes(data []byte) ([]Scene, error) {
+	var scenes []Scene
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "frame:") {
+			for _, field := range strings.Fields(line) {
+				value, ok := strings.CutPrefix(field, "pts_time:")
+				if !ok {
+					continue
+				}
+				start, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid scene time %q", value)
+				}
+				if len(scenes) > 0 {
+					scenes[len(scenes)-1].End = start
+				}
+				scenes = append(scenes, Scene{Start: start})
+			}
+			continue
+		}
+
+		value, ok := strings.CutPrefix(line, "lavfi.scene_score=")
+		if !ok || len(scenes) == 0 {
+			continue
+		}
+		score, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scene score %q", value)
+		}
+		scenes[len(scenes)-1].Score = score
+	}
+	return scenes, scanner.Err()
+}
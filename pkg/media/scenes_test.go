@@ -0,0 +1,26 @@
+package media
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScenes(t *testing.T) {
+	t.Run("Given the selected frames, it should return a scene per frame lasting until the next one", func(t *testing.T) {
+		data := []byte("frame:0    pts:0       pts_time:0\nlavfi.scene_score=0.000000\nframe:1    pts:53760   pts_time:4.2\nlavfi.scene_score=0.532100\nframe:2    pts:115200  pts_time:9\nlavfi.scene_score=0.410000\n")
+
+		scenes, err := ParseScenes(data)
+		assert.NoError(t, err)
+		assert.Equal(t, []Scene{
+			{Start: 0, End: 4.2, Score: 0},
+			{Start: 4.2, End: 9, Score: 0.5321},
+			{Start: 9, Score: 0.41},
+		}, scenes)
+	})
+
+	t.Run("Given an invalid score, it should fail", func(t *testing.T) {
+		_, err := ParseScenes([]byte("frame:0    pts:0       pts_time:0\nlavfi.scene_score=high\n"))
+		assert.ErrorContains(t, err, "invalid scene score")
+	})
+}
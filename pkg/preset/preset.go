@@ -0,0 +1,398 @@
+package preset
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/validator"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound   = errors.New("preset not found")
+	ErrExists     = errors.New("preset already exists")
+	ErrInvalidRef = errors.New("invalid preset reference")
+	ErrParams     = errors.New("invalid preset params")
+)
+
+var placeholderRegex = regexp.MustCompile(`\{\{\s*([a-z0-9_]+)\s*\}\}`)
+
+// Preset is a version of a named EditorRequest template. Its string fields
+// may hold {{param}} placeholders, filled by the params of the requests
+// using the preset or by the defaults of the preset.
+type Preset struct {
+	Name        string                `json:"name"`
+	Version     int                   `json:"version"`
+	Description string                `json:"description,omitempty"`
+	Params      map[string]string     `json:"params,omitempty"`
+	Request     request.EditorRequest `json:"request"`
+	Owner       string                `json:"owner,omitempty"`
+	CreatedAt   time.Time             `json:"created_at"`
+}
+
+// Ref returns the reference of the preset version, such as "web-720p@v3".
+func (p *Preset) Ref() string {
+	return fmt.Sprintf("%s@v%d", p.Name, p.Version)
+}
+
+// Validate checks the name of the preset, its params and its template, which
+// can not reference another preset.
+func (p *Preset) Validate() error {
+	if err := validator.ValidateName("name", p.Name); err != nil {
+		return err
+	}
+	for param := range p.Params {
+		if !placeholderRegex.MatchString("{{" + param + "}}") {
+			return fmt.Errorf("%w: %q is not a valid param name", ErrParams, param)
+		}
+	}
+	if p.Request.Preset != "" || len(p.Request.PresetParams) > 0 {
+		return errors.New("field request.preset is not supported in presets")
+	}
+	for _, step := range p.Request.Steps {
+		if step.Preset != "" {
+			return errors.New("field request.steps.preset is not supported in presets")
+		}
+	}
+	return nil
+}
+
+// ParseRef splits a reference such as "web-720p@v3" into the name and the
+// version of a preset, the version being 0 for references to the latest
+// version, such as "web-720p".
+func ParseRef(ref string) (string, int, error) {
+	name, version, versioned := strings.Cut(ref, "@")
+	if validator.ValidateName("preset", name) != nil {
+		return "", 0, fmt.Errorf("%w: %q", ErrInvalidRef, ref)
+	}
+	if !versioned {
+		return name, 0, nil
+	}
+
+	number, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	if err != nil || !strings.HasPrefix(version, "v") || number <= 0 {
+		return "", 0, fmt.Errorf("%w: %q", ErrInvalidRef, ref)
+	}
+	return name, number, nil
+}
+
+// Apply returns the template of the preset with its placeholders filled and
+// the fields set by req overriding its own. Maps, such as the filters, are
+// merged while other fields are replaced. The returned request records the
+// preset version it was made from.
+func (p *Preset) Apply(req request.EditorRequest) (request.EditorRequest, error) {
+	template, err := toMap(p.Request)
+	if err != nil {
+		return req, err
+	}
+
+	params, err := p.params(template, req.PresetParams)
+	if err != nil {
+		return req, err
+	}
+	fill(template, params)
+
+	overrides := req
+	overrides.Preset = ""
+	overrides.PresetParams = nil
+	overridesMap, err := toMap(overrides)
+	if err != nil {
+		return req, err
+	}
+	merge(template, overridesMap)
+
+	data, err := json.Marshal(template)
+	if err != nil {
+		return req, err
+	}
+	var resolved request.EditorRequest
+	if err := json.Unmarshal(data, &resolved); err != nil {
+		return req, err
+	}
+	resolved.Preset = p.Ref()
+	resolved.PresetParams = req.PresetParams
+
+	return resolved, nil
+}
+
+// params returns the value of every placeholder of template, rejecting
+// unknown and missing params.
+func (p *Preset) params(template map[string]any, values map[string]string) (map[string]string, error) {
+	var placeholders []string
+	collect(template, &placeholders)
+
+	params := make(map[string]string, len(placeholders))
+	for _, placeholder := range placeholders {
+		value, ok := values[placeholder]
+		if !ok {
+			value, ok = p.Params[placeholder]
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: missing param %q", ErrParams, placeholder)
+		}
+		params[placeholder] = value
+	}
+	for param := range values {
+		if !slices.Contains(placeholders, param) {
+			return nil, fmt.Errorf("%w: unknown param %q", ErrParams, param)
+		}
+	}
+
+	return params, nil
+}
+
+func toMap(req request.EditorRequest) (map[string]any, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	return m, json.Unmarshal(data, &m)
+}
+
+func collect(value any, placeholders *[]string) {
+	switch value := value.(type) {
+	case string:
+		for _, match := range placeholderRegex.FindAllStringSubmatch(value, -1) {
+			if !slices.Contains(*placeholders, match[1]) {
+				*placeholders = append(*placeholders, match[1])
+			}
+		}
+	case map[string]any:
+		for _, v := range value {
+			collect(v, placeholders)
+		}
+	case []any:
+		for _, v := range value {
+			collect(v, placeholders)
+		}
+	}
+}
+
+func fill(value any, params map[string]string) any {
+	switch value := value.(type) {
+	case string:
+		return placeholderRegex.ReplaceAllStringFunc(value, func(placeholder string) string {
+			return params[placeholderRegex.FindStringSubmatch(placeholder)[1]]
+		})
+	case map[string]any:
+		for k, v := range value {
+			value[k] = fill(v, params)
+		}
+	case []any:
+		for i, v := range value {
+			value[i] = fill(v, params)
+		}
+	}
+	return value
+}
+
+func merge(dst map[string]any, src map[string]any) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]any)
+		dstMap, dstIsMap := dst[k].(map[string]any)
+		if srcIsMap && dstIsMap {
+			merge(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// Store keeps every version of the presets of each tenant as a JSON document
+// under <state path>/presets/<tenant>/<name>/. Versions are never modified,
+// so requests keep resolving to the same template.
+type Store struct {
+	path string
+}
+
+func NewStore(statePath string) *Store {
+	return &Store{
+		path: filepath.Join(statePath, "presets"),
+	}
+}
+
+// Create saves the first version of a new preset of tenant.
+func (s *Store) Create(tenant string, p *Preset) error {
+	p.Version = 1
+	err := s.write(tenant, p)
+	if errors.Is(err, os.ErrExist) {
+		return ErrExists
+	}
+	return err
+}
+
+// Update saves the next version of an existing preset of tenant.
+func (s *Store) Update(tenant string, p *Preset) error {
+	for {
+		latest, err := s.Get(tenant, p.Name, 0)
+		if err != nil {
+			return err
+		}
+
+		// Another replica may save the same version first.
+		p.Version = latest.Version + 1
+		err = s.write(tenant, p)
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+	}
+}
+
+// Get returns a version of a preset of tenant, or its latest version when
+// version is 0.
+func (s *Store) Get(tenant string, name string, version int) (*Preset, error) {
+	if version == 0 {
+		versions, err := s.versions(tenant, name)
+		if err != nil {
+			return nil, err
+		}
+		version = versions[len(versions)-1]
+	}
+
+	data, err := os.ReadFile(s.versionPath(tenant, name, version))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var p Preset
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Resolve returns the preset version of ref, such as "web-720p@v3".
+func (s *Store) Resolve(tenant string, ref string) (*Preset, error) {
+	name, version, err := ParseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(tenant, name, version)
+}
+
+// List returns the latest version of every preset of tenant, by name.
+func (s *Store) List(tenant string) ([]*Preset, error) {
+	entries, err := os.ReadDir(filepath.Join(s.path, tenant))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var presets []*Preset
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		p, err := s.Get(tenant, entry.Name(), 0)
+		if err != nil {
+			continue
+		}
+		presets = append(presets, p)
+	}
+	return presets, nil
+}
+
+// Versions returns every version of a preset of tenant, oldest first.
+func (s *Store) Versions(tenant string, name string) ([]*Preset, error) {
+	versions, err := s.versions(tenant, name)
+	if err != nil {
+		return nil, err
+	}
+
+	presets := make([]*Preset, 0, len(versions))
+	for _, version := range versions {
+		p, err := s.Get(tenant, name, version)
+		if err != nil {
+			return nil, err
+		}
+		presets = append(presets, p)
+	}
+	return presets, nil
+}
+
+// Delete removes every version of a preset of tenant. Jobs already submitted
+// are not affected, as their requests hold the resolved template.
+func (s *Store) Delete(tenant string, name string) error {
+	if _, err := s.versions(tenant, name); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.presetDir(tenant, name))
+}
+
+func (s *Store) versions(tenant string, name string) ([]int, error) {
+	if validator.ValidateName("name", name) != nil {
+		return nil, ErrNotFound
+	}
+
+	entries, err := os.ReadDir(s.presetDir(tenant, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var versions []int
+	for _, entry := range entries {
+		version, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// write saves a version of a preset, failing with os.ErrExist when it was
+// already saved. The document is linked into place, so it is only visible
+// once complete and never overwritten.
+func (s *Store) write(tenant string, p *Preset) error {
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	dir := s.presetDir(tenant, p.Name)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, fmt.Sprintf("%s.tmp", uuid.New().String()))
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	return os.Link(tmp, s.versionPath(tenant, p.Name, p.Version))
+}
+
+func (s *Store) presetDir(tenant string, name string) string {
+	return filepath.Join(s.path, tenant, name)
+}
+
+func (s *Store) versionPath(tenant string, name string, version int) string {
+	return filepath.Join(s.presetDir(tenant, name), fmt.Sprintf("%d.json", version))
+}
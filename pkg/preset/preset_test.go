@@ -0,0 +1,107 @@
+package preset
+
+import (
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPreset() *Preset {
+	return &Preset{
+		Name:   "web-720p",
+		Params: map[string]string{"height": "720"},
+		Request: request.EditorRequest{
+			Codec:        "libx264",
+			Bitrate:      "{{bitrate}}",
+			Filters:      map[string]string{"scale": "-2:{{height}}", "fps": "30"},
+			ExtraOptions: "-preset veryfast",
+			Output:       request.Output{FilePattern: "video.mp4"},
+		},
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	t.Run("Given references with and without a version, it should split them", func(t *testing.T) {
+		name, version, err := ParseRef("web-720p@v3")
+		assert.NoError(t, err)
+		assert.Equal(t, "web-720p", name)
+		assert.Equal(t, 3, version)
+
+		_, version, err = ParseRef("web-720p")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, version)
+
+		for _, ref := range []string{"web-720p@3", "web-720p@v0", "../web@v1", ""} {
+			_, _, err = ParseRef(ref)
+			assert.ErrorIs(t, err, ErrInvalidRef, ref)
+		}
+	})
+}
+
+func TestPreset_Apply(t *testing.T) {
+	t.Run("Given params and overrides, it should fill and override the template", func(t *testing.T) {
+		p := newPreset()
+		p.Version = 2
+
+		resolved, err := p.Apply(request.EditorRequest{
+			Preset:       "web-720p",
+			PresetParams: map[string]string{"bitrate": "2M"},
+			Input:        request.Input{FileURL: "https://example.com/video.mp4"},
+			Filters:      map[string]string{"fps": "60"},
+			ExtraOptions: "-preset slow",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "web-720p@v2", resolved.Preset)
+		assert.Equal(t, "libx264", resolved.Codec)
+		assert.Equal(t, "2M", resolved.Bitrate)
+		assert.Equal(t, map[string]string{"scale": "-2:720", "fps": "60"}, resolved.Filters)
+		assert.Equal(t, "-preset slow", resolved.ExtraOptions)
+		assert.Equal(t, "video.mp4", resolved.Output.FilePattern)
+		assert.Equal(t, "https://example.com/video.mp4", resolved.Input.FileURL)
+
+		// The template itself is left untouched.
+		assert.Equal(t, "{{bitrate}}", p.Request.Bitrate)
+	})
+
+	t.Run("Given missing or unknown params, it should fail", func(t *testing.T) {
+		_, err := newPreset().Apply(request.EditorRequest{})
+		assert.ErrorIs(t, err, ErrParams)
+
+		_, err = newPreset().Apply(request.EditorRequest{PresetParams: map[string]string{"bitrate": "2M", "width": "1280"}})
+		assert.ErrorIs(t, err, ErrParams)
+	})
+}
+
+func TestStore(t *testing.T) {
+	t.Run("Given a preset updated twice, it should keep every version", func(t *testing.T) {
+		store := NewStore(t.TempDir())
+		assert.NoError(t, store.Create("team-a", newPreset()))
+		assert.ErrorIs(t, store.Create("team-a", newPreset()), ErrExists)
+
+		for range 2 {
+			assert.NoError(t, store.Update("team-a", newPreset()))
+		}
+
+		latest, err := store.Resolve("team-a", "web-720p")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, latest.Version)
+		first, err := store.Resolve("team-a", "web-720p@v1")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, first.Version)
+
+		versions, err := store.Versions("team-a", "web-720p")
+		assert.NoError(t, err)
+		assert.Len(t, versions, 3)
+
+		// Presets belong to their tenant.
+		_, err = store.Resolve("team-b", "web-720p")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, store.Update("team-b", newPreset()), ErrNotFound)
+
+		assert.NoError(t, store.Delete("team-a", "web-720p"))
+		presets, err := store.List("team-a")
+		assert.NoError(t, err)
+		assert.Empty(t, presets)
+	})
+}
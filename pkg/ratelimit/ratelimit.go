@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+)
+
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Limit describes a token bucket refilled at Rate tokens per second and
+// holding at most Burst tokens.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// LimitFor builds the limit of a configured route, allowing Requests per
+// Period with bursts of Burst requests, defaulting to Requests.
+func LimitFor(route configuration.RateLimitRoute) Limit {
+	burst := route.Burst
+	if burst <= 0 {
+		burst = route.Requests
+	}
+	return Limit{
+		Rate:  float64(route.Requests) / route.Period.Seconds(),
+		Burst: burst,
+	}
+}
+
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when
+	// the request was allowed.
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	// Allow takes a token from the bucket identified by key.
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// NewLimiter returns the limiter of the configured backend. The in-memory
+// limiter only limits requests reaching the same replica, the redis one is
+// shared by every replica of the api.
+func NewLimiter(cfg configuration.RateLimitConfig) (Limiter, error) {
+	switch cfg.Backend {
+	case "", BackendMemory:
+		return NewMemoryLimiter(), nil
+	case BackendRedis:
+		return NewRedisLimiter(cfg.Redis), nil
+	}
+	return nil, fmt.Errorf("unknown rate limit backend %q", cfg.Backend)
+}
+
+// take refills a bucket holding tokens, last updated elapsed ago, and takes
+// a token from it when there is one. It returns the tokens left along with
+// the result.
+func take(tokens float64, elapsed time.Duration, limit Limit) (float64, Result) {
+	tokens = math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.Rate)
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	return tokens, resultFor(allowed, tokens, limit)
+}
+
+// resultFor describes a bucket left with tokens after a request.
+func resultFor(allowed bool, tokens float64, limit Limit) Result {
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     seconds((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitFor(t *testing.T) {
+	t.Run("Given a route without a burst, it should allow bursts of the requests per period", func(t *testing.T) {
+		limit := LimitFor(configuration.RateLimitRoute{Requests: 60, Period: time.Minute})
+		assert.Equal(t, Limit{Rate: 1, Burst: 60}, limit)
+	})
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	limit := Limit{Rate: 1, Burst: 2}
+
+	t.Run("Given a bucket emptied by a burst, it should refill it over time", func(t *testing.T) {
+		now := time.Now()
+		limiter := NewMemoryLimiter()
+		limiter.now = func() time.Time { return now }
+
+		for remaining := 1; remaining >= 0; remaining-- {
+			result, err := limiter.Allow(ctx, "key", limit)
+			assert.NoError(t, err)
+			assert.True(t, result.Allowed)
+			assert.Equal(t, remaining, result.Remaining)
+		}
+
+		result, _ := limiter.Allow(ctx, "key", limit)
+		assert.False(t, result.Allowed)
+		assert.Equal(t, time.Second, result.RetryAfter)
+		assert.Equal(t, 2*time.Second, result.Reset)
+
+		result, _ = limiter.Allow(ctx, "other", limit)
+		assert.True(t, result.Allowed)
+
+		now = now.Add(time.Second)
+		result, _ = limiter.Allow(ctx, "key", limit)
+		assert.True(t, result.Allowed)
+	})
+
+	t.Run("Given idle keys, it should drop their full buckets", func(t *testing.T) {
+		now := time.Now()
+		limiter := NewMemoryLimiter()
+		limiter.now = func() time.Time { return now }
+		_, _ = limiter.Allow(ctx, "key", limit)
+
+		now = now.Add(sweepInterval)
+		_, _ = limiter.Allow(ctx, "other", limit)
+		assert.NotContains(t, limiter.buckets, "key")
+	})
+}
+
+func TestRedisLimiter(t *testing.T) {
+	t.Run("Given limiters sharing a redis, it should share their buckets", func(t *testing.T) {
+		ctx := context.Background()
+		server := miniredis.RunT(t)
+		limit := Limit{Rate: 1, Burst: 2}
+
+		first := NewRedisLimiter(configuration.RedisConfig{Address: server.Addr()})
+		second := NewRedisLimiter(configuration.RedisConfig{Address: server.Addr()})
+		defer first.Close()
+		defer second.Close()
+
+		result, err := first.Allow(ctx, "key", limit)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 1, result.Remaining)
+
+		result, err = second.Allow(ctx, "key", limit)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 0, result.Remaining)
+
+		result, err = first.Allow(ctx, "key", limit)
+		assert.NoError(t, err)
+		assert.False(t, result.Allowed)
+		assert.Greater(t, result.RetryAfter, time.Duration(0))
+		assert.True(t, server.Exists(keyPrefix+"key"))
+	})
+}
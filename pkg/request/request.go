@@ -1,17 +1,225 @@
 package request
 
+import "slices"
+
 type Input struct {
 	FileURL          string `json:"file_url,omitempty"`
 	UploadedFilePath string `json:"uploaded_file_path,omitempty"`
+	UploadId         string `json:"upload_id,omitempty"`
+	SHA256           string `json:"sha256,omitempty"`
+	Container        string `json:"container,omitempty"`
+	// Step makes the first output of an earlier pipeline step the input.
+	Step string `json:"step,omitempty"`
 }
 
 type Output struct {
 	FilePattern string `json:"file_pattern,omitempty" required:"true"`
 	WebhookURL  string `json:"webhook_url,omitempty"`
+	// Mode packages the output for adaptive bitrate streaming with one
+	// rendition per step of Ladder, "hls" or "dash", tiles thumbnails into
+	// sprite sheets, "sprite", detects the scene changes of the video,
+	// "scenes", cuts it into clips, "split", or writes a single file when
+	// empty.
+	Mode            string      `json:"mode,omitempty"`
+	Ladder          []Rendition `json:"ladder,omitempty"`
+	SegmentDuration int         `json:"segment_duration,omitempty"`
+	// SegmentType is "mpegts", the default, or "fmp4" for HLS outputs.
+	// DASH outputs are always segmented as fmp4.
+	SegmentType string  `json:"segment_type,omitempty"`
+	Sprite      *Sprite `json:"sprite,omitempty"`
+	Scenes      *Scenes `json:"scenes,omitempty"`
+	Split       *Split  `json:"split,omitempty"`
+}
+
+const (
+	OutputModeHls    = "hls"
+	OutputModeDash   = "dash"
+	OutputModeSprite = "sprite"
+	OutputModeScenes = "scenes"
+	OutputModeSplit  = "split"
+)
+
+// Rendition is a step of an encoding ladder. Its video is scaled to Width
+// and Height, keeping the aspect ratio when only one of them is set.
+type Rendition struct {
+	Name         string `json:"name"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	VideoBitrate string `json:"video_bitrate"`
+	AudioBitrate string `json:"audio_bitrate,omitempty"`
+}
+
+// Sprite samples a frame every Interval seconds, or on every scene change
+// scoring over SceneThreshold, and tiles them as Width by Height thumbnails
+// into sprite sheets of Columns by Rows.
+type Sprite struct {
+	Interval       float64 `json:"interval,omitempty"`
+	SceneThreshold float64 `json:"scene_threshold,omitempty"`
+	Columns        int     `json:"columns,omitempty"`
+	Rows           int     `json:"rows,omitempty"`
+	Width          int     `json:"width,omitempty"`
+	Height         int     `json:"height,omitempty"`
+}
+
+// Scenes detects the scene changes scoring over Threshold, from 0 to 1 and
+// 0.3 by default, writing the time and the score of every scene to a JSON
+// file, along with a Width pixels wide thumbnail of its first frame when
+// Thumbnails is set.
+type Scenes struct {
+	Threshold  float64 `json:"threshold,omitempty"`
+	Thumbnails bool    `json:"thumbnails,omitempty"`
+	Width      int     `json:"width,omitempty"`
+}
+
+// Split cuts the video into a clip per range between its start, Times, in
+// seconds, and its end, such as at the scene changes detected by the scenes
+// mode.
+type Split struct {
+	Times []float64 `json:"times"`
 }
 
+// Concat joins the inputs of a request one after the other.
+type Concat struct {
+	// Method is "demuxer", which joins inputs sharing the same codecs and
+	// formats without decoding them, "filter", which normalizes and
+	// re-encodes them, or "auto", the default, which picks the demuxer
+	// when the inputs match.
+	Method string `json:"method,omitempty"`
+}
+
+const (
+	ConcatAuto    = "auto"
+	ConcatDemuxer = "demuxer"
+	ConcatFilter  = "filter"
+)
+
+// Placement positions an overlay or a text over the video at Position,
+// bottom-right by default, Margin pixels away from the edges, or at X and Y
+// for the custom position. It is shown between Start and End, in seconds,
+// or for the whole video when unset.
+type Placement struct {
+	Position string  `json:"position,omitempty"`
+	X        int     `json:"x,omitempty"`
+	Y        int     `json:"y,omitempty"`
+	Margin   int     `json:"margin,omitempty"`
+	Start    float64 `json:"start,omitempty"`
+	End      float64 `json:"end,omitempty"`
+}
+
+// Overlay places an image, such as a watermark, over the video.
+type Overlay struct {
+	Input Input `json:"input"`
+	Placement
+	// Opacity goes up to 1, opaque, which is the default.
+	Opacity float64 `json:"opacity,omitempty"`
+	// Scale is the width of the overlay relative to the width of the video,
+	// the overlay keeping its own size when unset.
+	Scale float64 `json:"scale,omitempty"`
+}
+
+// Text draws a title or a lower third over the video, with a font of the
+// font directory of the editor, or the default font when unset.
+type Text struct {
+	Text  string `json:"text"`
+	Font  string `json:"font,omitempty"`
+	Size  int    `json:"size,omitempty"`
+	Color string `json:"color,omitempty"`
+	// Box draws a box of BoxColor behind the text, BoxBorder pixels wider
+	// than the text.
+	Box       bool   `json:"box,omitempty"`
+	BoxColor  string `json:"box_color,omitempty"`
+	BoxBorder int    `json:"box_border,omitempty"`
+	Placement
+}
+
+// Subtitles burns the SRT, WebVTT or ASS subtitles of Input into the video.
+// Style overrides the style of the subtitles, in the ASS format, such as
+// "FontName=Roboto,FontSize=24".
+type Subtitles struct {
+	Input Input  `json:"input"`
+	Style string `json:"style,omitempty"`
+}
+
+const (
+	PositionTopLeft     = "top-left"
+	PositionTopRight    = "top-right"
+	PositionBottomLeft  = "bottom-left"
+	PositionBottomRight = "bottom-right"
+	PositionCenter      = "center"
+	PositionCustom      = "custom"
+)
+
+// Audio edits the audio of the input: the extract mode keeps nothing but its
+// audio, the replace mode replaces it by the audio of Input, and the mix mode
+// mixes the audio of Input, such as background music, into it at Gain dB,
+// lowering it while the input audio plays when Ducking is set. Loop repeats
+// Input until the end of the video.
+type Audio struct {
+	Mode    string  `json:"mode"`
+	Input   Input   `json:"input,omitempty"`
+	Gain    float64 `json:"gain,omitempty"`
+	Ducking bool    `json:"ducking,omitempty"`
+	Loop    bool    `json:"loop,omitempty"`
+}
+
+const (
+	AudioExtract = "extract"
+	AudioReplace = "replace"
+	AudioMix     = "mix"
+)
+
+// Loudness normalizes the audio to the EBU R128 loudness in two passes, the
+// first one measuring the loudness of the audio. Integrated is the target
+// integrated loudness in LUFS, -23 by default, TruePeak the maximum true peak
+// in dBTP, -1 by default, and Range the target loudness range in LU, 7 by
+// default.
+type Loudness struct {
+	Integrated float64 `json:"integrated,omitempty"`
+	TruePeak   float64 `json:"true_peak,omitempty"`
+	Range      float64 `json:"range,omitempty"`
+}
+
+// RateControl sets how the video is encoded with the codec of the request.
+// The crf mode targets the constant quality CRF, lower being better, capped
+// at MaxRate with a BufSize buffer when both are set, while the two_pass mode
+// targets the average Bitrate, analyzing the video in a first pass.
+type RateControl struct {
+	Mode    string `json:"mode"`
+	CRF     int    `json:"crf,omitempty"`
+	MaxRate string `json:"max_rate,omitempty"`
+	BufSize string `json:"buf_size,omitempty"`
+	Bitrate string `json:"bitrate,omitempty"`
+}
+
+const (
+	RateControlCRF     = "crf"
+	RateControlTwoPass = "two_pass"
+)
+
+// The output starts at the StartTime of a request and ends at its EndTime,
+// or after its Duration, times being in seconds, as a clock or in frames. Its
+// TrimMode picks how it is cut: TrimFast copies the streams, starting at the
+// keyframe before StartTime, TrimAccurate, the default, re-encodes them, and
+// TrimSmart only re-encodes the frames between the cuts and their nearest
+// keyframes, copying the others.
+const (
+	TrimFast     = "fast"
+	TrimAccurate = "accurate"
+	TrimSmart    = "smart"
+)
+
 type EditorRequest struct {
-	Input        Input             `json:"input,omitempty"`
+	Input Input `json:"input,omitempty"`
+	// Inputs replaces Input for operations taking several inputs, such as
+	// Concat.
+	Inputs       []Input           `json:"inputs,omitempty"`
+	Concat       *Concat           `json:"concat,omitempty"`
+	Overlay      *Overlay          `json:"overlay,omitempty"`
+	Texts        []Text            `json:"texts,omitempty"`
+	Subtitles    *Subtitles        `json:"subtitles,omitempty"`
+	Audio        *Audio            `json:"audio,omitempty"`
+	Loudness     *Loudness         `json:"loudness,omitempty"`
+	RateControl  *RateControl      `json:"rate_control,omitempty"`
 	Output       Output            `json:"output" required:"true"`
 	Codec        string            `json:"codec,omitempty"`
 	Bitrate      string            `json:"bitrate,omitempty"`
@@ -21,5 +229,51 @@ type EditorRequest struct {
 	Filters      map[string]string `json:"filters,omitempty"`
 	ExtraOptions string            `json:"extra_options,omitempty"`
 	StartTime    string            `json:"start_time,omitempty"`
+	EndTime      string            `json:"end_time,omitempty"`
+	Duration     string            `json:"duration,omitempty"`
+	TrimMode     string            `json:"trim_mode,omitempty"`
 	Frames       string            `json:"frames,omitempty"`
+	Priority     string            `json:"priority,omitempty"`
+	Timeout      string            `json:"timeout,omitempty"`
+	Steps        []Step            `json:"steps,omitempty"`
+	// Preset names the preset, such as "web-720p@v3", whose template the
+	// fields of the request override.
+	Preset       string            `json:"preset,omitempty"`
+	PresetParams map[string]string `json:"preset_params,omitempty"`
+}
+
+// Step is one operation of a pipeline request. Steps run once the steps
+// they take their input from are done. The outputs of the steps no other
+// step takes its input from, or that are kept, are the outputs of the job.
+type Step struct {
+	Id   string `json:"id"`
+	Keep bool   `json:"keep,omitempty"`
+	EditorRequest
+}
+
+// BatchRequest submits several requests at once. Requests without an input
+// use the input of the batch.
+type BatchRequest struct {
+	Input      Input           `json:"input,omitempty"`
+	Requests   []EditorRequest `json:"requests"`
+	WebhookURL string          `json:"webhook_url,omitempty"`
+}
+
+// Dependencies returns the ids of the steps the step takes its inputs from.
+func (s Step) Dependencies() []string {
+	var dependencies []string
+	for _, input := range s.AllInputs() {
+		if input.Step != "" && !slices.Contains(dependencies, input.Step) {
+			dependencies = append(dependencies, input.Step)
+		}
+	}
+	return dependencies
+}
+
+// AllInputs returns the inputs of the request, or its only input.
+func (r EditorRequest) AllInputs() []Input {
+	if len(r.Inputs) > 0 {
+		return r.Inputs
+	}
+	return []Input{r.Input}
 }
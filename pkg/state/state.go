@@ -0,0 +1,478 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/media"
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/google/uuid"
+)
+
+var ErrNotFound = errors.New("job not found")
+
+// validKey matches the keys of locks, which name their lock files.
+var validKey = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSuccess   Status = "success"
+	StatusError     Status = "error"
+	StatusCancelled Status = "cancelled"
+	// StatusSkipped is the status of pipeline steps that did not run because
+	// a step they depend on failed.
+	StatusSkipped Status = "skipped"
+)
+
+type JobState struct {
+	Id               string                `json:"id"`
+	Owner            string                `json:"owner,omitempty"`
+	Tenant           string                `json:"tenant,omitempty"`
+	BatchId          string                `json:"batch_id,omitempty"`
+	Status           Status                `json:"status"`
+	Request          request.EditorRequest `json:"request"`
+	FileLocations    []string              `json:"file_locations,omitempty"`
+	Loudness         *media.LoudnessStats  `json:"loudness,omitempty"`
+	Scenes           []media.Scene         `json:"scenes,omitempty"`
+	ErrorMsg         string                `json:"error_msg,omitempty"`
+	ErrorCode        string                `json:"error_code,omitempty"`
+	CancelRequested  bool                  `json:"cancel_requested,omitempty"`
+	Progress         float64               `json:"progress"`
+	ProcessedSeconds float64               `json:"processed_seconds,omitempty"`
+	Steps            []StepState           `json:"steps,omitempty"`
+	CreatedAt        time.Time             `json:"created_at"`
+	StartedAt        *time.Time            `json:"started_at,omitempty"`
+	HeartbeatAt      *time.Time            `json:"heartbeat_at,omitempty"`
+	FinishedAt       *time.Time            `json:"finished_at,omitempty"`
+	UpdatedAt        time.Time             `json:"updated_at"`
+}
+
+// StepState is the state of a step of a pipeline job.
+type StepState struct {
+	Id            string               `json:"id"`
+	Status        Status               `json:"status"`
+	Progress      float64              `json:"progress"`
+	FileLocations []string             `json:"file_locations,omitempty"`
+	Loudness      *media.LoudnessStats `json:"loudness,omitempty"`
+	Scenes        []media.Scene        `json:"scenes,omitempty"`
+	ErrorMsg      string               `json:"error_msg,omitempty"`
+	ErrorCode     string               `json:"error_code,omitempty"`
+	StartedAt     *time.Time           `json:"started_at,omitempty"`
+	FinishedAt    *time.Time           `json:"finished_at,omitempty"`
+}
+
+// Done reports whether the job reached a final status.
+func (j *JobState) Done() bool {
+	return j.Status == StatusSuccess || j.Status == StatusError || j.Status == StatusCancelled
+}
+
+// LeaseDuration is how long a running job is considered running without a
+// heartbeat of its worker, which may have crashed.
+const LeaseDuration = 2 * time.Minute
+
+// ErrorCodeLeaseExpired is the error code of the jobs whose worker stopped
+// renewing their lease.
+const ErrorCodeLeaseExpired = "lease_expired"
+
+// LeaseExpired reports whether the job is running without a heartbeat of its
+// worker, or a start when it never had one, for longer than LeaseDuration.
+func (j *JobState) LeaseExpired(now time.Time) bool {
+	if j.Status != StatusRunning {
+		return false
+	}
+	renewedAt := j.HeartbeatAt
+	if renewedAt == nil {
+		renewedAt = j.StartedAt
+	}
+	return renewedAt != nil && now.Sub(*renewedAt) > LeaseDuration
+}
+
+type Filter struct {
+	Owner  string
+	Tenant string
+	Status Status
+	// Active only matches queued and running jobs.
+	Active bool
+	// FinishedSince only matches the jobs finished at or after it.
+	FinishedSince time.Time
+	Limit         int
+}
+
+func (f Filter) matches(j *JobState) bool {
+	if f.Owner != "" && j.Owner != f.Owner {
+		return false
+	}
+	if f.Tenant != "" && j.Tenant != f.Tenant {
+		return false
+	}
+	if f.Status != "" && j.Status != f.Status {
+		return false
+	}
+	if f.Active && !j.active() {
+		return false
+	}
+	if !f.FinishedSince.IsZero() && (j.FinishedAt == nil || j.FinishedAt.Before(f.FinishedSince)) {
+		return false
+	}
+	return true
+}
+
+// active filters only match the jobs of the active index.
+func (f Filter) active() bool {
+	return f.Active || f.Status == StatusQueued || f.Status == StatusRunning
+}
+
+func (j *JobState) active() bool {
+	return j.Status == StatusQueued || j.Status == StatusRunning
+}
+
+type Store interface {
+	Save(ctx context.Context, job *JobState) error
+	Get(ctx context.Context, id string) (*JobState, error)
+	List(ctx context.Context, filter Filter) ([]*JobState, error)
+	// Update applies fn to the current state of the job and saves the result.
+	// Nothing is saved when fn returns an error.
+	Update(ctx context.Context, id string, fn func(job *JobState) error) (*JobState, error)
+	// Lock holds the lock named key, shared by every process using the
+	// store, until the returned function is called, so checks spanning
+	// several jobs are not raced by other writers taking the same lock.
+	Lock(ctx context.Context, key string) (func(), error)
+}
+
+// FileStore keeps one JSON document per job, so the api and the workers can
+// share job states through the same volume they share inputs and outputs.
+// Writes to a job hold its lock file, so concurrent updates from other
+// processes are applied one after the other instead of overwriting each
+// other.
+//
+// Jobs are also indexed by empty files named after them, under
+// index/active/<tenant>/ while queued or running and under
+// index/finished/<day>/<tenant>/ once finished, so listing the active jobs
+// or the jobs finished lately does not read the whole history.
+type FileStore struct {
+	path    string
+	mu      sync.Mutex
+	keyMu   sync.Map
+	indexMu sync.Mutex
+}
+
+var (
+	storesMu sync.Mutex
+	stores   = map[string]*FileStore{}
+)
+
+// NewFileStore returns the store of the jobs under path, shared by every
+// caller of the process using the same path.
+func NewFileStore(path string) Store {
+	path = filepath.Join(path, "jobs")
+
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	store, ok := stores[path]
+	if !ok {
+		store = &FileStore{path: path}
+		stores[path] = store
+	}
+	return store
+}
+
+func (f *FileStore) Save(ctx context.Context, job *JobState) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	unlock, err := f.lock(job.Id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return f.write(job)
+}
+
+func (f *FileStore) Get(ctx context.Context, id string) (*JobState, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+
+	return f.read(filepath.Join(f.path, fmt.Sprintf("%s.json", id)))
+}
+
+func (f *FileStore) List(ctx context.Context, filter Filter) ([]*JobState, error) {
+	var jobs []*JobState
+	if filter.active() || !filter.FinishedSince.IsZero() {
+		markers, err := f.markers(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, marker := range markers {
+			job, err := f.read(filepath.Join(f.path, fmt.Sprintf("%s.json", filepath.Base(marker))))
+			// Markers left behind by a job that finished meanwhile, or whose
+			// state was removed, are pruned.
+			if errors.Is(err, ErrNotFound) || err == nil && filter.active() && job.Done() {
+				_ = os.Remove(marker)
+			}
+			if err == nil && filter.matches(job) {
+				jobs = append(jobs, job)
+			}
+		}
+	} else {
+		entries, err := os.ReadDir(f.path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+				continue
+			}
+
+			job, err := f.read(filepath.Join(f.path, entry.Name()))
+			if err != nil {
+				continue
+			}
+			if filter.matches(job) {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	if filter.Limit > 0 && len(jobs) > filter.Limit {
+		jobs = jobs[:filter.Limit]
+	}
+
+	return jobs, nil
+}
+
+func (f *FileStore) Update(ctx context.Context, id string, fn func(job *JobState) error) (*JobState, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	unlock, err := f.lock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	job, err := f.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fn(job); err != nil {
+		return job, err
+	}
+
+	return job, f.write(job)
+}
+
+func (f *FileStore) Lock(ctx context.Context, key string) (func(), error) {
+	if !validKey.MatchString(key) {
+		return nil, fmt.Errorf("invalid lock key %q", key)
+	}
+
+	// Locks of files are shared with other processes but not always with the
+	// goroutines of this one.
+	value, _ := f.keyMu.LoadOrStore(key, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+
+	unlock, err := f.lock(key)
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlock()
+		mu.Unlock()
+	}, nil
+}
+
+// lock takes the lock of the job id, shared with the other processes using
+// the same state path, and returns the function releasing it.
+func (f *FileStore) lock(id string) (func(), error) {
+	if err := os.MkdirAll(f.path, os.ModePerm); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(f.path, fmt.Sprintf("%s.lock", id)), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("locking job %s: %w", id, err)
+	}
+
+	return func() {
+		_ = unlockFile(file)
+		file.Close()
+	}, nil
+}
+
+// markers returns the index files of the jobs that may match filter, which
+// either lists active jobs or jobs finished since a given time.
+func (f *FileStore) markers(filter Filter) ([]string, error) {
+	if err := f.ensureIndex(); err != nil {
+		return nil, err
+	}
+
+	tenant := "*"
+	if filter.Tenant != "" {
+		tenant = indexName(filter.Tenant)
+	}
+	if filter.active() {
+		return filepath.Glob(filepath.Join(f.path, "index", "active", tenant, "*"))
+	}
+
+	days, err := os.ReadDir(filepath.Join(f.path, "index", "finished"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	since := filter.FinishedSince.UTC().Format(time.DateOnly)
+	var markers []string
+	for _, day := range days {
+		if day.Name() < since {
+			continue
+		}
+		dayMarkers, err := filepath.Glob(filepath.Join(f.path, "index", "finished", day.Name(), tenant, "*"))
+		if err != nil {
+			return nil, err
+		}
+		markers = append(markers, dayMarkers...)
+	}
+	return markers, nil
+}
+
+// ensureIndex indexes the jobs saved before the store kept an index, once.
+func (f *FileStore) ensureIndex() error {
+	f.indexMu.Lock()
+	defer f.indexMu.Unlock()
+
+	built := filepath.Join(f.path, "index", "built")
+	if _, err := os.Stat(built); err == nil {
+		return nil
+	}
+
+	entries, err := os.ReadDir(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		job, err := f.read(filepath.Join(f.path, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if err := f.index(job); err != nil {
+			return err
+		}
+	}
+	return touch(built)
+}
+
+// index updates the index files of job after it was written.
+func (f *FileStore) index(job *JobState) error {
+	active := filepath.Join(f.path, "index", "active", indexName(job.Tenant), job.Id)
+	if job.active() {
+		if err := touch(active); err != nil {
+			return err
+		}
+	} else if err := os.Remove(active); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if job.FinishedAt != nil {
+		day := job.FinishedAt.UTC().Format(time.DateOnly)
+		return touch(filepath.Join(f.path, "index", "finished", day, indexName(job.Tenant), job.Id))
+	}
+	return nil
+}
+
+// indexName is the directory of the jobs of tenant in the index, jobs
+// without a tenant being indexed under "_", which is not a valid tenant.
+func indexName(tenant string) string {
+	if tenant == "" {
+		return "_"
+	}
+	return tenant
+}
+
+func touch(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func (f *FileStore) read(path string) (*JobState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var job JobState
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (f *FileStore) write(job *JobState) error {
+	now := time.Now().UTC()
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	job.UpdatedAt = now
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(f.path, os.ModePerm); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial document.
+	path := filepath.Join(f.path, fmt.Sprintf("%s.json", job.Id))
+	tmp := fmt.Sprintf("%s.%s.tmp", path, uuid.New().String())
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	return f.index(job)
+}
@@ -0,0 +1,172 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Given jobs from several owners, it should list only the filtered ones", func(t *testing.T) {
+		store := NewFileStore(t.TempDir())
+		for _, owner := range []string{"a", "a", "b"} {
+			assert.NoError(t, store.Save(ctx, &JobState{Id: uuid.New().String(), Owner: owner, Status: StatusQueued}))
+		}
+
+		jobs, err := store.List(ctx, Filter{Owner: "a"})
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 2)
+
+		jobs, err = store.List(ctx, Filter{Limit: 1})
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 1)
+	})
+
+	t.Run("Given an update that fails, it should keep the previous state", func(t *testing.T) {
+		store := NewFileStore(t.TempDir())
+		id := uuid.New().String()
+		assert.NoError(t, store.Save(ctx, &JobState{Id: id, Status: StatusQueued}))
+
+		_, err := store.Update(ctx, id, func(job *JobState) error {
+			job.Status = StatusRunning
+			return errors.New("boom")
+		})
+		assert.Error(t, err)
+
+		job, err := store.Get(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, StatusQueued, job.Status)
+	})
+
+	t.Run("Given an unknown job, it should return not found", func(t *testing.T) {
+		store := NewFileStore(t.TempDir())
+
+		_, err := store.Update(ctx, uuid.New().String(), func(job *JobState) error { return nil })
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+	t.Run("Given the same path, it should share one store", func(t *testing.T) {
+		path := t.TempDir()
+		assert.Same(t, NewFileStore(path), NewFileStore(path))
+	})
+
+	t.Run("Given concurrent updates from several processes, it should apply all of them", func(t *testing.T) {
+		// Stores of other processes do not share the lock of this one.
+		path := filepath.Join(t.TempDir(), "jobs")
+		stores := []Store{&FileStore{path: path}, &FileStore{path: path}}
+		id := uuid.New().String()
+		assert.NoError(t, stores[0].Save(ctx, &JobState{Id: id, Status: StatusRunning}))
+
+		var wg sync.WaitGroup
+		for _, store := range stores {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 50 {
+					_, err := store.Update(ctx, id, func(job *JobState) error {
+						job.Progress++
+						return nil
+					})
+					assert.NoError(t, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		job, err := stores[1].Get(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, 100.0, job.Progress)
+	})
+	t.Run("Given a lock taken by another process, it should wait for it", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "jobs")
+		first, second := &FileStore{path: path}, &FileStore{path: path}
+
+		unlock, err := first.Lock(ctx, "tenant.team-a")
+		assert.NoError(t, err)
+		locked := make(chan struct{})
+		go func() {
+			unlock, err := second.Lock(ctx, "tenant.team-a")
+			assert.NoError(t, err)
+			close(locked)
+			unlock()
+		}()
+
+		select {
+		case <-locked:
+			t.Fatal("Expected the lock to be held")
+		case <-time.After(50 * time.Millisecond):
+		}
+		unlock()
+		<-locked
+	})
+
+	t.Run("Given active and finished jobs, it should list them from the index", func(t *testing.T) {
+		store := &FileStore{path: t.TempDir()}
+		queued := &JobState{Id: uuid.New().String(), Tenant: "team-a", Status: StatusQueued}
+		assert.NoError(t, store.Save(ctx, queued))
+		assert.NoError(t, store.Save(ctx, &JobState{Id: uuid.New().String(), Tenant: "team-b", Status: StatusRunning}))
+		yesterday := time.Now().UTC().Add(-24 * time.Hour)
+		assert.NoError(t, store.Save(ctx, &JobState{Id: uuid.New().String(), Tenant: "team-a", Status: StatusSuccess, FinishedAt: &yesterday}))
+
+		jobs, err := store.List(ctx, Filter{Tenant: "team-a", Active: true})
+		assert.NoError(t, err)
+		if assert.Len(t, jobs, 1) {
+			assert.Equal(t, queued.Id, jobs[0].Id)
+		}
+		jobs, err = store.List(ctx, Filter{Status: StatusRunning})
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 1)
+
+		finishedAt := time.Now().UTC()
+		_, err = store.Update(ctx, queued.Id, func(job *JobState) error {
+			job.Status = StatusError
+			job.FinishedAt = &finishedAt
+			return nil
+		})
+		assert.NoError(t, err)
+
+		jobs, err = store.List(ctx, Filter{Tenant: "team-a", Active: true})
+		assert.NoError(t, err)
+		assert.Empty(t, jobs)
+		jobs, err = store.List(ctx, Filter{Tenant: "team-a", FinishedSince: finishedAt.Truncate(24 * time.Hour)})
+		assert.NoError(t, err)
+		if assert.Len(t, jobs, 1) {
+			assert.Equal(t, queued.Id, jobs[0].Id)
+		}
+		jobs, err = store.List(ctx, Filter{Tenant: "team-a", FinishedSince: yesterday})
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 2)
+	})
+
+	t.Run("Given jobs saved before the index, it should index them once", func(t *testing.T) {
+		store := &FileStore{path: t.TempDir()}
+		id := uuid.New().String()
+		assert.NoError(t, store.Save(ctx, &JobState{Id: id, Status: StatusQueued}))
+		assert.NoError(t, os.RemoveAll(filepath.Join(store.path, "index")))
+
+		jobs, err := store.List(ctx, Filter{Active: true})
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 1)
+		assert.FileExists(t, filepath.Join(store.path, "index", "active", "_", id))
+	})
+
+	t.Run("Given a running job, its lease should expire without heartbeats", func(t *testing.T) {
+		now := time.Now()
+		heartbeatAt := now.Add(-LeaseDuration - time.Second)
+		job := &JobState{Status: StatusRunning, HeartbeatAt: &heartbeatAt}
+		assert.True(t, job.LeaseExpired(now))
+
+		job.HeartbeatAt = &now
+		assert.False(t, job.LeaseExpired(now))
+		job.Status = StatusQueued
+		assert.False(t, job.LeaseExpired(now.Add(time.Hour)))
+	})
+}
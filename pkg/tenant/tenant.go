@@ -0,0 +1,292 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+)
+
+// Default is the tenant of requests without one, e.g. when authentication is
+// disabled.
+const Default = "default"
+
+const (
+	ReasonActiveJobs   = "active_jobs"
+	ReasonRunningJobs  = "running_jobs"
+	ReasonDailyMinutes = "daily_minutes"
+	ReasonStorage      = "storage"
+)
+
+var (
+	ErrInvalidTenant = errors.New("invalid tenant")
+	validName        = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+	// reservedNames are the directories of the service, which tenant
+	// directories must not be mistaken for.
+	reservedNames = []string{"state", "jobs", "logs", "batches", "presets"}
+)
+
+// FromPrincipal returns the tenant of an authenticated principal. Tenants are
+// used as directory names, so only lower case letters, digits, "-" and "_"
+// are accepted, and the names of the directories of the service are
+// reserved.
+func FromPrincipal(p *auth.Principal) (string, error) {
+	if p == nil || p.Tenant == "" {
+		return Default, nil
+	}
+
+	name := strings.ToLower(p.Tenant)
+	if !validName.MatchString(name) || slices.Contains(reservedNames, name) {
+		return "", fmt.Errorf("%w %q", ErrInvalidTenant, p.Tenant)
+	}
+	return name, nil
+}
+
+// QuotaError is returned when a tenant exceeds one of its limits.
+type QuotaError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("tenant quota exceeded: %s", e.Reason)
+}
+
+type Usage struct {
+	Tenant                string                     `json:"tenant"`
+	ActiveJobs            int                        `json:"active_jobs"`
+	RunningJobs           int                        `json:"running_jobs"`
+	ProcessedMinutesToday float64                    `json:"processed_minutes_today"`
+	StorageBytes          int64                      `json:"storage_bytes"`
+	Limits                configuration.TenantLimits `json:"limits"`
+}
+
+// storageTTL is how long the storage of a tenant is reused before its
+// outputs are measured again.
+const storageTTL = time.Minute
+
+// Quotas computes the usage of tenants from the job states and the output
+// path, and checks it against their configured limits.
+type Quotas struct {
+	store      state.Store
+	outputPath string
+	limits     configuration.TenantsConfig
+	now        func() time.Time
+
+	mu      sync.Mutex
+	storage map[string]measuredStorage
+}
+
+type measuredStorage struct {
+	bytes      int64
+	measuredAt time.Time
+}
+
+func NewQuotas(cfg *configuration.Configuration, store state.Store) *Quotas {
+	return &Quotas{
+		store:      store,
+		outputPath: cfg.OutputPath,
+		limits:     cfg.Tenants,
+		now:        time.Now,
+		storage:    map[string]measuredStorage{},
+	}
+}
+
+// Usage returns the usage of tenant, from its active jobs and the jobs it
+// finished today. Job ids in exclude are not counted as active or running.
+func (q *Quotas) Usage(ctx context.Context, tenant string, exclude ...string) (*Usage, error) {
+	now, today := q.now(), q.startOfDay()
+	active, err := q.store.List(ctx, state.Filter{Tenant: tenant, Active: true})
+	if err != nil {
+		return nil, err
+	}
+	finished, err := q.store.List(ctx, state.Filter{Tenant: tenant, FinishedSince: today})
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &Usage{
+		Tenant: tenant,
+		Limits: q.limits.For(tenant),
+	}
+
+	for _, job := range finished {
+		usage.ProcessedMinutesToday += job.ProcessedSeconds / 60
+	}
+	for _, job := range active {
+		if job.LeaseExpired(now) || slices.Contains(exclude, job.Id) {
+			continue
+		}
+		usage.ActiveJobs++
+		if job.Status == state.StatusRunning {
+			usage.RunningJobs++
+		}
+	}
+
+	usage.StorageBytes, err = q.storageBytes(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// storageBytes returns the size of the outputs of tenant, measured at most
+// once per storageTTL.
+func (q *Quotas) storageBytes(tenant string) (int64, error) {
+	q.mu.Lock()
+	measured, ok := q.storage[tenant]
+	q.mu.Unlock()
+	now := q.now()
+	if ok && now.Sub(measured.measuredAt) < storageTTL {
+		return measured.bytes, nil
+	}
+
+	size, err := directorySize(q.Dir(tenant))
+	if err != nil {
+		return 0, err
+	}
+
+	q.mu.Lock()
+	q.storage[tenant] = measuredStorage{bytes: size, measuredAt: now}
+	q.mu.Unlock()
+	return size, nil
+}
+
+// CheckSubmission checks whether tenant may submit a new job.
+func (q *Quotas) CheckSubmission(ctx context.Context, tenant string) error {
+	return q.CheckBatchSubmission(ctx, tenant, 1)
+}
+
+// CheckBatchSubmission checks whether tenant may submit a batch of jobs at once.
+func (q *Quotas) CheckBatchSubmission(ctx context.Context, tenant string, jobs int) error {
+	usage, err := q.Usage(ctx, tenant)
+	if err != nil {
+		return err
+	}
+
+	if limit := usage.Limits.MaxActiveJobs; limit > 0 && usage.ActiveJobs+jobs > limit {
+		return &QuotaError{Reason: ReasonActiveJobs}
+	}
+	return q.checkConsumption(usage)
+}
+
+// CheckStart checks whether a worker may start the job id of tenant.
+func (q *Quotas) CheckStart(ctx context.Context, tenant string, id string) error {
+	usage, err := q.Usage(ctx, tenant, id)
+	if err != nil {
+		return err
+	}
+
+	if limit := usage.Limits.MaxRunningJobs; limit > 0 && usage.RunningJobs >= limit {
+		return &QuotaError{Reason: ReasonRunningJobs}
+	}
+	return q.checkConsumption(usage)
+}
+
+// Start starts the job id of tenant with start, once CheckStart allows it.
+// Workers of every process start the jobs of a tenant one at a time, so they
+// cannot exceed its running jobs limit together, and the running jobs whose
+// lease expired are failed first to free their slots.
+func (q *Quotas) Start(ctx context.Context, tenant string, id string, start func() error) error {
+	unlock, err := q.store.Lock(ctx, "tenant."+tenant)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := q.expireLeases(ctx, tenant); err != nil {
+		return err
+	}
+	if err := q.CheckStart(ctx, tenant, id); err != nil {
+		return err
+	}
+	return start()
+}
+
+// expireLeases fails the running jobs of tenant whose worker stopped renewing
+// their lease, e.g. because it crashed.
+func (q *Quotas) expireLeases(ctx context.Context, tenant string) error {
+	jobs, err := q.store.List(ctx, state.Filter{Tenant: tenant, Status: state.StatusRunning})
+	if err != nil {
+		return err
+	}
+
+	now := q.now()
+	for _, job := range jobs {
+		if !job.LeaseExpired(now) {
+			continue
+		}
+		_, err := q.store.Update(ctx, job.Id, func(job *state.JobState) error {
+			if !job.LeaseExpired(now) {
+				return nil
+			}
+			finishedAt := now.UTC()
+			job.Status = state.StatusError
+			job.ErrorCode = state.ErrorCodeLeaseExpired
+			job.ErrorMsg = "the worker running the job stopped"
+			job.FinishedAt = &finishedAt
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dir returns the directory holding the outputs of tenant.
+func (q *Quotas) Dir(tenant string) string {
+	return filepath.Join(q.outputPath, tenant)
+}
+
+func (q *Quotas) checkConsumption(usage *Usage) error {
+	if limit := usage.Limits.DailyMinutes; limit > 0 && usage.ProcessedMinutesToday >= limit {
+		return &QuotaError{
+			Reason:     ReasonDailyMinutes,
+			RetryAfter: q.startOfDay().Add(24 * time.Hour).Sub(q.now()),
+		}
+	}
+	if limit := usage.Limits.StorageBytes; limit > 0 && usage.StorageBytes >= limit {
+		return &QuotaError{Reason: ReasonStorage}
+	}
+	return nil
+}
+
+func (q *Quotas) startOfDay() time.Time {
+	return q.now().UTC().Truncate(24 * time.Hour)
+}
+
+func directorySize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		size += info.Size()
+		return nil
+	})
+
+	return size, err
+}
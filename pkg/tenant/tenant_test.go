@@ -0,0 +1,187 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/auth"
+	"github.com/douglasdgoulart/video-editor-api/pkg/configuration"
+	"github.com/douglasdgoulart/video-editor-api/pkg/state"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newQuotas(t *testing.T, limits configuration.TenantLimits) (*Quotas, state.Store) {
+	store := state.NewFileStore(t.TempDir())
+	quotas := NewQuotas(&configuration.Configuration{
+		OutputPath: t.TempDir(),
+		Tenants: configuration.TenantsConfig{
+			Limits: map[string]configuration.TenantLimits{"team-a": limits},
+		},
+	}, store)
+	return quotas, store
+}
+
+func TestFromPrincipal(t *testing.T) {
+	t.Run("Given principals with and without a tenant, it should return a directory safe name", func(t *testing.T) {
+		name, err := FromPrincipal(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, Default, name)
+
+		name, err = FromPrincipal(&auth.Principal{Tenant: "Team-A"})
+		assert.NoError(t, err)
+		assert.Equal(t, "team-a", name)
+
+		_, err = FromPrincipal(&auth.Principal{Tenant: "../team-b"})
+		assert.ErrorIs(t, err, ErrInvalidTenant)
+	})
+
+	t.Run("Given the name of a directory of the service, it should reject it", func(t *testing.T) {
+		_, err := FromPrincipal(&auth.Principal{Tenant: "State"})
+		assert.ErrorIs(t, err, ErrInvalidTenant)
+	})
+}
+
+func TestQuotas(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Given a tenant at its active jobs limit, it should reject submissions", func(t *testing.T) {
+		quotas, store := newQuotas(t, configuration.TenantLimits{MaxActiveJobs: 1})
+		assert.NoError(t, quotas.CheckSubmission(ctx, "team-a"))
+
+		assert.NoError(t, store.Save(ctx, &state.JobState{Id: uuid.New().String(), Tenant: "team-a", Status: state.StatusQueued}))
+		var quotaErr *QuotaError
+		assert.True(t, errors.As(quotas.CheckSubmission(ctx, "team-a"), &quotaErr))
+		assert.Equal(t, ReasonActiveJobs, quotaErr.Reason)
+
+		// Other tenants fall back to the unlimited default limits.
+		assert.NoError(t, quotas.CheckSubmission(ctx, "team-b"))
+	})
+
+	t.Run("Given a batch larger than the active jobs left, it should reject it", func(t *testing.T) {
+		quotas, store := newQuotas(t, configuration.TenantLimits{MaxActiveJobs: 3})
+		assert.NoError(t, store.Save(ctx, &state.JobState{Id: uuid.New().String(), Tenant: "team-a", Status: state.StatusRunning}))
+
+		assert.NoError(t, quotas.CheckBatchSubmission(ctx, "team-a", 2))
+		var quotaErr *QuotaError
+		assert.True(t, errors.As(quotas.CheckBatchSubmission(ctx, "team-a", 3), &quotaErr))
+		assert.Equal(t, ReasonActiveJobs, quotaErr.Reason)
+	})
+
+	t.Run("Given a tenant at its running jobs limit, it should not start another job", func(t *testing.T) {
+		quotas, store := newQuotas(t, configuration.TenantLimits{MaxRunningJobs: 1})
+		running := uuid.New().String()
+		assert.NoError(t, store.Save(ctx, &state.JobState{Id: running, Tenant: "team-a", Status: state.StatusRunning}))
+
+		var quotaErr *QuotaError
+		assert.True(t, errors.As(quotas.CheckStart(ctx, "team-a", uuid.New().String()), &quotaErr))
+		assert.Equal(t, ReasonRunningJobs, quotaErr.Reason)
+		assert.NoError(t, quotas.CheckStart(ctx, "team-a", running))
+	})
+
+	t.Run("Given workers starting jobs at once, it should not exceed the running jobs limit", func(t *testing.T) {
+		quotas, store := newQuotas(t, configuration.TenantLimits{MaxRunningJobs: 1})
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 4)
+		for range 4 {
+			id := uuid.New().String()
+			assert.NoError(t, store.Save(ctx, &state.JobState{Id: id, Tenant: "team-a", Status: state.StatusQueued}))
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- quotas.Start(ctx, "team-a", id, func() error {
+					_, err := store.Update(ctx, id, func(job *state.JobState) error {
+						job.Status = state.StatusRunning
+						return nil
+					})
+					return err
+				})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		started := 0
+		for err := range errs {
+			var quotaErr *QuotaError
+			if err == nil {
+				started++
+			} else if !errors.As(err, &quotaErr) || quotaErr.Reason != ReasonRunningJobs {
+				t.Errorf("Expected the running jobs limit; got %v", err)
+			}
+		}
+		assert.Equal(t, 1, started)
+	})
+
+	t.Run("Given a running job whose lease expired, it should fail it and start another job", func(t *testing.T) {
+		quotas, store := newQuotas(t, configuration.TenantLimits{MaxRunningJobs: 1})
+		heartbeatAt := time.Now().Add(-state.LeaseDuration - time.Minute)
+		stale := uuid.New().String()
+		assert.NoError(t, store.Save(ctx, &state.JobState{Id: stale, Tenant: "team-a", Status: state.StatusRunning, StartedAt: &heartbeatAt, HeartbeatAt: &heartbeatAt}))
+
+		assert.NoError(t, quotas.Start(ctx, "team-a", uuid.New().String(), func() error { return nil }))
+
+		job, err := store.Get(ctx, stale)
+		assert.NoError(t, err)
+		assert.Equal(t, state.StatusError, job.Status)
+		assert.Equal(t, state.ErrorCodeLeaseExpired, job.ErrorCode)
+	})
+
+	t.Run("Given a tenant over its daily minutes, it should ask to retry the next day", func(t *testing.T) {
+		quotas, store := newQuotas(t, configuration.TenantLimits{DailyMinutes: 1})
+		quotas.now = func() time.Time { return time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC) }
+		finishedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		yesterday := finishedAt.Add(-24 * time.Hour)
+		assert.NoError(t, store.Save(ctx, &state.JobState{Id: uuid.New().String(), Tenant: "team-a", Status: state.StatusSuccess, ProcessedSeconds: 3600, FinishedAt: &yesterday}))
+		assert.NoError(t, quotas.CheckSubmission(ctx, "team-a"))
+
+		assert.NoError(t, store.Save(ctx, &state.JobState{Id: uuid.New().String(), Tenant: "team-a", Status: state.StatusSuccess, ProcessedSeconds: 90, FinishedAt: &finishedAt}))
+		var quotaErr *QuotaError
+		assert.True(t, errors.As(quotas.CheckSubmission(ctx, "team-a"), &quotaErr))
+		assert.Equal(t, ReasonDailyMinutes, quotaErr.Reason)
+		assert.Equal(t, time.Hour, quotaErr.RetryAfter)
+	})
+
+	t.Run("Given a tenant over its storage quota, it should reject submissions", func(t *testing.T) {
+		quotas, _ := newQuotas(t, configuration.TenantLimits{StorageBytes: 10})
+		dir := filepath.Join(quotas.Dir("team-a"), uuid.New().String())
+		assert.NoError(t, os.MkdirAll(dir, os.ModePerm))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "output.mp4"), make([]byte, 16), 0o644))
+
+		usage, err := quotas.Usage(ctx, "team-a")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(16), usage.StorageBytes)
+
+		var quotaErr *QuotaError
+		assert.True(t, errors.As(quotas.CheckSubmission(ctx, "team-a"), &quotaErr))
+		assert.Equal(t, ReasonStorage, quotaErr.Reason)
+	})
+	t.Run("Given outputs written since their last measure, it should measure them again once the cache expires", func(t *testing.T) {
+		quotas, _ := newQuotas(t, configuration.TenantLimits{})
+		now := time.Now()
+		quotas.now = func() time.Time { return now }
+		dir := filepath.Join(quotas.Dir("team-a"), uuid.New().String())
+		assert.NoError(t, os.MkdirAll(dir, os.ModePerm))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "first.mp4"), make([]byte, 16), 0o644))
+
+		usage, err := quotas.Usage(ctx, "team-a")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(16), usage.StorageBytes)
+
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "second.mp4"), make([]byte, 8), 0o644))
+		usage, err = quotas.Usage(ctx, "team-a")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(16), usage.StorageBytes)
+
+		now = now.Add(storageTTL)
+		usage, err = quotas.Usage(ctx, "team-a")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(24), usage.StorageBytes)
+	})
+}
@@ -0,0 +1,90 @@
+// Package timecode parses the times of requests, positions or durations in
+// a video written in seconds, as a clock or in frames.
+package timecode
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var (
+	secondsRegex = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)(s|ms|us)?$`)
+	clockRegex   = regexp.MustCompile(`^(?:([0-9]+):)?([0-5]?[0-9]):([0-5]?[0-9](?:\.[0-9]+)?)$`)
+	framesRegex  = regexp.MustCompile(`^([0-9]+)f$`)
+)
+
+// Time is a position or a duration in a video, in seconds, or in frames
+// when InFrames is set.
+type Time struct {
+	Seconds  float64
+	Frames   int64
+	InFrames bool
+}
+
+// Parse parses a time in seconds, such as "65.5", "65.5s" or "500ms", as a
+// clock, such as "00:01:05.500" or "01:05.5", or in frames, such as "120f".
+func Parse(value string) (Time, error) {
+	if match := secondsRegex.FindStringSubmatch(value); match != nil {
+		seconds, _ := strconv.ParseFloat(match[1], 64)
+		switch match[2] {
+		case "ms":
+			seconds /= 1e3
+		case "us":
+			seconds /= 1e6
+		}
+		return Time{Seconds: seconds}, nil
+	}
+	if match := clockRegex.FindStringSubmatch(value); match != nil {
+		hours, _ := strconv.ParseFloat(valueOr(match[1], "0"), 64)
+		minutes, _ := strconv.ParseFloat(match[2], 64)
+		seconds, _ := strconv.ParseFloat(match[3], 64)
+		return Time{Seconds: hours*3600 + minutes*60 + seconds}, nil
+	}
+	if match := framesRegex.FindStringSubmatch(value); match != nil {
+		frames, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return Time{}, fmt.Errorf("invalid time %q: %w", value, err)
+		}
+		return Time{Frames: frames, InFrames: true}, nil
+	}
+	return Time{}, fmt.Errorf("invalid time %q, expected seconds such as 65.5, a clock such as 00:01:05.500 or frames such as 120f", value)
+}
+
+// ToSeconds returns the time in seconds, converting times in frames at
+// frameRate frames per second.
+func (t Time) ToSeconds(frameRate float64) float64 {
+	if t.InFrames {
+		return float64(t.Frames) / frameRate
+	}
+	return t.Seconds
+}
+
+// IsZero reports whether the time is the start of the video.
+func (t Time) IsZero() bool {
+	return t.Seconds == 0 && t.Frames == 0
+}
+
+// Before reports whether t comes before u, when both are in the same unit.
+// Times in different units cannot be compared without a frame rate.
+func (t Time) Before(u Time) (before bool, ok bool) {
+	if t.InFrames != u.InFrames {
+		return false, false
+	}
+	if t.InFrames {
+		return t.Frames < u.Frames, true
+	}
+	return t.Seconds < u.Seconds, true
+}
+
+// FormatSeconds formats seconds as ffmpeg reads them.
+func FormatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', -1, 64)
+}
+
+func valueOr(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
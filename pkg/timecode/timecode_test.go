@@ -0,0 +1,53 @@
+package timecode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("Given times in seconds, as a clock or in frames, it should parse them", func(t *testing.T) {
+		for value, expected := range map[string]Time{
+			"65.5":         {Seconds: 65.5},
+			"65.5s":        {Seconds: 65.5},
+			"500ms":        {Seconds: 0.5},
+			"00:01:05.500": {Seconds: 65.5},
+			"01:05.5":      {Seconds: 65.5},
+			"1:00:00":      {Seconds: 3600},
+			"120f":         {Frames: 120, InFrames: true},
+		} {
+			parsed, err := Parse(value)
+			assert.NoError(t, err, value)
+			assert.Equal(t, expected, parsed, value)
+		}
+	})
+
+	t.Run("Given invalid times, it should fail", func(t *testing.T) {
+		for _, value := range []string{"", "-5", "1:75", "00:60:00", "soon", "12.5f", "5 s"} {
+			_, err := Parse(value)
+			assert.Error(t, err, value)
+		}
+	})
+}
+
+func TestTime(t *testing.T) {
+	t.Run("Given a time in frames, it should convert it at the frame rate", func(t *testing.T) {
+		assert.Equal(t, 4.0, Time{Frames: 120, InFrames: true}.ToSeconds(30))
+		assert.Equal(t, 2.5, Time{Seconds: 2.5}.ToSeconds(30))
+	})
+
+	t.Run("Given times in the same unit, it should compare them", func(t *testing.T) {
+		before, ok := Time{Seconds: 1}.Before(Time{Seconds: 2})
+		assert.True(t, ok)
+		assert.True(t, before)
+
+		_, ok = Time{Seconds: 1}.Before(Time{Frames: 2, InFrames: true})
+		assert.False(t, ok)
+	})
+
+	t.Run("Given seconds, it should format them without an exponent", func(t *testing.T) {
+		assert.Equal(t, "0.0000001", FormatSeconds(1e-7))
+		assert.Equal(t, "3600", FormatSeconds(3600))
+	})
+}
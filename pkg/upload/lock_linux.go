@@ -0,0 +1,23 @@
+//go:build linux
+
+package upload
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile blocks until it holds the exclusive lock of file, which the other
+// replicas sharing the input path see as well.
+func lockFile(file *os.File) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
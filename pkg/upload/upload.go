@@ -0,0 +1,371 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound       = errors.New("upload not found")
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+	ErrIncomplete     = errors.New("upload is not complete")
+	ErrNotInspected   = errors.New("upload was not inspected")
+	ErrTooLarge       = errors.New("upload exceeds declared length")
+)
+
+// sweepInterval is the period between two removals of expired uploads.
+const sweepInterval = 10 * time.Minute
+
+type Upload struct {
+	Id        string            `json:"id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Owner     string            `json:"owner,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	SHA256    string            `json:"sha256,omitempty"`
+	Container string            `json:"container,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at,omitempty"`
+}
+
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+// Inspected reports whether the finished upload was found to be a media file,
+// which records its checksum.
+func (u *Upload) Inspected() bool {
+	return u.SHA256 != ""
+}
+
+// ExpiresAt returns when an upload left unfinished for expiry is removed,
+// counted from the last chunk it received.
+func (u *Upload) ExpiresAt(expiry time.Duration) time.Time {
+	if u.UpdatedAt.IsZero() {
+		return u.CreatedAt.Add(expiry)
+	}
+	return u.UpdatedAt.Add(expiry)
+}
+
+func (u *Upload) expired(expiry time.Duration, now time.Time) bool {
+	return !u.Inspected() && now.After(u.ExpiresAt(expiry))
+}
+
+// Store keeps resumable uploads on disk. Every upload is made of a data file
+// named after its id and a sidecar ".info" file holding its state, so any
+// replica sharing the input volume can continue an upload. Writes to an
+// upload hold its ".lock" file, so chunks sent to several replicas are
+// appended one after the other.
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	locks map[string]*uploadLock
+}
+
+// uploadLock is the in-process lock of an upload, kept while any goroutine
+// holds or waits for it.
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+func NewStore(path string) *Store {
+	return &Store{
+		path:  path,
+		locks: make(map[string]*uploadLock),
+	}
+}
+
+func (s *Store) Create(owner string, length int64, metadata map[string]string) (*Upload, error) {
+	now := time.Now().UTC()
+	u := &Upload{
+		Id:        uuid.New().String(),
+		Owner:     owner,
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	f, err := os.Create(s.FilePath(u.Id))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := s.writeInfo(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (s *Store) Get(id string) (*Upload, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var u Upload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+// Append writes the content of r at the given offset, which must match the
+// current offset of the upload. Whatever was received before r fails is kept,
+// so the client can resume from the new offset.
+func (s *Store) Append(id string, offset int64, r io.Reader) (*Upload, error) {
+	unlock, err := s.lock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	u, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Offset != offset {
+		return u, ErrOffsetMismatch
+	}
+
+	f, err := os.OpenFile(s.FilePath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	remaining := u.Length - u.Offset
+	written, copyErr := io.Copy(f, io.LimitReader(r, remaining+1))
+	if written > remaining {
+		written = remaining
+		copyErr = ErrTooLarge
+		if err := f.Truncate(u.Length); err != nil {
+			return nil, err
+		}
+	}
+
+	u.Offset += written
+	u.UpdatedAt = time.Now().UTC()
+	if err := s.writeInfo(u); err != nil {
+		return nil, err
+	}
+
+	return u, copyErr
+}
+
+func (s *Store) Delete(id string) error {
+	unlock, err := s.lock(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return s.remove(id)
+}
+
+// Expire removes the uploads that were not finished and inspected before
+// their expiry, and returns their ids.
+func (s *Store) Expire(expiry time.Duration, now time.Time) ([]string, error) {
+	infos, err := filepath.Glob(filepath.Join(s.path, "*.info"))
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []string
+	for _, info := range infos {
+		id := strings.TrimSuffix(filepath.Base(info), ".info")
+		ok, err := s.expire(id, expiry, now)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return expired, err
+		}
+		if ok {
+			expired = append(expired, id)
+		}
+	}
+
+	return expired, nil
+}
+
+func (s *Store) expire(id string, expiry time.Duration, now time.Time) (bool, error) {
+	unlock, err := s.lock(id)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	// The upload may have received a chunk while waiting for its lock.
+	u, err := s.Get(id)
+	if err != nil {
+		return false, err
+	}
+	if !u.expired(expiry, now) {
+		return false, nil
+	}
+
+	return true, s.remove(id)
+}
+
+// Sweep removes the expired uploads periodically, until ctx is done.
+func (s *Store) Sweep(ctx context.Context, expiry time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := s.Expire(expiry, time.Now())
+		if err != nil {
+			logger.Error("Failed to remove expired uploads", "error", err)
+		}
+		if len(expired) > 0 {
+			logger.Info("Removed expired uploads", "count", len(expired))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Resolve returns a finished upload so it can be used as a job input, once
+// its inspection succeeded.
+func (s *Store) Resolve(id string) (*Upload, error) {
+	u, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !u.Complete() {
+		return nil, ErrIncomplete
+	}
+	if !u.Inspected() {
+		return nil, ErrNotInspected
+	}
+
+	return u, nil
+}
+
+func (s *Store) Save(u *Upload) error {
+	unlock, err := s.lock(u.Id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return s.writeInfo(u)
+}
+
+func (s *Store) remove(id string) error {
+	if err := os.Remove(s.FilePath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(s.infoPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(s.lockPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) FilePath(id string) string {
+	return filepath.Join(s.path, id)
+}
+
+func (s *Store) infoPath(id string) string {
+	return fmt.Sprintf("%s.info", s.FilePath(id))
+}
+
+func (s *Store) lockPath(id string) string {
+	return fmt.Sprintf("%s.lock", s.FilePath(id))
+}
+
+func (s *Store) writeInfo(u *Upload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	tmp := fmt.Sprintf("%s.tmp", s.infoPath(u.Id))
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.infoPath(u.Id))
+}
+
+// lock takes the lock of the upload id, shared with the other replicas using
+// the same input path, and returns the function releasing it.
+func (s *Store) lock(id string) (func(), error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+
+	// Locks of files are shared with other processes but not always with the
+	// goroutines of this one.
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &uploadLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+	l.Lock()
+
+	release := func() {
+		l.Unlock()
+		s.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, id)
+		}
+		s.mu.Unlock()
+	}
+
+	file, err := os.OpenFile(s.lockPath(id), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		release()
+		return nil, fmt.Errorf("locking upload %s: %w", id, err)
+	}
+
+	return func() {
+		_ = unlockFile(file)
+		file.Close()
+		release()
+	}, nil
+}
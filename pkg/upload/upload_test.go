@@ -0,0 +1,182 @@
+package upload
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Append(t *testing.T) {
+	t.Run("Given an upload sent in chunks, it should resume from the stored offset", func(t *testing.T) {
+		store := NewStore(t.TempDir())
+
+		u, err := store.Create("", 11, map[string]string{"filename": "video.mp4"})
+		assert.NoError(t, err)
+
+		u, err = store.Append(u.Id, 0, strings.NewReader("hello "))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(6), u.Offset)
+		assert.False(t, u.Complete())
+
+		_, err = store.Resolve(u.Id)
+		assert.ErrorIs(t, err, ErrIncomplete)
+
+		u, err = store.Append(u.Id, 6, strings.NewReader("world"))
+		assert.NoError(t, err)
+		assert.True(t, u.Complete())
+
+		_, err = store.Resolve(u.Id)
+		assert.ErrorIs(t, err, ErrNotInspected)
+
+		u.SHA256 = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+		assert.NoError(t, store.Save(u))
+		u, err = store.Resolve(u.Id)
+		assert.NoError(t, err)
+		content, err := os.ReadFile(store.FilePath(u.Id))
+		assert.NoError(t, err)
+		assert.Equal(t, "hello world", string(content))
+	})
+
+	t.Run("Given a wrong offset, it should return a mismatch error", func(t *testing.T) {
+		store := NewStore(t.TempDir())
+
+		u, err := store.Create("", 5, nil)
+		assert.NoError(t, err)
+
+		_, err = store.Append(u.Id, 2, strings.NewReader("abc"))
+		assert.True(t, errors.Is(err, ErrOffsetMismatch))
+	})
+
+	t.Run("Given more data than declared, it should keep only the declared length", func(t *testing.T) {
+		store := NewStore(t.TempDir())
+
+		u, err := store.Create("", 3, nil)
+		assert.NoError(t, err)
+
+		u, err = store.Append(u.Id, 0, strings.NewReader("abcdef"))
+		assert.ErrorIs(t, err, ErrTooLarge)
+		assert.Equal(t, int64(3), u.Offset)
+
+		content, err := os.ReadFile(store.FilePath(u.Id))
+		assert.NoError(t, err)
+		assert.Equal(t, "abc", string(content))
+	})
+
+	t.Run("Given chunks sent to several replicas at once, it should append them one at a time", func(t *testing.T) {
+		path := t.TempDir()
+		first, second := NewStore(path), NewStore(path)
+
+		u, err := first.Create("", 6, nil)
+		assert.NoError(t, err)
+
+		reader, writer := io.Pipe()
+		firstDone := make(chan error, 1)
+		go func() {
+			_, err := first.Append(u.Id, 0, reader)
+			firstDone <- err
+		}()
+		_, _ = writer.Write([]byte("abc"))
+
+		secondDone := make(chan error, 1)
+		go func() {
+			_, err := second.Append(u.Id, 0, strings.NewReader("xyz"))
+			secondDone <- err
+		}()
+		select {
+		case err := <-secondDone:
+			t.Fatalf("Expected the second chunk to wait for the first one; got %v", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		writer.Close()
+		assert.NoError(t, <-firstDone)
+		assert.ErrorIs(t, <-secondDone, ErrOffsetMismatch)
+
+		content, err := os.ReadFile(first.FilePath(u.Id))
+		assert.NoError(t, err)
+		assert.Equal(t, "abc", string(content))
+	})
+
+	t.Run("Given a released lock, it should forget the lock of the upload", func(t *testing.T) {
+		store := NewStore(t.TempDir())
+
+		u, err := store.Create("", 3, nil)
+		assert.NoError(t, err)
+		_, err = store.Append(u.Id, 0, strings.NewReader("abc"))
+		assert.NoError(t, err)
+		assert.NoError(t, store.Save(u))
+
+		assert.Empty(t, store.locks)
+	})
+
+	t.Run("Given an id that is not a valid upload, it should return not found", func(t *testing.T) {
+		store := NewStore(t.TempDir())
+
+		_, err := store.Get("../../etc/passwd")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestStore_Expire(t *testing.T) {
+	expiry := time.Hour
+
+	t.Run("Given an upload that received no chunk for its expiry, it should remove its files", func(t *testing.T) {
+		store := NewStore(t.TempDir())
+
+		u, err := store.Create("", 6, nil)
+		assert.NoError(t, err)
+		_, err = store.Append(u.Id, 0, strings.NewReader("abc"))
+		assert.NoError(t, err)
+
+		expired, err := store.Expire(expiry, time.Now().Add(expiry+time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{u.Id}, expired)
+
+		_, err = store.Get(u.Id)
+		assert.ErrorIs(t, err, ErrNotFound)
+		for _, path := range []string{store.FilePath(u.Id), store.infoPath(u.Id), store.lockPath(u.Id)} {
+			_, err := os.Stat(path)
+			assert.True(t, os.IsNotExist(err), path)
+		}
+	})
+
+	t.Run("Given an upload that received a chunk within its expiry, it should keep it", func(t *testing.T) {
+		store := NewStore(t.TempDir())
+
+		u, err := store.Create("", 6, nil)
+		assert.NoError(t, err)
+		u.CreatedAt = u.CreatedAt.Add(-2 * expiry)
+		u.UpdatedAt = u.CreatedAt
+		assert.NoError(t, store.Save(u))
+		u, err = store.Append(u.Id, 0, strings.NewReader("abc"))
+		assert.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(expiry), u.ExpiresAt(expiry), time.Minute)
+
+		expired, err := store.Expire(expiry, time.Now())
+		assert.NoError(t, err)
+		assert.Empty(t, expired)
+	})
+
+	t.Run("Given an inspected upload, it should never expire it", func(t *testing.T) {
+		store := NewStore(t.TempDir())
+
+		u, err := store.Create("", 3, nil)
+		assert.NoError(t, err)
+		u, err = store.Append(u.Id, 0, strings.NewReader("abc"))
+		assert.NoError(t, err)
+		u.SHA256 = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+		assert.NoError(t, store.Save(u))
+
+		expired, err := store.Expire(expiry, time.Now().Add(2*expiry))
+		assert.NoError(t, err)
+		assert.Empty(t, expired)
+
+		_, err = store.Resolve(u.Id)
+		assert.NoError(t, err)
+	})
+}
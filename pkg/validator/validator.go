@@ -3,9 +3,85 @@ package validator
 import (
 	"fmt"
 	"reflect"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/douglasdgoulart/video-editor-api/pkg/timecode"
+)
+
+const (
+	MaxSteps  = 20
+	MaxInputs = 20
+)
+
+const (
+	MaxRenditions      = 10
+	MaxSegmentDuration = 60
+)
+
+const (
+	MinAudioGain = -60
+	MaxAudioGain = 20
+)
+
+// MaxCRF is the highest CRF of each video codec supporting the crf rate
+// control, libx264 being the default codec.
+var MaxCRF = map[string]int{
+	"libx264":    51,
+	"libx265":    51,
+	"libvpx-vp9": 63,
+	"libaom-av1": 63,
+	"libsvtav1":  63,
+}
+
+// TwoPassCodecs are the video codecs supporting the two_pass rate control.
+var TwoPassCodecs = []string{"libx264", "libvpx-vp9", "libaom-av1"}
+
+// Loudness targets within the ranges of the loudnorm filter.
+const (
+	MinIntegratedLoudness = -70
+	MaxIntegratedLoudness = -5
+	MinTruePeak           = -9
+	MaxTruePeak           = 0
+	MinLoudnessRange      = 1
+	MaxLoudnessRange      = 50
+)
+
+var audioExtensions = []string{"mp3", "aac", "m4a", "opus", "ogg", "wav", "flac"}
+
+const (
+	MaxTexts      = 20
+	MaxTextLength = 1000
+	MaxTextSize   = 500
 )
 
+const (
+	MaxSpriteTiles    = 20
+	MaxSpriteTileSize = 1280
+	MaxSpriteInterval = 3600
+	minSpriteTileSize = 16
+)
+
+const (
+	MaxSceneThumbnailWidth = 1920
+	MaxSplitTimes          = 100
+)
+
+var (
+	stepIdRegex  = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+	nameRegex    = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+	bitrateRegex = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[kKmM]?$`)
+	fontRegex    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 ._-]{0,127}\.(ttf|otf|ttc|TTF|OTF|TTC)$`)
+	colorRegex   = regexp.MustCompile(`^([a-zA-Z]+|#[0-9a-fA-F]{6}([0-9a-fA-F]{2})?|0x[0-9a-fA-F]{6}([0-9a-fA-F]{2})?)(@(0(\.[0-9]+)?|1(\.0+)?))?$`)
+)
+
+// numberingRegex matches the placeholder numbering the files of an output,
+// such as %03d.
+var numberingRegex = regexp.MustCompile(`%[0-9]{2}d`)
+
 func ValidateRequiredFields(v interface{}) error {
 	return validateRequiredFields(v, "")
 }
@@ -44,6 +120,634 @@ func validateRequiredFields(v interface{}, parentPath string) error {
 	return nil
 }
 
+// ValidateDuration checks that value, when set, is a positive duration such as
+// "90s" or "1h30m".
+func ValidateDuration(field string, value string) error {
+	if value == "" {
+		return nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return fmt.Errorf("field %s must be a positive duration, got %q", field, value)
+	}
+	return nil
+}
+
+// ValidateName checks that value is a name of up to 64 lowercase letters,
+// digits, - or _, such as "web-720p".
+func ValidateName(field string, value string) error {
+	if !nameRegex.MatchString(value) {
+		return fmt.Errorf("field %s must be 1 to 64 lowercase letters, digits, - or _, got %q", field, value)
+	}
+	return nil
+}
+
+// ValidateOutput checks the streaming options of an output: streaming modes
+// need a ladder of uniquely named renditions with a size and a bitrate, and
+// a playlist or manifest file pattern.
+func ValidateOutput(field string, output request.Output) error {
+	for _, options := range []struct {
+		mode string
+		set  bool
+	}{
+		{request.OutputModeSprite, output.Sprite != nil},
+		{request.OutputModeScenes, output.Scenes != nil},
+		{request.OutputModeSplit, output.Split != nil},
+	} {
+		if options.set && output.Mode != options.mode {
+			return fmt.Errorf("field %s.%s requires the %s mode", field, options.mode, options.mode)
+		}
+	}
+
+	switch output.Mode {
+	case "":
+		if len(output.Ladder) > 0 {
+			return fmt.Errorf("field %s.ladder requires a streaming mode", field)
+		}
+		return nil
+	case request.OutputModeSprite:
+		return validateSprite(field, output)
+	case request.OutputModeScenes:
+		return validateScenes(field, output)
+	case request.OutputModeSplit:
+		return validateSplit(field, output)
+	case request.OutputModeHls:
+		if !strings.HasSuffix(strings.ToLower(output.FilePattern), ".m3u8") {
+			return fmt.Errorf("field %s.file_pattern must be a .m3u8 playlist in %s mode", field, output.Mode)
+		}
+		if output.SegmentType != "" && output.SegmentType != "mpegts" && output.SegmentType != "fmp4" {
+			return fmt.Errorf("field %s.segment_type must be mpegts or fmp4, got %q", field, output.SegmentType)
+		}
+	case request.OutputModeDash:
+		if !strings.HasSuffix(strings.ToLower(output.FilePattern), ".mpd") {
+			return fmt.Errorf("field %s.file_pattern must be a .mpd manifest in %s mode", field, output.Mode)
+		}
+		if output.SegmentType != "" && output.SegmentType != "fmp4" {
+			return fmt.Errorf("field %s.segment_type must be fmp4 in %s mode, got %q", field, output.Mode, output.SegmentType)
+		}
+	default:
+		return fmt.Errorf("field %s.mode must be empty, hls, dash, sprite, scenes or split, got %q", field, output.Mode)
+	}
+
+	if output.SegmentDuration < 0 || output.SegmentDuration > MaxSegmentDuration {
+		return fmt.Errorf("field %s.segment_duration must be between 1 and %d seconds", field, MaxSegmentDuration)
+	}
+	if len(output.Ladder) == 0 || len(output.Ladder) > MaxRenditions {
+		return fmt.Errorf("field %s.ladder must hold between 1 and %d renditions", field, MaxRenditions)
+	}
+	names := make(map[string]bool, len(output.Ladder))
+	for i, rendition := range output.Ladder {
+		path := fmt.Sprintf("%s.ladder[%d]", field, i)
+		if !stepIdRegex.MatchString(rendition.Name) || names[rendition.Name] {
+			return fmt.Errorf("field %s.name must be a unique name of 1 to 32 lowercase letters, digits, - or _", path)
+		}
+		names[rendition.Name] = true
+		if rendition.Width < 0 || rendition.Height < 0 || rendition.Width+rendition.Height == 0 {
+			return fmt.Errorf("field %s requires a positive width or height", path)
+		}
+		if !bitrateRegex.MatchString(rendition.VideoBitrate) {
+			return fmt.Errorf("field %s.video_bitrate must be a bitrate such as 2500k, got %q", path, rendition.VideoBitrate)
+		}
+		if rendition.AudioBitrate != "" && !bitrateRegex.MatchString(rendition.AudioBitrate) {
+			return fmt.Errorf("field %s.audio_bitrate must be a bitrate such as 128k, got %q", path, rendition.AudioBitrate)
+		}
+	}
+	return nil
+}
+
+// validateSprite checks that a sprite output samples frames either at an
+// interval or on scene changes, into images of a bounded number and size of
+// tiles.
+func validateSprite(field string, output request.Output) error {
+	extension := strings.ToLower(output.FilePattern[strings.LastIndex(output.FilePattern, ".")+1:])
+	if extension != "jpg" && extension != "jpeg" && extension != "png" && extension != "webp" {
+		return fmt.Errorf("field %s.file_pattern must be a jpg, png or webp image in %s mode", field, output.Mode)
+	}
+	if len(output.Ladder) > 0 {
+		return fmt.Errorf("field %s.ladder requires a streaming mode", field)
+	}
+
+	sprite := output.Sprite
+	if sprite == nil {
+		return nil
+	}
+	path := field + ".sprite"
+	if sprite.Interval < 0 || sprite.Interval > MaxSpriteInterval {
+		return fmt.Errorf("field %s.interval must be between 0 and %d seconds", path, MaxSpriteInterval)
+	}
+	if sprite.SceneThreshold < 0 || sprite.SceneThreshold >= 1 {
+		return fmt.Errorf("field %s.scene_threshold must be between 0 and 1", path)
+	}
+	if sprite.Interval > 0 && sprite.SceneThreshold > 0 {
+		return fmt.Errorf("field %s sets both interval and scene_threshold", path)
+	}
+	if sprite.Columns < 0 || sprite.Columns > MaxSpriteTiles || sprite.Rows < 0 || sprite.Rows > MaxSpriteTiles {
+		return fmt.Errorf("field %s.columns and %s.rows must be between 1 and %d", path, path, MaxSpriteTiles)
+	}
+	for name, size := range map[string]int{"width": sprite.Width, "height": sprite.Height} {
+		if size != 0 && (size < minSpriteTileSize || size > MaxSpriteTileSize) {
+			return fmt.Errorf("field %s.%s must be between %d and %d", path, name, minSpriteTileSize, MaxSpriteTileSize)
+		}
+	}
+	return nil
+}
+
+// validateScenes checks that a scenes output writes a JSON file, detecting
+// scene changes over a threshold with thumbnails of a bounded width.
+func validateScenes(field string, output request.Output) error {
+	if !strings.HasSuffix(strings.ToLower(output.FilePattern), ".json") {
+		return fmt.Errorf("field %s.file_pattern must be a .json file in %s mode", field, output.Mode)
+	}
+	if len(output.Ladder) > 0 {
+		return fmt.Errorf("field %s.ladder requires a streaming mode", field)
+	}
+
+	scenes := output.Scenes
+	if scenes == nil {
+		return nil
+	}
+	path := field + ".scenes"
+	if scenes.Threshold < 0 || scenes.Threshold >= 1 {
+		return fmt.Errorf("field %s.threshold must be between 0 and 1", path)
+	}
+	if scenes.Width != 0 && !scenes.Thumbnails {
+		return fmt.Errorf("field %s.width requires thumbnails", path)
+	}
+	if scenes.Width != 0 && (scenes.Width < minSpriteTileSize || scenes.Width > MaxSceneThumbnailWidth) {
+		return fmt.Errorf("field %s.width must be between %d and %d", path, minSpriteTileSize, MaxSceneThumbnailWidth)
+	}
+	return nil
+}
+
+// validateSplit checks that a split output cuts the video at increasing
+// times into numbered clips.
+func validateSplit(field string, output request.Output) error {
+	if !numberingRegex.MatchString(output.FilePattern) {
+		return fmt.Errorf("field %s.file_pattern must number the clips with a placeholder such as %%03d in %s mode", field, output.Mode)
+	}
+	if len(output.Ladder) > 0 {
+		return fmt.Errorf("field %s.ladder requires a streaming mode", field)
+	}
+
+	path := field + ".split.times"
+	if output.Split == nil || len(output.Split.Times) == 0 || len(output.Split.Times) > MaxSplitTimes {
+		return fmt.Errorf("field %s must hold between 1 and %d times", path, MaxSplitTimes)
+	}
+	for i, time := range output.Split.Times {
+		if time <= 0 || (i > 0 && time <= output.Split.Times[i-1]) {
+			return fmt.Errorf("field %s must hold positive times in increasing order", path)
+		}
+	}
+	return nil
+}
+
+// ValidateInputs checks that a request under path sets several inputs only
+// for an operation joining them, each input having a single source.
+func ValidateInputs(path string, req request.EditorRequest) error {
+	field := buildFieldPath(path, "inputs")
+	if req.Concat == nil {
+		if len(req.Inputs) > 0 {
+			return fmt.Errorf("field %s requires concat", field)
+		}
+		return nil
+	}
+
+	if len(req.Steps) > 0 {
+		return fmt.Errorf("field %s is not supported in pipelines, only in their steps", buildFieldPath(path, "concat"))
+	}
+	if len(req.Inputs) < 2 || len(req.Inputs) > MaxInputs {
+		return fmt.Errorf("field %s must hold between 2 and %d inputs for concat", field, MaxInputs)
+	}
+	if req.Input.FileURL != "" || req.Input.UploadId != "" || req.Input.Step != "" {
+		return fmt.Errorf("field %s can not be combined with %s", field, buildFieldPath(path, "input"))
+	}
+	for i, input := range req.Inputs {
+		sources := 0
+		for _, source := range []string{input.FileURL, input.UploadId, input.Step} {
+			if source != "" {
+				sources++
+			}
+		}
+		if sources != 1 {
+			return fmt.Errorf("field %s[%d] must set one of file_url, upload_id or step", field, i)
+		}
+	}
+
+	switch req.Concat.Method {
+	case "", request.ConcatAuto, request.ConcatDemuxer, request.ConcatFilter:
+	default:
+		return fmt.Errorf("field %s.method must be auto, demuxer or filter, got %q", buildFieldPath(path, "concat"), req.Concat.Method)
+	}
+	if req.Output.Mode != "" {
+		return fmt.Errorf("field %s.mode is not supported with concat", buildFieldPath(path, "output"))
+	}
+	return nil
+}
+
+// ValidateOverlay checks that the overlay of a request under path, if any,
+// has a single uploaded or remote input and a valid position, opacity, scale
+// and time range.
+func ValidateOverlay(path string, req request.EditorRequest) error {
+	overlay := req.Overlay
+	if overlay == nil {
+		return nil
+	}
+	field := buildFieldPath(path, "overlay")
+	if len(req.Steps) > 0 {
+		return fmt.Errorf("field %s is not supported in pipelines, only in their steps", field)
+	}
+
+	if (overlay.Input.FileURL == "") == (overlay.Input.UploadId == "") || overlay.Input.Step != "" {
+		return fmt.Errorf("field %s.input must set one of file_url or upload_id", field)
+	}
+	if err := validatePlacement(field, overlay.Placement); err != nil {
+		return err
+	}
+	if overlay.Opacity < 0 || overlay.Opacity > 1 {
+		return fmt.Errorf("field %s.opacity must be between 0 and 1", field)
+	}
+	if overlay.Scale < 0 || overlay.Scale > 1 {
+		return fmt.Errorf("field %s.scale must be between 0 and 1", field)
+	}
+	if req.Output.Mode == request.OutputModeSprite || req.Output.Mode == request.OutputModeScenes {
+		return fmt.Errorf("field %s is not supported in %s mode", field, req.Output.Mode)
+	}
+	return nil
+}
+
+// ValidateCaptions checks the texts and the subtitles of a request under
+// path, if any.
+func ValidateCaptions(path string, req request.EditorRequest) error {
+	if len(req.Texts) == 0 && req.Subtitles == nil {
+		return nil
+	}
+	if len(req.Steps) > 0 {
+		return fmt.Errorf("fields %s and %s are not supported in pipelines, only in their steps", buildFieldPath(path, "texts"), buildFieldPath(path, "subtitles"))
+	}
+	if req.Output.Mode == request.OutputModeSprite || req.Output.Mode == request.OutputModeScenes {
+		return fmt.Errorf("fields %s and %s are not supported in %s mode", buildFieldPath(path, "texts"), buildFieldPath(path, "subtitles"), req.Output.Mode)
+	}
+
+	if len(req.Texts) > MaxTexts {
+		return fmt.Errorf("field %s holds at most %d texts", buildFieldPath(path, "texts"), MaxTexts)
+	}
+	for i, text := range req.Texts {
+		field := fmt.Sprintf("%s[%d]", buildFieldPath(path, "texts"), i)
+		if text.Text == "" || len(text.Text) > MaxTextLength {
+			return fmt.Errorf("field %s.text must hold 1 to %d characters", field, MaxTextLength)
+		}
+		if text.Font != "" && !fontRegex.MatchString(text.Font) {
+			return fmt.Errorf("field %s.font must be the name of a ttf, otf or ttc font file, got %q", field, text.Font)
+		}
+		if text.Size < 0 || text.Size > MaxTextSize {
+			return fmt.Errorf("field %s.size must be between 1 and %d", field, MaxTextSize)
+		}
+		for name, color := range map[string]string{"color": text.Color, "box_color": text.BoxColor} {
+			if color != "" && !colorRegex.MatchString(color) {
+				return fmt.Errorf("field %s.%s must be a color such as white, #ffcc00 or black@0.5, got %q", field, name, color)
+			}
+		}
+		if text.BoxBorder < 0 || text.BoxBorder > MaxTextSize {
+			return fmt.Errorf("field %s.box_border must be between 0 and %d", field, MaxTextSize)
+		}
+		if err := validatePlacement(field, text.Placement); err != nil {
+			return err
+		}
+	}
+
+	if subtitles := req.Subtitles; subtitles != nil {
+		field := buildFieldPath(path, "subtitles")
+		if (subtitles.Input.FileURL == "") == (subtitles.Input.UploadId == "") || subtitles.Input.Step != "" {
+			return fmt.Errorf("field %s.input must set one of file_url or upload_id", field)
+		}
+		if len(subtitles.Style) > MaxTextLength {
+			return fmt.Errorf("field %s.style holds at most %d characters", field, MaxTextLength)
+		}
+	}
+	return nil
+}
+
+// validatePlacement checks the position and the time range of an overlay or
+// a text.
+func validatePlacement(field string, placement request.Placement) error {
+	switch placement.Position {
+	case "", request.PositionTopLeft, request.PositionTopRight, request.PositionBottomLeft, request.PositionBottomRight, request.PositionCenter:
+		if placement.X != 0 || placement.Y != 0 {
+			return fmt.Errorf("field %s.x and %s.y require the custom position", field, field)
+		}
+	case request.PositionCustom:
+		if placement.X < 0 || placement.Y < 0 {
+			return fmt.Errorf("field %s.x and %s.y must not be negative", field, field)
+		}
+	default:
+		return fmt.Errorf("field %s.position must be top-left, top-right, bottom-left, bottom-right, center or custom, got %q", field, placement.Position)
+	}
+	if placement.Margin < 0 {
+		return fmt.Errorf("field %s.margin must not be negative", field)
+	}
+	if placement.Start < 0 || placement.End < 0 || (placement.End > 0 && placement.End <= placement.Start) {
+		return fmt.Errorf("field %s.end must be after %s.start", field, field)
+	}
+	return nil
+}
+
+// ValidateAudio checks the audio operation of a request under path, if any:
+// extracted audio goes to an audio file, while replaced or mixed audio comes
+// from a single uploaded or remote input.
+func ValidateAudio(path string, req request.EditorRequest) error {
+	audio := req.Audio
+	if audio == nil {
+		return nil
+	}
+	field := buildFieldPath(path, "audio")
+	if len(req.Steps) > 0 {
+		return fmt.Errorf("field %s is not supported in pipelines, only in their steps", field)
+	}
+	if req.Concat != nil {
+		return fmt.Errorf("field %s is not supported with concat", field)
+	}
+	if req.Output.Mode != "" {
+		return fmt.Errorf("field %s is not supported in %s mode", field, req.Output.Mode)
+	}
+
+	switch audio.Mode {
+	case request.AudioExtract:
+		extension := strings.ToLower(req.Output.FilePattern[strings.LastIndex(req.Output.FilePattern, ".")+1:])
+		if !slices.Contains(audioExtensions, extension) {
+			return fmt.Errorf("field %s.file_pattern must be a %s audio file to extract audio", buildFieldPath(path, "output"), strings.Join(audioExtensions, ", "))
+		}
+		if audio.Input != (request.Input{}) {
+			return fmt.Errorf("field %s.input is not supported in %s mode", field, audio.Mode)
+		}
+		if len(req.Filters) > 0 || req.Overlay != nil || len(req.Texts) > 0 || req.Subtitles != nil {
+			return fmt.Errorf("field %s.mode %s does not support video operations", field, audio.Mode)
+		}
+	case request.AudioReplace, request.AudioMix:
+		if (audio.Input.FileURL == "") == (audio.Input.UploadId == "") || audio.Input.Step != "" {
+			return fmt.Errorf("field %s.input must set one of file_url or upload_id", field)
+		}
+	default:
+		return fmt.Errorf("field %s.mode must be extract, replace or mix, got %q", field, audio.Mode)
+	}
+
+	if audio.Mode != request.AudioMix && (audio.Gain != 0 || audio.Ducking) {
+		return fmt.Errorf("fields %s.gain and %s.ducking require the mix mode", field, field)
+	}
+	if audio.Gain < MinAudioGain || audio.Gain > MaxAudioGain {
+		return fmt.Errorf("field %s.gain must be between %d and %d dB", field, MinAudioGain, MaxAudioGain)
+	}
+	if audio.Loop && audio.Mode == request.AudioExtract {
+		return fmt.Errorf("field %s.loop is not supported in %s mode", field, audio.Mode)
+	}
+	return nil
+}
+
+// ValidateLoudness checks the loudness targets of a request under path, if
+// any, unset targets taking their default.
+func ValidateLoudness(path string, req request.EditorRequest) error {
+	loudness := req.Loudness
+	if loudness == nil {
+		return nil
+	}
+	field := buildFieldPath(path, "loudness")
+	if len(req.Steps) > 0 {
+		return fmt.Errorf("field %s is not supported in pipelines, only in their steps", field)
+	}
+	if req.Concat != nil {
+		return fmt.Errorf("field %s is not supported with concat", field)
+	}
+	if req.Output.Mode != "" {
+		return fmt.Errorf("field %s is not supported in %s mode", field, req.Output.Mode)
+	}
+
+	if loudness.Integrated != 0 && (loudness.Integrated < MinIntegratedLoudness || loudness.Integrated > MaxIntegratedLoudness) {
+		return fmt.Errorf("field %s.integrated must be between %d and %d LUFS", field, MinIntegratedLoudness, MaxIntegratedLoudness)
+	}
+	if loudness.TruePeak < MinTruePeak || loudness.TruePeak > MaxTruePeak {
+		return fmt.Errorf("field %s.true_peak must be between %d and %d dBTP", field, MinTruePeak, MaxTruePeak)
+	}
+	if loudness.Range != 0 && (loudness.Range < MinLoudnessRange || loudness.Range > MaxLoudnessRange) {
+		return fmt.Errorf("field %s.range must be between %d and %d LU", field, MinLoudnessRange, MaxLoudnessRange)
+	}
+	return nil
+}
+
+// ValidateRateControl checks the rate control of a request under path, if
+// any, against the codec of the request.
+func ValidateRateControl(path string, req request.EditorRequest) error {
+	rateControl := req.RateControl
+	if rateControl == nil {
+		return nil
+	}
+	field := buildFieldPath(path, "rate_control")
+	if len(req.Steps) > 0 {
+		return fmt.Errorf("field %s is not supported in pipelines, only in their steps", field)
+	}
+	if req.Concat != nil {
+		return fmt.Errorf("field %s is not supported with concat", field)
+	}
+	if req.Output.Mode != "" {
+		return fmt.Errorf("field %s is not supported in %s mode", field, req.Output.Mode)
+	}
+	if req.Audio != nil && req.Audio.Mode == request.AudioExtract {
+		return fmt.Errorf("field %s is not supported when extracting audio", field)
+	}
+
+	codec := req.Codec
+	if codec == "" {
+		codec = "libx264"
+	}
+	if (rateControl.MaxRate == "") != (rateControl.BufSize == "") {
+		return fmt.Errorf("fields %s.max_rate and %s.buf_size must be set together", field, field)
+	}
+	if rateControl.MaxRate != "" && !bitrateRegex.MatchString(rateControl.MaxRate) {
+		return fmt.Errorf("field %s.max_rate must be a bitrate such as 2500k, got %q", field, rateControl.MaxRate)
+	}
+	if rateControl.BufSize != "" && !bitrateRegex.MatchString(rateControl.BufSize) {
+		return fmt.Errorf("field %s.buf_size must be a bitrate such as 5000k, got %q", field, rateControl.BufSize)
+	}
+
+	switch rateControl.Mode {
+	case request.RateControlCRF:
+		maxCRF, ok := MaxCRF[codec]
+		if !ok {
+			return fmt.Errorf("field codec %q does not support the %s rate control", codec, rateControl.Mode)
+		}
+		if rateControl.CRF < 0 || rateControl.CRF > maxCRF {
+			return fmt.Errorf("field %s.crf must be between 0 and %d for %s", field, maxCRF, codec)
+		}
+		if rateControl.Bitrate != "" {
+			return fmt.Errorf("field %s.bitrate is not supported in %s mode", field, rateControl.Mode)
+		}
+	case request.RateControlTwoPass:
+		if !slices.Contains(TwoPassCodecs, codec) {
+			return fmt.Errorf("field codec %q does not support the %s rate control", codec, rateControl.Mode)
+		}
+		if !bitrateRegex.MatchString(rateControl.Bitrate) {
+			return fmt.Errorf("field %s.bitrate must be a bitrate such as 2500k, got %q", field, rateControl.Bitrate)
+		}
+		if rateControl.CRF != 0 {
+			return fmt.Errorf("field %s.crf is not supported in %s mode", field, rateControl.Mode)
+		}
+	default:
+		return fmt.Errorf("field %s.mode must be crf or two_pass, got %q", field, rateControl.Mode)
+	}
+	return nil
+}
+
+// ValidateTrim checks the start time, the end time and the duration of a
+// request under path, and that its trim mode can cut it: stream copies rule
+// out every operation re-encoding the streams.
+func ValidateTrim(path string, req request.EditorRequest) error {
+	times := map[string]timecode.Time{}
+	for _, field := range []struct {
+		name  string
+		value string
+	}{{"start_time", req.StartTime}, {"end_time", req.EndTime}, {"duration", req.Duration}} {
+		if field.value == "" {
+			continue
+		}
+		parsed, err := timecode.Parse(field.value)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", buildFieldPath(path, field.name), err)
+		}
+		times[field.name] = parsed
+	}
+
+	end, hasEnd := times["end_time"]
+	duration, hasDuration := times["duration"]
+	if hasEnd && hasDuration {
+		return fmt.Errorf("fields %s and %s cannot be set together", buildFieldPath(path, "end_time"), buildFieldPath(path, "duration"))
+	}
+	if hasDuration && duration.IsZero() {
+		return fmt.Errorf("field %s must be greater than zero", buildFieldPath(path, "duration"))
+	}
+	if before, ok := times["start_time"].Before(end); hasEnd && ok && !before {
+		return fmt.Errorf("field %s must come after %s", buildFieldPath(path, "end_time"), buildFieldPath(path, "start_time"))
+	}
+	if len(req.Steps) > 0 && (hasEnd || hasDuration || req.TrimMode != "") {
+		return fmt.Errorf("fields end_time, duration and trim_mode are not supported in pipelines, only in their steps")
+	}
+
+	switch req.TrimMode {
+	case "", request.TrimAccurate:
+		return nil
+	case request.TrimFast, request.TrimSmart:
+	default:
+		return fmt.Errorf("field %s must be fast, accurate or smart, got %q", buildFieldPath(path, "trim_mode"), req.TrimMode)
+	}
+	field := buildFieldPath(path, "trim_mode")
+	if len(times) == 0 {
+		return fmt.Errorf("field %s requires a start_time, an end_time or a duration", field)
+	}
+	if req.Concat != nil || req.Output.Mode != "" {
+		return fmt.Errorf("field %s %s is not supported with concat or streaming and sprite outputs", field, req.TrimMode)
+	}
+	if len(req.Filters) > 0 || req.Overlay != nil || len(req.Texts) > 0 || req.Subtitles != nil ||
+		req.Audio != nil || req.Loudness != nil || req.RateControl != nil || req.Codec != "" || req.AudioCodec != "" {
+		return fmt.Errorf("field %s %s copies the streams, which rules out filters, codecs and audio operations", field, req.TrimMode)
+	}
+	return nil
+}
+
+// ValidateSteps checks that the steps of a pipeline request have unique ids,
+// their required fields, and only take their inputs from other steps without
+// forming a cycle.
+func ValidateSteps(steps []request.Step) error {
+	if len(steps) > MaxSteps {
+		return fmt.Errorf("field steps holds at most %d steps", MaxSteps)
+	}
+
+	index := make(map[string]int, len(steps))
+	for i, step := range steps {
+		path := fmt.Sprintf("steps[%d]", i)
+		if !stepIdRegex.MatchString(step.Id) {
+			return fmt.Errorf("field %s.id must be 1 to 32 lowercase letters, digits, - or _", path)
+		}
+		if _, ok := index[step.Id]; ok {
+			return fmt.Errorf("field %s.id %q is not unique", path, step.Id)
+		}
+		index[step.Id] = i
+
+		if len(step.Steps) > 0 {
+			return fmt.Errorf("field %s.steps is not supported", path)
+		}
+		if step.Input.Step != "" && (step.Input.FileURL != "" || step.Input.UploadId != "") {
+			return fmt.Errorf("field %s.input.step can not be combined with another input", path)
+		}
+		if err := validateRequiredFields(step.EditorRequest, path); err != nil {
+			return err
+		}
+		if err := ValidateDuration(path+".timeout", step.Timeout); err != nil {
+			return err
+		}
+		if err := ValidateOutput(path+".output", step.Output); err != nil {
+			return err
+		}
+		if err := ValidateInputs(path, step.EditorRequest); err != nil {
+			return err
+		}
+		if err := ValidateOverlay(path, step.EditorRequest); err != nil {
+			return err
+		}
+		if err := ValidateCaptions(path, step.EditorRequest); err != nil {
+			return err
+		}
+		if err := ValidateAudio(path, step.EditorRequest); err != nil {
+			return err
+		}
+		if err := ValidateLoudness(path, step.EditorRequest); err != nil {
+			return err
+		}
+		if err := ValidateRateControl(path, step.EditorRequest); err != nil {
+			return err
+		}
+		if err := ValidateTrim(path, step.EditorRequest); err != nil {
+			return err
+		}
+	}
+
+	for i, step := range steps {
+		for _, dependency := range step.Dependencies() {
+			if _, ok := index[dependency]; !ok {
+				return fmt.Errorf("field steps[%d] depends on unknown step %q", i, dependency)
+			}
+		}
+	}
+
+	// Depth first search, a step reached again while its dependencies are
+	// being visited is part of a cycle.
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := make([]int, len(steps))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch marks[i] {
+		case visiting:
+			return fmt.Errorf("field steps has a cycle through step %q", steps[i].Id)
+		case visited:
+			return nil
+		}
+		marks[i] = visiting
+		for _, dependency := range steps[i].Dependencies() {
+			if err := visit(index[dependency]); err != nil {
+				return err
+			}
+		}
+		marks[i] = visited
+		return nil
+	}
+	for i := range steps {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func buildFieldPath(parentPath, fieldName string) string {
 	if parentPath == "" {
 		return fieldName
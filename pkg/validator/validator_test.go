@@ -0,0 +1,106 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/douglasdgoulart/video-editor-api/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTrim(t *testing.T) {
+	t.Run("Given valid times in seconds, clocks or frames, it should accept them", func(t *testing.T) {
+		for _, req := range []request.EditorRequest{
+			{},
+			{StartTime: "65.5", Duration: "10"},
+			{StartTime: "00:01:05.500", EndTime: "00:01:10"},
+			{StartTime: "120f", EndTime: "240f"},
+			{StartTime: "500ms", Duration: "48f"},
+			{EndTime: "3000f", TrimMode: request.TrimSmart},
+			{StartTime: "2", TrimMode: request.TrimFast},
+			{Duration: "4", TrimMode: request.TrimAccurate, Filters: map[string]string{"scale": "1280:-2"}},
+		} {
+			assert.NoError(t, ValidateTrim("", req), "%+v", req)
+		}
+	})
+
+	t.Run("Given an end time and a duration, it should reject the request", func(t *testing.T) {
+		err := ValidateTrim("steps[0]", request.EditorRequest{EndTime: "10", Duration: "5"})
+		assert.ErrorContains(t, err, "fields steps[0].end_time and steps[0].duration cannot be set together")
+	})
+
+	t.Run("Given a zero duration, it should reject the request", func(t *testing.T) {
+		for _, duration := range []string{"0", "0f", "00:00:00"} {
+			assert.ErrorContains(t, ValidateTrim("", request.EditorRequest{Duration: duration}), "duration must be greater than zero", duration)
+		}
+	})
+
+	t.Run("Given an end time not after the start time, it should reject the request", func(t *testing.T) {
+		for _, req := range []request.EditorRequest{
+			{StartTime: "10", EndTime: "5"},
+			{StartTime: "00:00:10", EndTime: "10"},
+			{StartTime: "250f", EndTime: "100f"},
+		} {
+			assert.ErrorContains(t, ValidateTrim("", req), "end_time must come after start_time", "%+v", req)
+		}
+	})
+
+	t.Run("Given times in frames and in seconds, it should leave their order to the editor", func(t *testing.T) {
+		assert.NoError(t, ValidateTrim("", request.EditorRequest{StartTime: "10", EndTime: "100f"}))
+		assert.NoError(t, ValidateTrim("", request.EditorRequest{StartTime: "300f", EndTime: "5"}))
+	})
+
+	t.Run("Given an invalid time, it should name its field", func(t *testing.T) {
+		for field, req := range map[string]request.EditorRequest{
+			"start_time": {StartTime: "1:aa"},
+			"end_time":   {EndTime: "-5"},
+			"duration":   {Duration: "2.5f"},
+		} {
+			assert.ErrorContains(t, ValidateTrim("", req), "field "+field+": invalid time", field)
+		}
+	})
+
+	t.Run("Given an unknown trim mode or one without times, it should reject the request", func(t *testing.T) {
+		assert.ErrorContains(t, ValidateTrim("", request.EditorRequest{StartTime: "2", TrimMode: "exact"}), "must be fast, accurate or smart")
+		assert.ErrorContains(t, ValidateTrim("", request.EditorRequest{TrimMode: request.TrimFast}), "requires a start_time, an end_time or a duration")
+	})
+
+	t.Run("Given a fast or smart trim with a stream copy exclusion, it should reject the request", func(t *testing.T) {
+		for name, req := range map[string]request.EditorRequest{
+			"filters":      {Filters: map[string]string{"scale": "1280:-2"}},
+			"overlay":      {Overlay: &request.Overlay{}},
+			"texts":        {Texts: []request.Text{{Text: "title"}}},
+			"subtitles":    {Subtitles: &request.Subtitles{}},
+			"audio":        {Audio: &request.Audio{}},
+			"loudness":     {Loudness: &request.Loudness{}},
+			"rate control": {RateControl: &request.RateControl{}},
+			"codec":        {Codec: "libx264"},
+			"audio codec":  {AudioCodec: "aac"},
+		} {
+			for _, mode := range []string{request.TrimFast, request.TrimSmart} {
+				req.StartTime, req.TrimMode = "2", mode
+				assert.ErrorContains(t, ValidateTrim("", req), "copies the streams", "%s %s", mode, name)
+			}
+		}
+
+		for name, req := range map[string]request.EditorRequest{
+			"concat": {Concat: &request.Concat{}},
+			"sprite": {Output: request.Output{Mode: request.OutputModeSprite}},
+			"hls":    {Output: request.Output{Mode: request.OutputModeHls}},
+		} {
+			req.StartTime, req.TrimMode = "2", request.TrimSmart
+			assert.ErrorContains(t, ValidateTrim("", req), "is not supported with concat or streaming and sprite outputs", name)
+		}
+	})
+
+	t.Run("Given a pipeline with an end time, a duration or a trim mode, it should only accept them in its steps", func(t *testing.T) {
+		steps := []request.Step{{Id: "trim"}}
+		assert.NoError(t, ValidateTrim("", request.EditorRequest{StartTime: "2", Steps: steps}))
+		for _, req := range []request.EditorRequest{
+			{EndTime: "10", Steps: steps},
+			{Duration: "10", Steps: steps},
+			{StartTime: "2", TrimMode: request.TrimFast, Steps: steps},
+		} {
+			assert.ErrorContains(t, ValidateTrim("", req), "not supported in pipelines", "%+v", req)
+		}
+	})
+}
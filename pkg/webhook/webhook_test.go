@@ -0,0 +1,44 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPost(t *testing.T) {
+	t.Run("Given a payload, it should post it as JSON", func(t *testing.T) {
+		received := make(chan map[string]string, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var payload map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			received <- payload
+		}))
+		defer server.Close()
+
+		assert.NoError(t, Post(server.URL, map[string]string{"status": "success"}))
+		assert.Equal(t, map[string]string{"status": "success"}, <-received)
+	})
+
+	t.Run("Given a stalled endpoint, it should give up once the timeout is reached", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		defaultClient := client
+		client = &http.Client{Timeout: 100 * time.Millisecond}
+		defer func() { client = defaultClient }()
+
+		started := time.Now()
+		assert.ErrorContains(t, Post(server.URL, map[string]string{}), "calling webhook")
+		assert.Less(t, time.Since(started), 5*time.Second)
+	})
+}
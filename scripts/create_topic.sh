@@ -1,2 +1,4 @@
 #!/bin/bash
-kafka-topics --create --topic event --bootstrap-server kafka:29092 --replication-factor 1 --partitions 10 || echo "Topic already exists, ignoring error."
+for topic in event event-high event-low; do
+  kafka-topics --create --topic "$topic" --bootstrap-server kafka:29092 --replication-factor 1 --partitions 10 || echo "Topic $topic already exists, ignoring error."
+done